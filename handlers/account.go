@@ -0,0 +1,305 @@
+package handlers
+
+// email verification and password reset
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"forum/mailer"
+	"forum/models"
+)
+
+const (
+	verificationTokenTTL = 48 * time.Hour
+	resetTokenTTL        = time.Hour
+)
+
+var (
+	mailSender mailer.Mailer = mailer.LogMailer{}
+	baseURL                  = "http://localhost:8080"
+)
+
+// SetMailer configures how emails are sent and the public URL used in links inside them.
+func SetMailer(m mailer.Mailer, url string) {
+	mailSender = m
+	baseURL = url
+}
+
+// sendVerificationEmail issues a verification token for the user and emails the link.
+func sendVerificationEmail(userID string) error {
+	email, err := models.GetEmailByID(userID)
+	if err != nil {
+		return err
+	}
+
+	token, err := models.CreateToken(userID, models.TokenEmailVerification, verificationTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Welcome to Book Forum!\n\nPlease confirm your email address by opening this link:\n%s/verify_email?token=%s\n\nThe link expires in 48 hours.\n",
+		baseURL, token)
+	return mailSender.Send(email, "Confirm your email address", body)
+}
+
+// requireVerifiedEmail renders an error and returns false when the user has not verified their email yet.
+func requireVerifiedEmail(w http.ResponseWriter, r *http.Request, userID string) bool {
+	verified, err := models.IsEmailVerified(userID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return false
+	}
+	if !verified {
+		ErrorHandler(w, r, http.StatusForbidden, "Please verify your email address before posting")
+		return false
+	}
+	return true
+}
+
+// VerifyEmailHandler confirms an email address using the token from the verification link.
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := models.ConsumeToken(r.URL.Query().Get("token"), models.TokenEmailVerification)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusBadRequest, "The verification link is invalid or has expired")
+		return
+	}
+
+	if err := models.MarkEmailVerified(userID); err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	http.Redirect(w, r, "/?notification=email_verified", http.StatusSeeOther)
+}
+
+// ResendVerificationHandler sends a fresh verification link to the logged-in user.
+func ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	cookie, err := r.Cookie("session_token")
+	if err != nil || cookie.Value == "" {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	userID, _, err := models.GetIDBySessionToken(cookie.Value)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+
+	verified, err := models.IsEmailVerified(userID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if !verified {
+		if err := models.RevokeTokens(userID, models.TokenEmailVerification); err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		if err := sendVerificationEmail(userID); err != nil {
+			log.Println("Error sending verification email:", err)
+			ErrorHandler(w, r, http.StatusInternalServerError, "Could not send the verification email")
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/?notification=verification_sent", http.StatusSeeOther)
+}
+
+// ForgotPasswordHandler emails a password reset link. The response is the same whether
+// or not the email is registered, so the form cannot be used to discover accounts.
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := template.ParseFiles("templates/forgot_password.html")
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error loading template")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		tmpl.Execute(w, nil)
+		return
+	}
+
+	email := r.FormValue("email")
+	userID, _, err := models.GetUserByEmail(email)
+	if err == nil {
+		token, err := models.CreateToken(userID, models.TokenPasswordReset, resetTokenTTL)
+		if err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+
+		body := fmt.Sprintf("Someone asked to reset the password of your Book Forum account.\n\nTo choose a new password, open this link:\n%s/reset_password?token=%s\n\nThe link expires in one hour. If you did not ask for this, you can ignore this email.\n",
+			baseURL, token)
+		if err := mailSender.Send(email, "Reset your password", body); err != nil {
+			log.Println("Error sending password reset email:", err)
+		}
+	}
+
+	tmpl.Execute(w, struct{ Message string }{Message: "If that email is registered, a reset link is on its way."})
+}
+
+// ResetPasswordHandler lets the user choose a new password using the token from the reset link.
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := template.ParseFiles("templates/reset_password.html")
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error loading template")
+		return
+	}
+
+	token := r.FormValue("token")
+	if r.Method != http.MethodPost {
+		tmpl.Execute(w, struct{ Token, Error string }{Token: token})
+		return
+	}
+
+	password := r.FormValue("password")
+	if password == "" {
+		tmpl.Execute(w, struct{ Token, Error string }{Token: token, Error: "Please enter a new password"})
+		return
+	}
+	if password != r.FormValue("confirm_password") {
+		tmpl.Execute(w, struct{ Token, Error string }{Token: token, Error: "Passwords do not match"})
+		return
+	}
+
+	// Check the new password before using up the link, so a rejected password can be retried
+	userID, err := models.CheckToken(token, models.TokenPasswordReset)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusBadRequest, "The reset link is invalid or has expired")
+		return
+	}
+	username, err1 := models.GetUsernameByID(userID)
+	email, err2 := models.GetEmailByID(userID)
+	if err1 != nil || err2 != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if err := models.ValidatePassword(password, username, email); err != nil {
+		tmpl.Execute(w, struct{ Token, Error string }{Token: token, Error: err.Error()})
+		return
+	}
+
+	if _, err := models.ConsumeToken(token, models.TokenPasswordReset); err != nil {
+		ErrorHandler(w, r, http.StatusBadRequest, "The reset link is invalid or has expired")
+		return
+	}
+
+	if err := models.ResetPassword(userID, password); err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if err := models.RevokeTokens(userID, models.TokenPasswordReset); err != nil {
+		log.Println("Error revoking reset tokens:", err)
+	}
+
+	renderLogin(w, "", "Your password has been changed, please log in")
+}
+
+// ChangePasswordHandler lets the logged-in user change their password, or set one if they
+// only use linked accounts. Other sessions are signed out.
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	userID, username, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	hasPassword, err := models.HasPassword(userID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		renderChangePassword(w, r, userID, username, hasPassword, "")
+		return
+	}
+
+	if hasPassword {
+		correct, err := models.CheckPassword(userID, r.FormValue("current_password"))
+		if err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		if !correct {
+			renderChangePassword(w, r, userID, username, hasPassword, "Your current password is incorrect")
+			return
+		}
+	}
+
+	password := r.FormValue("password")
+	if password != r.FormValue("confirm_password") {
+		renderChangePassword(w, r, userID, username, hasPassword, "Passwords do not match")
+		return
+	}
+	email, err := models.GetEmailByID(userID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if err := models.ValidatePassword(password, username, email); err != nil {
+		renderChangePassword(w, r, userID, username, hasPassword, err.Error())
+		return
+	}
+
+	if err := models.ResetPassword(userID, password); err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if err := models.RevokeTokens(userID, models.TokenPasswordReset); err != nil {
+		log.Println("Error revoking reset tokens:", err)
+	}
+
+	// ResetPassword ended every session, so start a new one for this browser
+	sessionToken, err := models.CreateSession(userID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:    "session_token",
+		Value:   sessionToken,
+		Path:    "/",
+		Expires: time.Now().Add(24 * time.Hour),
+	})
+
+	http.Redirect(w, r, "/?notification=password_changed", http.StatusSeeOther)
+}
+
+func renderChangePassword(w http.ResponseWriter, r *http.Request, userID, username string, hasPassword bool, errorMessage string) {
+	tmpl, err := template.ParseFiles("templates/change_password.html")
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error loading template")
+		return
+	}
+
+	data := struct {
+		LoggedIn    bool
+		Username    string
+		Unread      int
+		HasPassword bool
+		MinLength   int
+		Error       string
+	}{
+		LoggedIn:    true,
+		Username:    username,
+		Unread:      unreadNotifications(userID),
+		HasPassword: hasPassword,
+		MinLength:   models.GetPasswordPolicy().MinLength,
+		Error:       errorMessage,
+	}
+
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		log.Println("Error executing template:", err)
+	}
+}
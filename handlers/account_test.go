@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"forum/models"
+)
+
+func TestResetPasswordHandler(t *testing.T) {
+	setupTestDB(t)
+	useTestWorkDir(t)
+
+	userID, _ := loginTestUser(t, "reader")
+	token, err := models.CreateToken(userID, models.TokenPasswordReset, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPassword := "a much longer passphrase"
+
+	// Rejected passwords keep the link usable; once used, it is spent
+	tests := []struct {
+		name              string
+		password, confirm string
+		want              string
+	}{
+		{"empty", "", "", "Please enter a new password"},
+		{"mismatch", newPassword, newPassword + "!", "Passwords do not match"},
+		{"valid", newPassword, newPassword, "Your password has been changed"},
+		{"reused link", newPassword, newPassword, "The reset link is invalid or has expired"},
+	}
+	for _, test := range tests {
+		form := url.Values{"token": {token}, "password": {test.password}, "confirm_password": {test.confirm}}
+		req := httptest.NewRequest(http.MethodPost, "/reset_password", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		ResetPasswordHandler(rr, req)
+		if !strings.Contains(rr.Body.String(), test.want) {
+			t.Errorf("%s: expected %q; got %s", test.name, test.want, rr.Body.String())
+		}
+	}
+	if correct, err := models.CheckPassword(userID, newPassword); err != nil || !correct {
+		t.Errorf("expected the new password set; got %v (%v)", correct, err)
+	}
+}
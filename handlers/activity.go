@@ -0,0 +1,70 @@
+package handlers
+
+// the logged-in user's activity timeline
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+
+	"forum/models"
+)
+
+const activityPageSize = 30
+
+// ActivityHandler shows everything the logged-in user posted, commented and reacted to, newest first.
+func ActivityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	userID, username, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	activities, hasMore, err := models.GetUserActivity(userID, page, activityPageSize)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching activity")
+		return
+	}
+
+	nextPage := 0
+	if hasMore {
+		nextPage = page + 1
+	}
+
+	tmpl, err := template.ParseFiles("templates/activity.html")
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error loading template")
+		return
+	}
+
+	data := struct {
+		LoggedIn   bool
+		Username   string
+		Unread     int
+		Activities []models.Activity
+		PrevPage   int // 0 when on the first page
+		NextPage   int // 0 when on the last page
+	}{
+		LoggedIn:   true,
+		Username:   username,
+		Unread:     unreadNotifications(userID),
+		Activities: activities,
+		PrevPage:   page - 1,
+		NextPage:   nextPage,
+	}
+
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		log.Println("Error executing template:", err)
+	}
+}
@@ -0,0 +1,284 @@
+package handlers
+
+// site administration
+import (
+	"database/sql"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+
+	"forum/models"
+)
+
+// requireRole renders an error and returns false unless the logged-in user has one of the roles.
+// Users whose role requires 2FA are sent to enable it first.
+func requireRole(w http.ResponseWriter, r *http.Request, roles ...string) (string, string, bool) {
+	userID, username, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return "", "", false
+	}
+
+	role, err := models.GetUserRole(userID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return "", "", false
+	}
+
+	allowed := false
+	for _, allowedRole := range roles {
+		if role == allowedRole {
+			allowed = true
+		}
+	}
+	if !allowed {
+		ErrorHandler(w, r, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+		return "", "", false
+	}
+
+	required, err := models.IsTwoFactorRequired(userID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return "", "", false
+	}
+	if required {
+		enabled, err := models.IsTwoFactorEnabled(userID)
+		if err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return "", "", false
+		}
+		if !enabled {
+			http.Redirect(w, r, "/two_factor?notification=required", http.StatusSeeOther)
+			return "", "", false
+		}
+	}
+
+	return userID, username, true
+}
+
+// AdminHandler shows the site settings page.
+func AdminHandler(w http.ResponseWriter, r *http.Request) {
+	userID, username, ok := requireRole(w, r, models.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	require2FA, err := models.GetBoolSetting(models.SettingRequire2FAPrivileged, false)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	archiveAfterDays, err := models.GetIntSetting(models.SettingArchiveAfterDays, 0)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	enabledReactions, err := models.EnabledReactionTypes()
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	enabled := make(map[string]bool)
+	for _, reactionType := range enabledReactions {
+		enabled[reactionType.Key] = true
+	}
+
+	categories, err := models.ListCategories(true)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching categories")
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/admin.html")
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error loading template")
+		return
+	}
+
+	data := struct {
+		LoggedIn         bool
+		Username         string
+		Unread           int
+		Require2FA       bool
+		ArchiveAfterDays int
+		ReactionTypes    []models.ReactionType
+		EnabledReactions map[string]bool
+		Categories       []models.Category
+		Notification     string
+	}{
+		LoggedIn:         true,
+		Username:         username,
+		Unread:           unreadNotifications(userID),
+		Require2FA:       require2FA,
+		ArchiveAfterDays: archiveAfterDays,
+		ReactionTypes:    models.EmojiReactionTypes,
+		EnabledReactions: enabled,
+		Categories:       categories,
+		Notification:     r.URL.Query().Get("notification"),
+	}
+
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		log.Println("Error executing template:", err)
+	}
+}
+
+// AdminSettingsHandler saves the site settings form.
+func AdminSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	if _, _, ok := requireRole(w, r, models.RoleAdmin); !ok {
+		return
+	}
+
+	// An empty period never archives, like 0
+	var archiveAfterDays int
+	if value := r.FormValue("archive_after_days"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			ErrorHandler(w, r, http.StatusBadRequest, "The archiving period must be a whole number of days")
+			return
+		}
+		archiveAfterDays = days
+	}
+
+	require2FA := r.FormValue("require_2fa_privileged") == "on"
+	err := models.SetSetting(models.SettingRequire2FAPrivileged, strconv.FormatBool(require2FA))
+	if err == nil {
+		err = models.SetSetting(models.SettingArchiveAfterDays, strconv.Itoa(archiveAfterDays))
+	}
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	http.Redirect(w, r, "/admin?notification=settings_saved", http.StatusSeeOther)
+}
+
+// AdminReactionsHandler saves which emoji reactions users can add.
+func AdminReactionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	if _, _, ok := requireRole(w, r, models.RoleAdmin); !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		ErrorHandler(w, r, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+	err := models.SetEnabledReactionTypes(r.PostForm["reaction"])
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	http.Redirect(w, r, "/admin?notification=settings_saved", http.StatusSeeOther)
+}
+
+// AdminCategoriesHandler lists the categories as JSON, or creates, edits, reorders, archives
+// or merges one. Forms are sent back to the admin page; scripts get the updated list.
+func AdminCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := requireRole(w, r, models.RoleAdmin); !ok {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		categories, err := models.ListCategories(true)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Error fetching categories"})
+			return
+		}
+		writeJSON(w, http.StatusOK, categories)
+		return
+	}
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	categoryID := r.FormValue("category_id")
+	var err error
+	switch r.FormValue("action") {
+	case "create":
+		_, err = models.CreateCategory(r.FormValue("name"), r.FormValue("description"))
+	case "update":
+		err = models.UpdateCategory(categoryID, r.FormValue("name"), r.FormValue("slug"), r.FormValue("description"), r.FormValue("parent_id"))
+	case "move":
+		err = models.MoveCategory(categoryID, r.FormValue("direction") == "up")
+	case "archive":
+		err = models.SetCategoryArchived(categoryID, r.FormValue("archived") == "on")
+	case "merge":
+		err = models.MergeCategories(categoryID, r.FormValue("target_id"))
+	default:
+		reactionError(w, r, http.StatusBadRequest, "Unknown action")
+		return
+	}
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		reactionError(w, r, http.StatusNotFound, "Category not found")
+		return
+	case models.ErrCategoryName:
+		reactionError(w, r, http.StatusBadRequest, "Category names must be between 1 and 50 characters")
+		return
+	case models.ErrCategoryExists:
+		reactionError(w, r, http.StatusBadRequest, "A category with this name already exists")
+		return
+	case models.ErrCategorySlugUsed:
+		reactionError(w, r, http.StatusBadRequest, "Another category already uses this slug")
+		return
+	case models.ErrMergeIntoItself:
+		reactionError(w, r, http.StatusBadRequest, "Choose another category to merge into")
+		return
+	case models.ErrCategoryCycle:
+		reactionError(w, r, http.StatusBadRequest, "A category cannot be placed under itself or its subcategories")
+		return
+	default:
+		reactionError(w, r, http.StatusInternalServerError, "Error saving category")
+		return
+	}
+
+	if !wantsJSON(r) {
+		http.Redirect(w, r, "/admin?notification=categories_saved", http.StatusSeeOther)
+		return
+	}
+	categories, err := models.ListCategories(true)
+	if err != nil {
+		reactionError(w, r, http.StatusInternalServerError, "Error fetching categories")
+		return
+	}
+	writeJSON(w, http.StatusOK, categories)
+}
+
+// AdminRolesHandler changes the role of a user.
+func AdminRolesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	if _, _, ok := requireRole(w, r, models.RoleAdmin); !ok {
+		return
+	}
+
+	err := models.SetUserRole(r.FormValue("username"), r.FormValue("role"))
+	if err == sql.ErrNoRows {
+		ErrorHandler(w, r, http.StatusNotFound, "User not found")
+		return
+	} else if err != nil {
+		ErrorHandler(w, r, http.StatusBadRequest, "Could not change the role")
+		return
+	}
+
+	http.Redirect(w, r, "/admin?notification=role_saved", http.StatusSeeOther)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"html/template"
+	"log"
 	"net/http"
 	"regexp"
 	"time"
@@ -11,6 +12,9 @@ import (
 
 var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
 
+// loginChallengeTTL is how long a user has to enter their 2FA code after the password.
+const loginChallengeTTL = 5 * time.Minute
+
 // authorization
 func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
@@ -24,6 +28,20 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// Check the username and password rules
+		if err := models.ValidateUsername(username); err != nil {
+			if policyErr, ok := err.(*models.PolicyError); ok {
+				renderRegister(w, policyErr.Message, email, username)
+				return
+			}
+			ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		if err := models.ValidatePassword(password, username, email); err != nil {
+			renderRegister(w, err.Error(), email, username)
+			return
+		}
+
 		// Check if the email is already in use
 		emailExists, err := models.CheckEmailExists(email)
 
@@ -33,8 +51,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		//if in use
 		if emailExists {
-			tmpl, _ := template.ParseFiles("templates/register.html")
-			tmpl.Execute(w, struct{ Error string }{Error: "Email is already registered"})
+			renderRegister(w, "Email is already registered", "", username)
 			return
 		}
 
@@ -45,8 +62,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if usernameExists {
-			tmpl, _ := template.ParseFiles("templates/register.html")
-			tmpl.Execute(w, struct{ Error string }{Error: "Username is already taken"})
+			renderRegister(w, "Username is already taken", email, "")
 			return
 		}
 
@@ -57,6 +73,16 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// Send the email verification link; posting stays disabled until it is opened
+		userID, _, err := models.GetIDBySessionToken(sessionToken)
+		if err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		if err := sendVerificationEmail(userID); err != nil {
+			log.Println("Error sending verification email:", err)
+		}
+
 		// Automatically log in the user after registration
 		cookie := http.Cookie{
 			Name:    "session_token",
@@ -66,12 +92,37 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		http.SetCookie(w, &cookie)
 
 		// Redirect to the main page after successful registration and login
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		http.Redirect(w, r, "/?notification=verify_email", http.StatusSeeOther)
 		return
 	}
 
-	tmpl, _ := template.ParseFiles("templates/register.html")
-	tmpl.Execute(w, nil)
+	renderRegister(w, "", "", "")
+}
+
+// renderRegister shows the registration form, keeping what the user already typed.
+func renderRegister(w http.ResponseWriter, errorMessage, email, username string) {
+	tmpl, err := template.ParseFiles("templates/register.html")
+	if err != nil {
+		http.Error(w, "Error loading template", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Error     string
+		Email     string
+		Username  string
+		MinLength int
+	}{
+		Error:     errorMessage,
+		Email:     email,
+		Username:  username,
+		MinLength: models.GetPasswordPolicy().MinLength,
+	}
+
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		log.Println("Error executing template:", err)
+	}
 }
 
 // LoginHandler - Handles user login
@@ -81,29 +132,167 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		password := r.FormValue("password")
 
 		// Authenticate the user
-		sessionToken, err := models.AuthenticateUser(email, password)
+		userID, err := models.VerifyCredentials(email, password, clientIP(r))
 		if err != nil {
-			tmpl, _ := template.ParseFiles("templates/login.html")
-			tmpl.Execute(w, struct{ Error string }{Error: "Invalid email or password"})
+			var message string
+			switch err {
+			case models.ErrInvalidCredentials:
+				message = "Invalid email or password"
+			case models.ErrLoginThrottled:
+				message = "Too many failed attempts, please wait a few seconds and try again"
+			case models.ErrAccountLocked:
+				message = "Account temporarily locked after too many failed attempts, try again later"
+			default:
+				ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+				return
+			}
+			renderLogin(w, message, "")
 			return
 		}
 
-		// Set session cookie
-		cookie := http.Cookie{
-			Name:    "session_token",
-			Value:   sessionToken,
-			Expires: time.Now().Add(24 * time.Hour),
-		}
-		http.SetCookie(w, &cookie)
-
-		// Redirect to the main page
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		beginLogin(w, r, userID)
 		return
 	}
 
 	// Render the login page
-	tmpl, _ := template.ParseFiles("templates/login.html")
-	tmpl.Execute(w, nil)
+	renderLogin(w, "", "")
+}
+
+// renderLogin shows the login form with an optional error or informational message.
+func renderLogin(w http.ResponseWriter, errorMessage, message string) {
+	tmpl, err := template.ParseFiles("templates/login.html")
+	if err != nil {
+		http.Error(w, "Error loading template", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Error     string
+		Message   string
+		Providers []oauthProviderLink
+	}{
+		Error:     errorMessage,
+		Message:   message,
+		Providers: oauthProviderLinks(),
+	}
+
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		log.Println("Error executing template:", err)
+	}
+}
+
+// beginLogin logs in a user whose password or external account was verified,
+// asking for the second factor first when they have 2FA enabled.
+func beginLogin(w http.ResponseWriter, r *http.Request, userID string) {
+	twoFactor, err := models.IsTwoFactorEnabled(userID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if !twoFactor {
+		completeLogin(w, r, userID)
+		return
+	}
+
+	challenge, err := models.CreateToken(userID, models.TokenLoginChallenge, loginChallengeTTL)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     "login_challenge",
+		Value:    challenge,
+		Path:     "/",
+		Expires:  time.Now().Add(loginChallengeTTL),
+		HttpOnly: true,
+	})
+	tmpl, err := template.ParseFiles("templates/login_2fa.html")
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error loading template")
+		return
+	}
+	if err := tmpl.Execute(w, nil); err != nil {
+		log.Println("Error executing template:", err)
+	}
+}
+
+// LoginTwoFactorHandler - Second login step for users with two-factor authentication
+func LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	cookie, err := r.Cookie("login_challenge")
+	if err != nil || cookie.Value == "" {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	// The challenge is single-use, so a wrong code means starting over with the password
+	http.SetCookie(w, &http.Cookie{Name: "login_challenge", Value: "", Path: "/", MaxAge: -1})
+	userID, err := models.ConsumeToken(cookie.Value, models.TokenLoginChallenge)
+	if err != nil {
+		renderLogin(w, "Your login attempt expired, please log in again", "")
+		return
+	}
+
+	ok, err := models.VerifySecondFactor(userID, r.FormValue("code"))
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if !ok {
+		renderLogin(w, "Invalid verification code, please log in again", "")
+		return
+	}
+
+	completeLogin(w, r, userID)
+}
+
+// completeLogin creates the session for an authenticated user and sends them on.
+// Privileged users who must use 2FA but have not enabled it are sent to set it up.
+func completeLogin(w http.ResponseWriter, r *http.Request, userID string) {
+	sessionToken, err := models.CreateSession(userID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	// Set session cookie; the path matters because the 2FA step is served from /login/two_factor
+	cookie := http.Cookie{
+		Name:    "session_token",
+		Value:   sessionToken,
+		Path:    "/",
+		Expires: time.Now().Add(24 * time.Hour),
+	}
+	http.SetCookie(w, &cookie)
+
+	required, err := models.IsTwoFactorRequired(userID)
+	if err == nil && required {
+		if enabled, err := models.IsTwoFactorEnabled(userID); err == nil && !enabled {
+			http.Redirect(w, r, "/two_factor?notification=required", http.StatusSeeOther)
+			return
+		}
+	}
+
+	// Redirect to the main page
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// currentUser returns the ID and username of the logged-in user, if any.
+func currentUser(r *http.Request) (string, string, bool) {
+	cookie, err := r.Cookie("session_token")
+	if err != nil || cookie.Value == "" {
+		return "", "", false
+	}
+
+	userID, username, err := models.GetIDBySessionToken(cookie.Value)
+	if err != nil {
+		return "", "", false
+	}
+	return userID, username, true
 }
 
 // LogoutHandler - Logs the user out by clearing the session cookie
@@ -0,0 +1,228 @@
+package handlers
+
+// private bookmarks and reading lists
+import (
+	"database/sql"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"forum/models"
+)
+
+const bookmarksPageSize = 20
+
+// BookmarksHandler lists the posts and comments saved in one of the viewer's lists, or in a list
+// another user has shared. Without a collection it shows the bookmarks saved outside any list.
+func BookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	userID, username, loggedIn := currentUser(r)
+	collectionID := r.URL.Query().Get("collection")
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	ownerID := userID
+	title := "Saved"
+	var collection *models.Collection
+	if collectionID != "" {
+		c, err := models.GetCollection(collectionID)
+		// Private lists are hidden from everyone but their owner
+		if err == sql.ErrNoRows || (err == nil && c.UserID != userID && !c.IsPublic) {
+			ErrorHandler(w, r, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+			return
+		} else if err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching list")
+			return
+		}
+		collection = &c
+		ownerID = c.UserID
+		title = c.Name
+		if c.UserID != userID {
+			title += " by " + c.Owner
+		}
+	} else if !loggedIn {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	posts, morePosts, err := models.GetBookmarkedPosts(ownerID, collectionID, page, bookmarksPageSize)
+	if err == nil {
+		err = models.LoadPostReactions(userID, posts)
+	}
+	if err == nil {
+		err = models.LoadPostAuthorReputations(posts)
+	}
+	if err == nil {
+		err = models.LoadPostBookmarks(userID, posts)
+	}
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching posts")
+		return
+	}
+
+	comments, moreComments, err := models.GetBookmarkedComments(ownerID, collectionID, page, bookmarksPageSize)
+	if err == nil {
+		err = models.LoadCommentAuthorReputations(comments)
+	}
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching comments")
+		return
+	}
+
+	var collections []models.Collection
+	if loggedIn {
+		collections, err = models.GetCollections(userID)
+		if err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching lists")
+			return
+		}
+	}
+
+	categories, err := models.GetAllCategories()
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching categories")
+		return
+	}
+
+	nextPage := 0
+	if morePosts || moreComments {
+		nextPage = page + 1
+	}
+
+	tmpl, err := template.ParseFiles("templates/posts.html")
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error loading template")
+		return
+	}
+
+	data := postsPage{
+		Title:          title,
+		Posts:          posts,
+		Comments:       comments,
+		Categories:     categories,
+		Collections:    collections,
+		Collection:     collection,
+		BookmarkList:   true,
+		CollectionID:   collectionID,
+		IsOwner:        loggedIn && ownerID == userID,
+		LoggedIn:       loggedIn,
+		Username:       username,
+		Unread:         unreadNotifications(userID),
+		RevealSpoilers: revealSpoilers(userID),
+		PrevPage:       page - 1,
+		NextPage:       nextPage,
+		PageURL:        "/bookmarks?collection=" + url.QueryEscape(collectionID) + "&page=",
+	}
+
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		log.Println("Error executing template:", err)
+	}
+}
+
+// bookmarkResponse is returned to fetch requests after a bookmark is toggled.
+type bookmarkResponse struct {
+	Bookmarked bool `json:"bookmarked"` // whether the item is now in the chosen list
+}
+
+// BookmarkHandler saves a post or comment to one of the user's lists, or removes it when it is already there.
+func BookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	userID, _, ok := currentUser(r)
+	if !ok {
+		reactionError(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+
+	targetType := r.FormValue("target_type")
+	targetID := r.FormValue("target_id")
+
+	postID, err := models.ReactionTargetPostID(targetType, targetID)
+	if err == sql.ErrNoRows {
+		reactionError(w, r, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	} else if err != nil {
+		reactionError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	bookmarked, err := models.ToggleBookmark(userID, r.FormValue("collection_id"), targetType, targetID)
+	if err == sql.ErrNoRows {
+		reactionError(w, r, http.StatusNotFound, "List not found")
+		return
+	} else if err != nil {
+		reactionError(w, r, http.StatusInternalServerError, "Error saving bookmark")
+		return
+	}
+
+	if !wantsJSON(r) {
+		http.Redirect(w, r, safeRedirectTarget(r, "/posts/"+url.PathEscape(postID)), http.StatusSeeOther)
+		return
+	}
+	writeJSON(w, http.StatusOK, bookmarkResponse{Bookmarked: bookmarked})
+}
+
+// CollectionsHandler creates, deletes and shares the user's reading lists.
+func CollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	userID, _, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	collectionID := r.FormValue("collection_id")
+	var err error
+	switch r.FormValue("action") {
+	case "create":
+		collectionID, err = models.CreateCollection(userID, r.FormValue("name"))
+		switch err {
+		case models.ErrCollectionName:
+			ErrorHandler(w, r, http.StatusBadRequest, "List names must be between 1 and 50 characters")
+			return
+		case models.ErrCollectionExists:
+			ErrorHandler(w, r, http.StatusBadRequest, "You already have a list with this name")
+			return
+		case models.ErrTooManyCollections:
+			ErrorHandler(w, r, http.StatusBadRequest, "You cannot create more than "+strconv.Itoa(models.MaxCollectionsPerUser)+" lists")
+			return
+		}
+	case "delete":
+		err = models.DeleteCollection(userID, collectionID)
+		collectionID = ""
+	case "share":
+		err = models.SetCollectionPublic(userID, collectionID, r.FormValue("public") == "on")
+	default:
+		ErrorHandler(w, r, http.StatusBadRequest, "Unknown action")
+		return
+	}
+	if err == sql.ErrNoRows {
+		ErrorHandler(w, r, http.StatusNotFound, "List not found")
+		return
+	} else if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error saving list")
+		return
+	}
+
+	target := "/bookmarks"
+	if collectionID != "" {
+		target += "?collection=" + url.QueryEscape(collectionID)
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
@@ -4,6 +4,7 @@ package handlers
 import (
 	"forum/models"
 	"net/http"
+	"net/url"
 )
 
 func CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
@@ -24,22 +25,36 @@ func CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
 		ErrorHandler(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
 		return
 	}
+
+	if !requireVerifiedEmail(w, r, userID) {
+		return
+	}
+
 	postID := r.FormValue("post_id")
 	content := r.FormValue("content")
 
+	// Locked and archived threads take no new comments
+	if !requireOpenPost(w, r, postID, true) {
+		return
+	}
+
 	content = models.SanitizeInput(content)
 	if !models.IsValidContent(content) {
 		ErrorHandler(w, r, http.StatusBadRequest, "Content is required to create a comment")
 		return
 	}
+	if models.ContainsLink(content) && !requirePrivilege(w, r, userID, models.PrivilegePostLinks) {
+		return
+	}
 
-	err = models.CreateComment(postID, userID, content)
+	commentID, err := models.CreateComment(postID, userID, content)
 	if err != nil {
 		ErrorHandler(w, r, http.StatusInternalServerError, "Error creating comment")
 		return
 	}
+	publishComment(commentID)
 
-	http.Redirect(w, r, "/post?id="+postID, http.StatusSeeOther)
+	http.Redirect(w, r, "/posts/"+url.PathEscape(postID), http.StatusSeeOther)
 }
 
 func LikeCommentHandler(w http.ResponseWriter, r *http.Request) {
@@ -51,37 +66,29 @@ func LikeCommentHandler(w http.ResponseWriter, r *http.Request) {
 	// Check if the user is logged in
 	cookie, err := r.Cookie("session_token")
 	if err != nil || cookie.Value == "" {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		reactionError(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
 		return
 	}
 
 	userID, _, err := models.GetIDBySessionToken(cookie.Value)
 	if err != nil {
-		ErrorHandler(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		reactionError(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
 		return
 	}
 	commentID := r.FormValue("comment_id")
-	postID := r.FormValue("post_id")
-
-	err = models.LikeComment(userID, commentID)
-	if err != nil {
-		// if err.Error() == "you have already liked this comment" {
-		// 	http.Redirect(w, r, "/post?id="+postID+"&notification=already_liked", http.StatusSeeOther)
-		// 	return
-		// }
-
-		http.Error(w, "Error liking comment", http.StatusInternalServerError)
+	if !requireOpenComment(w, r, commentID) {
 		return
 	}
 
-	// Update the post's like and dislike counts
-	err = models.UpdateCommentLikesDislikes(commentID)
+	err = models.LikeComment(userID, commentID)
 	if err != nil {
-		http.Error(w, "Error updating like count: "+err.Error(), http.StatusInternalServerError)
+		reactionError(w, r, http.StatusInternalServerError, "Error liking comment")
 		return
 	}
 
-	http.Redirect(w, r, "/post?id="+postID, http.StatusSeeOther)
+	publishCommentReactions(commentID)
+
+	respondCommentReaction(w, r, userID, commentID)
 }
 
 func DislikeCommentHandler(w http.ResponseWriter, r *http.Request) {
@@ -93,35 +100,27 @@ func DislikeCommentHandler(w http.ResponseWriter, r *http.Request) {
 	// Check if the user is logged in
 	cookie, err := r.Cookie("session_token")
 	if err != nil || cookie.Value == "" {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		reactionError(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
 		return
 	}
 
 	userID, _, err := models.GetIDBySessionToken(cookie.Value)
 	if err != nil {
-		ErrorHandler(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		reactionError(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
 		return
 	}
 	commentID := r.FormValue("comment_id")
-	postID := r.FormValue("post_id")
-
-	err = models.DislikeComment(userID, commentID)
-	if err != nil {
-		// if err.Error() == "you have already disliked this comment" {
-		// 	http.Redirect(w, r, "/post?id="+postID+"&notification=already_disliked", http.StatusSeeOther)
-		// 	return
-		// }
-
-		http.Error(w, "Error disliking comment", http.StatusInternalServerError)
+	if !requireOpenComment(w, r, commentID) {
 		return
 	}
 
-	// Update the post's like and dislike counts
-	err = models.UpdateCommentLikesDislikes(commentID)
+	err = models.DislikeComment(userID, commentID)
 	if err != nil {
-		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		reactionError(w, r, http.StatusInternalServerError, "Error disliking comment")
 		return
 	}
 
-	http.Redirect(w, r, "/post?id="+postID, http.StatusSeeOther)
+	publishCommentReactions(commentID)
+
+	respondCommentReaction(w, r, userID, commentID)
 }
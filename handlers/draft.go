@@ -0,0 +1,118 @@
+package handlers
+
+// autosaved post drafts
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"forum/models"
+)
+
+// draftSaved is the JSON answer to an autosave.
+type draftSaved struct {
+	ID      string `json:"id"`
+	SavedAt string `json:"saved_at"`
+}
+
+// SaveDraftHandler autosaves the create post form as a draft and returns the draft's ID as JSON.
+// The form sends the ID back with every later save, so each post has a single draft.
+func SaveDraftHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": http.StatusText(http.StatusMethodNotAllowed)})
+		return
+	}
+	userID, _, ok := currentUser(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	draft := models.Draft{
+		ID:          r.FormValue("draft_id"),
+		Title:       r.FormValue("title"),
+		Content:     r.FormValue("content"),
+		Tags:        r.FormValue("tags"),
+		CategoryIDs: r.Form["categories"],
+		SpoilerFor:  r.FormValue("spoiler_for"),
+	}
+	if strings.TrimSpace(draft.Title) == "" && strings.TrimSpace(draft.Content) == "" {
+		// Nothing worth keeping yet
+		writeJSON(w, http.StatusOK, draftSaved{ID: draft.ID})
+		return
+	}
+
+	id, err := models.SaveDraft(userID, draft)
+	if err == models.ErrDraftNotFound {
+		// The draft was deleted or published in another tab; keep the text in a new one
+		draft.ID = ""
+		id, err = models.SaveDraft(userID, draft)
+	}
+	if err == models.ErrTooManyDrafts {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "You have too many drafts; delete some to keep saving"})
+		return
+	} else if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Error saving the draft"})
+		return
+	}
+	writeJSON(w, http.StatusOK, draftSaved{ID: id, SavedAt: time.Now().Format("15:04")})
+}
+
+// DraftsHandler lists the drafts of the logged-in user.
+func DraftsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, username, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	drafts, err := models.GetDrafts(userID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching drafts")
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/drafts.html")
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error loading template")
+		return
+	}
+
+	data := struct {
+		LoggedIn bool
+		Username string
+		Unread   int
+		Drafts   []models.Draft
+	}{
+		LoggedIn: true,
+		Username: username,
+		Unread:   unreadNotifications(userID),
+		Drafts:   drafts,
+	}
+
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		log.Println("Error executing template:", err)
+	}
+}
+
+// DeleteDraftHandler deletes one of the logged-in user's drafts.
+func DeleteDraftHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+	userID, _, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := models.DeleteDraft(userID, r.FormValue("draft_id")); err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error deleting the draft")
+		return
+	}
+	http.Redirect(w, r, "/drafts", http.StatusSeeOther)
+}
@@ -1,4 +1,5 @@
 package handlers
+
 //error page
 import (
 	"fmt"
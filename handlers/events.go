@@ -0,0 +1,282 @@
+package handlers
+
+// live updates of post pages over server-sent events
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"forum/models"
+)
+
+// eventBufferSize is how many events a viewer may fall behind before it is disconnected.
+const eventBufferSize = 16
+
+// eventHeartbeatInterval keeps idle connections open through proxies and detects gone clients.
+const eventHeartbeatInterval = 25 * time.Second
+
+// liveEvent is a named server-sent event with its JSON-encoded data.
+type liveEvent struct {
+	Name string
+	Data []byte
+}
+
+// subscriber receives the events of one topic. Its channel is closed when it is removed from the hub.
+type subscriber struct {
+	events chan liveEvent
+}
+
+// eventHub fans events out to every subscriber of a topic. A subscriber whose buffer is
+// full is dropped instead of blocking the publisher, so one slow viewer cannot stall the others.
+type eventHub struct {
+	mu         sync.RWMutex
+	topics     map[string]map[*subscriber]struct{}
+	bufferSize int
+}
+
+func newEventHub(bufferSize int) *eventHub {
+	return &eventHub{
+		topics:     make(map[string]map[*subscriber]struct{}),
+		bufferSize: bufferSize,
+	}
+}
+
+// liveEvents is the hub shared by the post page and feed event handlers.
+var liveEvents = newEventHub(eventBufferSize)
+
+func (h *eventHub) subscribe(topic string) *subscriber {
+	s := &subscriber{events: make(chan liveEvent, h.bufferSize)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.topics[topic] == nil {
+		h.topics[topic] = make(map[*subscriber]struct{})
+	}
+	h.topics[topic][s] = struct{}{}
+	return s
+}
+
+// unsubscribe removes the subscriber and closes its channel; calling it twice is harmless.
+func (h *eventHub) unsubscribe(topic string, s *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subscribers, ok := h.topics[topic]
+	if !ok {
+		return
+	}
+	if _, ok := subscribers[s]; !ok {
+		return
+	}
+	delete(subscribers, s)
+	close(s.events)
+	if len(subscribers) == 0 {
+		delete(h.topics, topic)
+	}
+}
+
+// publish encodes the payload once and sends it to every subscriber of the topic.
+func (h *eventHub) publish(topic, name string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Println("Error encoding event:", err)
+		return
+	}
+	event := liveEvent{Name: name, Data: data}
+
+	var slow []*subscriber
+	h.mu.RLock()
+	for s := range h.topics[topic] {
+		select {
+		case s.events <- event:
+		default:
+			slow = append(slow, s)
+		}
+	}
+	h.mu.RUnlock()
+
+	// Slow viewers are disconnected rather than holding up the others; the browser reconnects on its own
+	for _, s := range slow {
+		h.unsubscribe(topic, s)
+	}
+}
+
+// subscribers returns how many subscribers a topic has.
+func (h *eventHub) subscribers(topic string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.topics[topic])
+}
+
+func postTopic(postID string) string {
+	return "post:" + postID
+}
+
+// pollsTopic carries the results of every poll, for feeds.
+const pollsTopic = "polls"
+
+// Payloads of the events sent to post pages
+type commentEvent struct {
+	ID               string `json:"id"`
+	Author           string `json:"author"`
+	AuthorReputation int    `json:"author_reputation"`
+	Content          string `json:"content"` // sanitized HTML, as rendered on the page
+	CreatedAt        string `json:"created_at"`
+}
+
+type reactionsEvent struct {
+	CommentID string `json:"comment_id,omitempty"` // empty for the post itself
+	Likes     int    `json:"likes"`
+	Dislikes  int    `json:"dislikes"`
+}
+
+type emojiReactionEvent struct {
+	CommentID string `json:"comment_id,omitempty"` // empty for the post itself
+	Type      string `json:"type"`
+	Count     int    `json:"count"`
+}
+
+// publishComment sends a new comment to everyone viewing its post.
+func publishComment(commentID string) {
+	comment, err := models.GetCommentByID(commentID)
+	if err == nil {
+		comments := []models.Comment{comment}
+		err = models.LoadCommentAuthorReputations(comments)
+		comment = comments[0]
+	}
+	if err != nil {
+		log.Println("Error loading comment for live update:", err)
+		return
+	}
+	liveEvents.publish(postTopic(comment.PostID), "comment", commentEvent{
+		ID:               comment.ID,
+		Author:           comment.Author,
+		AuthorReputation: comment.AuthorReputation,
+		Content:          string(comment.Content),
+		CreatedAt:        comment.CreatedAtFormatted,
+	})
+}
+
+// publishPostReactions sends the current like and dislike counts of a post.
+func publishPostReactions(postID string) {
+	post, err := models.GetPostByID(postID)
+	if err != nil {
+		log.Println("Error loading post for live update:", err)
+		return
+	}
+	liveEvents.publish(postTopic(post.ID), "reactions", reactionsEvent{Likes: post.Likes, Dislikes: post.Dislikes})
+}
+
+// publishCommentReactions sends the current like and dislike counts of a comment.
+func publishCommentReactions(commentID string) {
+	comment, err := models.GetCommentByID(commentID)
+	if err != nil {
+		log.Println("Error loading comment for live update:", err)
+		return
+	}
+	liveEvents.publish(postTopic(comment.PostID), "reactions", reactionsEvent{
+		CommentID: comment.ID,
+		Likes:     comment.Likes,
+		Dislikes:  comment.Dislikes,
+	})
+}
+
+// publishEmojiReaction sends the new count of one emoji reaction on a post or one of its comments.
+func publishEmojiReaction(postID, targetType, targetID, reaction string, count int) {
+	event := emojiReactionEvent{Type: reaction, Count: count}
+	if targetType == models.ReactionTargetComment {
+		event.CommentID = targetID
+	}
+	liveEvents.publish(postTopic(postID), "emoji_reaction", event)
+}
+
+// publishPoll sends the current results of a post's poll.
+func publishPoll(poll *models.Poll) {
+	results := newPollResults(poll)
+	liveEvents.publish(postTopic(poll.PostID), "poll", results)
+	liveEvents.publish(pollsTopic, "poll", results)
+}
+
+// PostEventsHandler streams new comments and reaction counts of a post as server-sent events.
+func PostEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	post, err := models.GetPostByID(r.URL.Query().Get("id"))
+	if err != nil {
+		ErrorHandler(w, r, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+	// Until a scheduled post is published, only its author can see it
+	if _, viewer, _ := currentUser(r); post.Scheduled && viewer != post.Author {
+		ErrorHandler(w, r, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	streamEvents(w, r, flusher, postTopic(post.ID))
+}
+
+// PollEventsHandler streams the results of every poll as server-sent events, for feeds that show
+// the polls of many posts. Post pages get the results of their own poll from PostEventsHandler.
+func PollEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	streamEvents(w, r, flusher, pollsTopic)
+}
+
+// streamEvents sends the events of a topic until the client goes away or falls behind.
+func streamEvents(w http.ResponseWriter, r *http.Request, flusher http.Flusher, topic string) {
+	sub := liveEvents.subscribe(topic)
+	defer liveEvents.unsubscribe(topic, sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	// Tell the browser how long to wait before reconnecting
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.events:
+			if !ok {
+				// Dropped for falling behind
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Name, event.Data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"forum/models"
+)
+
+func TestEventHubFanOut(t *testing.T) {
+	hub := newEventHub(4)
+
+	// Case 1: every subscriber of a topic receives the event, other topics do not
+	var subs []*subscriber
+	for i := 0; i < 3; i++ {
+		subs = append(subs, hub.subscribe("post:1"))
+	}
+	other := hub.subscribe("post:2")
+
+	hub.publish("post:1", "reactions", reactionsEvent{Likes: 2, Dislikes: 1})
+	for i, s := range subs {
+		event := <-s.events
+		if event.Name != "reactions" || string(event.Data) != `{"likes":2,"dislikes":1}` {
+			t.Errorf("subscriber %d: unexpected event %s %s", i, event.Name, event.Data)
+		}
+	}
+	if len(other.events) != 0 {
+		t.Errorf("expected no event on another topic")
+	}
+
+	// Case 2: unsubscribing closes the channel and removes empty topics
+	hub.unsubscribe("post:2", other)
+	hub.unsubscribe("post:2", other)
+	if _, ok := <-other.events; ok {
+		t.Errorf("expected the channel to be closed")
+	}
+	if hub.subscribers("post:2") != 0 {
+		t.Errorf("expected the topic to be removed")
+	}
+	if _, ok := hub.topics["post:2"]; ok {
+		t.Errorf("expected the empty topic to be deleted")
+	}
+}
+
+func TestEventHubDropsSlowSubscribers(t *testing.T) {
+	hub := newEventHub(2)
+	slow := hub.subscribe("post:1")
+	fast := hub.subscribe("post:1")
+
+	for i := 0; i < 3; i++ {
+		hub.publish("post:1", "comment", commentEvent{ID: fmt.Sprint(i)})
+		<-fast.events
+	}
+
+	// The slow subscriber got the buffered events and was then disconnected
+	received := 0
+	for range slow.events {
+		received++
+	}
+	if received != 2 {
+		t.Errorf("expected 2 buffered events; got %d", received)
+	}
+	if hub.subscribers("post:1") != 1 {
+		t.Errorf("expected only the fast subscriber to remain; got %d", hub.subscribers("post:1"))
+	}
+}
+
+func TestEventHubConcurrentUse(t *testing.T) {
+	hub := newEventHub(1)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s := hub.subscribe("post:1")
+			hub.unsubscribe("post:1", s)
+		}()
+		go func() {
+			defer wg.Done()
+			hub.publish("post:1", "reactions", reactionsEvent{})
+		}()
+	}
+	wg.Wait()
+	if hub.subscribers("post:1") != 0 {
+		t.Errorf("expected no subscribers left")
+	}
+}
+
+func TestPublishPollReachesPostAndFeeds(t *testing.T) {
+	post := liveEvents.subscribe(postTopic("1"))
+	defer liveEvents.unsubscribe(postTopic("1"), post)
+	feed := liveEvents.subscribe(pollsTopic)
+	defer liveEvents.unsubscribe(pollsTopic, feed)
+
+	publishPoll(&models.Poll{PostID: "1", Voters: 3})
+	for name, s := range map[string]*subscriber{"post page": post, "feed": feed} {
+		event := <-s.events
+		if event.Name != "poll" || !strings.Contains(string(event.Data), `"post_id":"1","voters":3`) {
+			t.Errorf("%s: unexpected event %s %s", name, event.Name, event.Data)
+		}
+	}
+}
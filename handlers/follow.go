@@ -0,0 +1,88 @@
+package handlers
+
+// following users and categories
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+
+	"forum/models"
+)
+
+// followingFeedPageSize is the number of posts per page of the Following feed.
+const followingFeedPageSize = 20
+
+// FollowHandler follows or unfollows the user named in the form, depending on action.
+func FollowHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	userID, _, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	username := r.FormValue("username")
+	profile, err := models.GetProfileByUsername(username)
+	if err == sql.ErrNoRows {
+		ErrorHandler(w, r, http.StatusNotFound, "User not found")
+		return
+	} else if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if r.FormValue("action") == "unfollow" {
+		err = models.UnfollowUser(userID, profile.UserID)
+	} else {
+		err = models.FollowUser(userID, profile.UserID)
+	}
+	if err == models.ErrFollowSelf {
+		ErrorHandler(w, r, http.StatusBadRequest, "You cannot follow yourself")
+		return
+	} else if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	http.Redirect(w, r, "/user/"+url.PathEscape(profile.Username), http.StatusSeeOther)
+}
+
+// FollowCategoryHandler follows or unfollows the category in the form, depending on action.
+func FollowCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	userID, _, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	categoryID := r.FormValue("category_id")
+	category, err := models.GetCategory(categoryID)
+	if err == sql.ErrNoRows {
+		ErrorHandler(w, r, http.StatusNotFound, "Category not found")
+		return
+	} else if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if r.FormValue("action") == "unfollow" {
+		err = models.UnfollowCategory(userID, categoryID)
+	} else {
+		err = models.FollowCategory(userID, categoryID)
+	}
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	http.Redirect(w, r, "/c/"+url.PathEscape(category.Slug), http.StatusSeeOther)
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"forum/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// setupTestDB creates the full schema in a temporary database and points the models at it.
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	testDB, err := models.OpenDB(filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { testDB.Close() })
+	models.CreateTables(testDB)
+	models.SetDB(testDB)
+	models.SetBcryptCost(bcrypt.MinCost)
+}
+
+// loginTestUser creates a verified user and returns their ID and session token.
+func loginTestUser(t *testing.T, username string) (string, string) {
+	t.Helper()
+	sessionToken, err := models.RegisterUser(username+"@example.com", username, "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, _, err := models.GetIDBySessionToken(sessionToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.MarkEmailVerified(userID); err != nil {
+		t.Fatal(err)
+	}
+	return userID, sessionToken
+}
+
+// useTestWorkDir runs the test in a temporary directory with the templates and an empty uploads
+// directory, so handlers render pages and save images as they do when the forum runs.
+func useTestWorkDir(t *testing.T) {
+	t.Helper()
+	templates, err := filepath.Abs("../templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Symlink(templates, filepath.Join(dir, "templates")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "uploads"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+}
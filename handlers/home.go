@@ -1,18 +1,69 @@
 package handlers
 
 import (
+	"database/sql"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"forum/models"
 )
 
 // MainPageHandler - Displays the main page with posts and user information if logged in
 func MainPageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		ErrorHandler(w, r, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	// Links from before slugs existed name the category by ID
+	if categoryID := r.URL.Query().Get("category"); categoryID != "" {
+		category, err := models.GetCategory(categoryID)
+		if err == sql.ErrNoRows {
+			ErrorHandler(w, r, http.StatusNotFound, "Category not found")
+			return
+		} else if err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching category")
+			return
+		}
+		// Sorting, filters and the page carry over to the category page
+		query := r.URL.Query()
+		query.Del("category")
+		target := "/c/" + url.PathEscape(category.Slug)
+		if len(query) > 0 {
+			target += "?" + query.Encode()
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+		return
+	}
+
+	renderHome(w, r, nil)
+}
+
+// CategoryPageHandler shows the posts of the category named by the slug in /c/<slug>.
+func CategoryPageHandler(w http.ResponseWriter, r *http.Request) {
+	category, err := models.GetCategoryBySlug(strings.TrimPrefix(r.URL.Path, "/c/"))
+	if err == sql.ErrNoRows {
+		ErrorHandler(w, r, http.StatusNotFound, "Category not found")
+		return
+	} else if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching category")
+		return
+	}
+	renderHome(w, r, &category)
+}
+
+// renderHome renders the main page, limited to a category when one is given.
+func renderHome(w http.ResponseWriter, r *http.Request, category *models.Category) {
 	var username string
 	loggedIn := false
 	var userID string
+	emailVerified := true
+	var role string
 
 	// Check if the user is logged in
 	cookie, err := r.Cookie("session_token")
@@ -23,19 +74,113 @@ func MainPageHandler(w http.ResponseWriter, r *http.Request) {
 		userID, username, err = models.GetIDBySessionToken(sessionToken)
 		if err == nil {
 			loggedIn = true // User is logged in
+			emailVerified, _ = models.IsEmailVerified(userID)
+			role, _ = models.GetUserRole(userID)
 		}
 	}
 
 	// Get filters from query parameters
-	categoryID := r.URL.Query().Get("category")
+	var categoryID string
+	if category != nil {
+		categoryID = category.ID
+	}
+	feed := r.URL.Query().Get("feed")
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
 
-	// Retrieve all posts
-	posts, err := models.GetFilteredPosts(loggedIn, userID, categoryID)
+	var posts []models.Post
+	var hasMore bool
+	var filterForm postFilterForm
+	if feed == "following" {
+		// The Following feed merges posts from followed users and categories
+		if !loggedIn {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		posts, hasMore, err = models.GetFollowingFeed(userID, page, followingFeedPageSize)
+	} else {
+		feed = ""
+		var filter models.PostFilter
+		filter, filterForm, err = parsePostFilter(r.URL.Query(), category)
+		if _, invalid := err.(filterError); invalid {
+			ErrorHandler(w, r, http.StatusBadRequest, err.Error())
+			return
+		} else if err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching categories")
+			return
+		}
+		posts, err = models.GetFilteredPosts(filter)
+		// Pinned posts head the unfiltered feed and category pages
+		if err == nil && !filterForm.Active {
+			var pinned []models.Post
+			pinned, err = models.GetPinnedPosts(categoryID)
+			posts = pinFirst(pinned, posts)
+		}
+	}
+	if err == nil {
+		err = models.LoadPostReactions(userID, posts)
+	}
+	if err == nil {
+		err = models.LoadPostAuthorReputations(posts)
+	}
+	if err == nil {
+		err = models.LoadPostBookmarks(userID, posts)
+	}
+	if err == nil {
+		err = models.LoadPostPolls(userID, posts)
+	}
 	if err != nil {
 		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching posts")
 		return
 	}
 
+	nextPage := 0
+	if hasMore {
+		nextPage = page + 1
+	}
+
+	followedCategories := map[string]bool{}
+	canUploadImages := false
+	var collections []models.Collection
+	var draft models.Draft
+	draftCategories := map[string]bool{}
+	if loggedIn {
+		// Continuing a draft fills the form with it
+		if draftID := r.URL.Query().Get("draft"); draftID != "" {
+			draft, err = models.GetDraft(userID, draftID)
+			if err == models.ErrDraftNotFound {
+				ErrorHandler(w, r, http.StatusNotFound, "Draft not found")
+				return
+			} else if err != nil {
+				ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching the draft")
+				return
+			}
+			for _, categoryID := range draft.CategoryIDs {
+				draftCategories[categoryID] = true
+			}
+		}
+
+		canUploadImages, err = models.HasPrivilege(userID, models.PrivilegeUploadImages)
+		if err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+
+		followedCategories, err = models.GetFollowedCategoryIDs(userID)
+		if err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching categories")
+			return
+		}
+
+		collections, err = models.GetCollections(userID)
+		if err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching lists")
+			return
+		}
+	}
+
 	// Retrieve all categories
 	categories, err := models.GetAllCategories()
 	if err != nil {
@@ -43,34 +188,77 @@ func MainPageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tagCloud, err := models.GetTagCloud(tagCloudSize)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching tags")
+		return
+	}
+
 	// Check if there is a notification query parameter
 	notification := r.URL.Query().Get("notification")
 
 	// Load the index.html template
-	tmpl, err := template.ParseFiles("templates/index.html")
+	tmpl, err := template.ParseFiles("templates/index.html", "templates/poll.html")
 	if err != nil {
 		ErrorHandler(w, r, http.StatusInternalServerError, "Error loading template")
 		return
 	}
-	if r.URL.Path != "/" {
-		ErrorHandler(w, r, http.StatusNotFound, http.StatusText(http.StatusNotFound))
-		return
-	}
-
 	data := struct {
-		Posts            []models.Post
-		Categories       []models.Category
-		LoggedIn         bool
-		Username         string
-		Notification     string
-		SelectedCategory string
+		Posts               []models.Post
+		Categories          []models.Category
+		LoggedIn            bool
+		Username            string
+		Unread              int
+		RevealSpoilers      bool
+		Notification        string
+		SelectedCategory    string
+		Category            *models.Category // the category being shown, if any
+		EmailVerified       bool
+		IsAdmin             bool
+		Feed                string
+		PrevPage            int // 0 when on the first page
+		NextPage            int // 0 when on the last page
+		FollowsCategory     bool
+		CanUploadImages     bool
+		ImageThreshold      int
+		Collections         []models.Collection
+		TagCloud            []models.Tag
+		MaxTags             int
+		MaxTitleLength      int
+		MaxSpoilerForLength int
+		MaxPollOptions      int
+		MaxPollQuestion     int
+		Draft               models.Draft // the draft being continued, if any
+		DraftCategories     map[string]bool
+		Filter              postFilterForm
 	}{
-		Posts:            posts,
-		Categories:       categories,
-		LoggedIn:         loggedIn,
-		Username:         username,
-		Notification:     notification,
-		SelectedCategory: categoryID,
+		Posts:               posts,
+		Categories:          categories,
+		LoggedIn:            loggedIn,
+		Username:            username,
+		Unread:              unreadNotifications(userID),
+		RevealSpoilers:      revealSpoilers(userID),
+		Notification:        notification,
+		SelectedCategory:    categoryID,
+		Category:            category,
+		EmailVerified:       emailVerified,
+		IsAdmin:             role == models.RoleAdmin,
+		Feed:                feed,
+		PrevPage:            page - 1,
+		NextPage:            nextPage,
+		FollowsCategory:     followedCategories[categoryID],
+		CanUploadImages:     canUploadImages,
+		ImageThreshold:      models.PrivilegeThreshold(models.PrivilegeUploadImages),
+		Collections:         collections,
+		TagCloud:            tagCloud,
+		MaxTags:             models.MaxTagsPerPost,
+		MaxTitleLength:      models.MaxPostTitleLength,
+		MaxSpoilerForLength: models.MaxSpoilerForLength,
+		MaxPollOptions:      models.MaxPollOptions,
+		MaxPollQuestion:     models.MaxPollQuestionLength,
+		Draft:               draft,
+		DraftCategories:     draftCategories,
+		Filter:              filterForm,
 	}
 
 	err = tmpl.Execute(w, data)
@@ -78,3 +266,106 @@ func MainPageHandler(w http.ResponseWriter, r *http.Request) {
 		log.Println("Error executing template:", err)
 	}
 }
+
+// postFilterForm holds the filter parameters of the main page as they were typed, to fill in the filter form again.
+type postFilterForm struct {
+	Categories map[string]bool // slugs of the chosen categories
+	MatchAll   bool
+	Author     string
+	From       string
+	To         string
+	HasImage   bool
+	MinLikes   string
+	Unanswered bool
+	Active     bool // whether any filter is set
+}
+
+// pinFirst puts the pinned posts before the others, leaving them out of the rest of the feed.
+func pinFirst(pinned, posts []models.Post) []models.Post {
+	if len(pinned) == 0 {
+		return posts
+	}
+	isPinned := make(map[string]bool)
+	for _, post := range pinned {
+		isPinned[post.ID] = true
+	}
+	for _, post := range posts {
+		if !isPinned[post.ID] {
+			pinned = append(pinned, post)
+		}
+	}
+	return pinned
+}
+
+// filterError describes a filter parameter that cannot be used.
+type filterError string
+
+func (e filterError) Error() string {
+	return string(e)
+}
+
+// filterDateLayout is the format of the from and to dates, as sent by date inputs.
+const filterDateLayout = "2006-01-02"
+
+// parsePostFilter reads the filters of the main page from the query: categories (slugs, repeatable),
+// match=all, author, from and to (inclusive dates), has_image, min_likes and unanswered.
+// On a category page the page's category replaces the categories of the query.
+func parsePostFilter(query url.Values, category *models.Category) (models.PostFilter, postFilterForm, error) {
+	var filter models.PostFilter
+	form := postFilterForm{
+		Categories: make(map[string]bool),
+		MatchAll:   query.Get("match") == "all",
+		Author:     strings.TrimSpace(query.Get("author")),
+		From:       query.Get("from"),
+		To:         query.Get("to"),
+		HasImage:   query.Get("has_image") != "",
+		MinLikes:   query.Get("min_likes"),
+		Unanswered: query.Get("unanswered") != "",
+	}
+
+	if category != nil {
+		filter.CategoryIDs = []string{category.ID}
+	} else {
+		for _, slug := range query["categories"] {
+			c, err := models.GetCategoryBySlug(slug)
+			if err == sql.ErrNoRows {
+				return filter, form, filterError("Unknown category " + slug)
+			} else if err != nil {
+				return filter, form, err
+			}
+			filter.CategoryIDs = append(filter.CategoryIDs, c.ID)
+			form.Categories[slug] = true
+		}
+		filter.MatchAll = form.MatchAll
+	}
+	filter.Author = form.Author
+	filter.HasImage = form.HasImage
+	filter.Unanswered = form.Unanswered
+
+	if form.From != "" {
+		from, err := time.ParseInLocation(filterDateLayout, form.From, time.Local)
+		if err != nil {
+			return filter, form, filterError("Dates must look like 2024-12-31")
+		}
+		filter.From = from
+	}
+	if form.To != "" {
+		to, err := time.ParseInLocation(filterDateLayout, form.To, time.Local)
+		if err != nil {
+			return filter, form, filterError("Dates must look like 2024-12-31")
+		}
+		// The whole last day is included
+		filter.Until = to.AddDate(0, 0, 1)
+	}
+	if form.MinLikes != "" {
+		minLikes, err := strconv.Atoi(form.MinLikes)
+		if err != nil || minLikes < 0 {
+			return filter, form, filterError("Minimum likes must be a whole number")
+		}
+		filter.MinLikes = minLikes
+	}
+
+	form.Active = len(form.Categories) > 0 || form.Author != "" || form.From != "" || form.To != "" ||
+		form.HasImage || form.MinLikes != "" || form.Unanswered
+	return filter, form, nil
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"forum/models"
+)
+
+func TestPinFirst(t *testing.T) {
+	pinned := []models.Post{{ID: "b", Pinned: true}}
+	posts := []models.Post{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+
+	got := pinFirst(pinned, posts)
+	var ids string
+	for _, post := range got {
+		ids += post.ID
+	}
+	if ids != "bac" || !got[0].Pinned {
+		t.Errorf("pinFirst = %q; want the pinned post first and not repeated", ids)
+	}
+	if got := pinFirst(nil, posts); len(got) != len(posts) {
+		t.Errorf("expected the feed unchanged without pinned posts; got %d posts", len(got))
+	}
+}
+
+func TestCategoryQueryRedirect(t *testing.T) {
+	setupTestDB(t)
+
+	categoryID, err := models.CreateCategory("Epic Fantasy", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Old links by category ID move to the category page and keep the rest of their query
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"category=" + categoryID, "/c/epic-fantasy"},
+		{"category=" + categoryID + "&sort=top&page=2", "/c/epic-fantasy?page=2&sort=top"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/?"+test.query, nil)
+		rr := httptest.NewRecorder()
+		MainPageHandler(rr, req)
+		if rr.Code != http.StatusMovedPermanently || rr.Header().Get("Location") != test.want {
+			t.Errorf("%s: expected a redirect to %s; got %d to %q", test.query, test.want, rr.Code, rr.Header().Get("Location"))
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package handlers
+
+// username autocomplete for @mentions
+import (
+	"net/http"
+
+	"forum/models"
+)
+
+const userSuggestionLimit = 8
+
+// UserSuggestionsHandler returns the usernames that start with the q parameter as JSON.
+func UserSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": http.StatusText(http.StatusMethodNotAllowed)})
+		return
+	}
+
+	usernames, err := models.SuggestUsernames(r.URL.Query().Get("q"), userSuggestionLimit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Error fetching users"})
+		return
+	}
+	if usernames == nil {
+		usernames = []string{}
+	}
+	writeJSON(w, http.StatusOK, usernames)
+}
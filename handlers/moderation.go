@@ -0,0 +1,90 @@
+package handlers
+
+// pinning, locking and archiving posts
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"time"
+
+	"forum/models"
+)
+
+// ModeratePostHandler lets moderators and admins pin a post at the top of the main feed or of
+// one of its categories, unpin it, lock it against new comments, unlock it or unarchive it.
+func ModeratePostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	if _, _, ok := requireRole(w, r, models.RoleModerator, models.RoleAdmin); !ok {
+		return
+	}
+
+	postID := r.FormValue("post_id")
+	if _, err := models.GetPostByID(postID); err == sql.ErrNoRows {
+		ErrorHandler(w, r, http.StatusNotFound, "Post not found")
+		return
+	} else if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching post")
+		return
+	}
+
+	var err error
+	switch r.FormValue("action") {
+	case "pin":
+		err = models.PinPost(postID, r.FormValue("category_id"))
+	case "unpin":
+		err = models.UnpinPost(postID, r.FormValue("category_id"))
+	case "lock":
+		err = models.SetPostLocked(postID, true)
+	case "unlock":
+		err = models.SetPostLocked(postID, false)
+	case "unarchive":
+		err = models.UnarchivePost(postID, time.Now())
+	default:
+		ErrorHandler(w, r, http.StatusBadRequest, "Unknown action")
+		return
+	}
+	if err == models.ErrNotInCategory {
+		ErrorHandler(w, r, http.StatusBadRequest, "The post is not in that category")
+		return
+	} else if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error moderating the post")
+		return
+	}
+
+	http.Redirect(w, r, safeRedirectTarget(r, "/posts/"+url.PathEscape(postID)), http.StatusSeeOther)
+}
+
+// requireOpenPost renders an error and returns false when the post is archived, or locked and
+// a comment is being added. Scripts get the error as JSON.
+func requireOpenPost(w http.ResponseWriter, r *http.Request, postID string, commenting bool) bool {
+	switch err := models.CheckPostOpen(postID, commenting); err {
+	case nil:
+		return true
+	case sql.ErrNoRows:
+		reactionError(w, r, http.StatusNotFound, "Post not found")
+	case models.ErrPostArchived:
+		reactionError(w, r, http.StatusForbidden, "This post is archived and can no longer be changed")
+	case models.ErrPostLocked:
+		reactionError(w, r, http.StatusForbidden, "This thread is locked; no new comments can be added")
+	default:
+		reactionError(w, r, http.StatusInternalServerError, "Error fetching post")
+	}
+	return false
+}
+
+// requireOpenComment is requireOpenPost for reactions to a comment.
+func requireOpenComment(w http.ResponseWriter, r *http.Request, commentID string) bool {
+	postID, err := models.ReactionTargetPostID(models.ReactionTargetComment, commentID)
+	if err == sql.ErrNoRows {
+		reactionError(w, r, http.StatusNotFound, "Comment not found")
+		return false
+	} else if err != nil {
+		reactionError(w, r, http.StatusInternalServerError, "Error fetching comment")
+		return false
+	}
+	return requireOpenPost(w, r, postID, false)
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"forum/models"
+)
+
+func TestCreateCommentOnClosedPost(t *testing.T) {
+	setupTestDB(t)
+
+	authorID, sessionToken := loginTestUser(t, "author")
+	openID, err := models.CreatePost(authorID, "", "Open", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockedID, err := models.CreatePost(authorID, "", "Locked", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.SetPostLocked(lockedID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		postID string
+		want   int
+	}{
+		{"open post", openID, http.StatusSeeOther},
+		{"locked post", lockedID, http.StatusForbidden},
+		{"missing post", "no-such-post", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		form := url.Values{"post_id": {test.postID}, "content": {"A late reply"}}
+		req := httptest.NewRequest(http.MethodPost, "/create_comment", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json")
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+		rr := httptest.NewRecorder()
+		CreateCommentHandler(rr, req)
+		if rr.Code != test.want {
+			t.Errorf("%s: expected status %d; got %d (%s)", test.name, test.want, rr.Code, rr.Body.String())
+		}
+	}
+
+	comments, err := models.GetCommentsForPost(lockedID)
+	if err != nil || len(comments) != 0 {
+		t.Errorf("expected no comments on the locked post; got %v (%v)", comments, err)
+	}
+}
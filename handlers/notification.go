@@ -0,0 +1,123 @@
+package handlers
+
+// in-app notifications
+import (
+	"html/template"
+	"log"
+	"net/http"
+
+	"forum/models"
+)
+
+// notificationsPageSize is how many notifications the notifications page lists.
+const notificationsPageSize = 50
+
+// unreadNotifications returns the count shown on the header bell; errors only hide the count.
+func unreadNotifications(userID string) int {
+	if userID == "" {
+		return 0
+	}
+	count, err := models.CountUnreadNotifications(userID)
+	if err != nil {
+		log.Println("Error counting notifications:", err)
+	}
+	return count
+}
+
+// NotificationsHandler lists the notifications of the logged-in user with their preferences.
+func NotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, username, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	notifications, err := models.GetNotifications(userID, notificationsPageSize)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	preferences, err := models.GetNotificationPreferences(userID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/notifications.html")
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error loading template")
+		return
+	}
+
+	data := struct {
+		LoggedIn      bool
+		Username      string
+		Unread        int
+		Notifications []models.Notification
+		Preferences   map[string]bool
+		Notification  string
+	}{
+		LoggedIn:      true,
+		Username:      username,
+		Unread:        unreadNotifications(userID),
+		Notifications: notifications,
+		Preferences:   preferences,
+		Notification:  r.URL.Query().Get("notification"),
+	}
+
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		log.Println("Error executing template:", err)
+	}
+}
+
+// MarkNotificationsReadHandler marks one notification, or all of them, as read.
+func MarkNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	userID, _, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	var err error
+	if id := r.FormValue("id"); id != "" {
+		err = models.MarkNotificationRead(userID, id)
+	} else {
+		err = models.MarkAllNotificationsRead(userID)
+	}
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+// NotificationPreferencesHandler saves which notification types the user wants.
+func NotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	userID, _, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	for _, notificationType := range models.NotificationTypes {
+		err := models.SetNotificationPreference(userID, notificationType, r.FormValue(notificationType) == "on")
+		if err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/notifications?notification=preferences_saved", http.StatusSeeOther)
+}
@@ -0,0 +1,333 @@
+package handlers
+
+// sign in with OpenID Connect providers
+import (
+	"database/sql"
+	"html/template"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"forum/models"
+	"forum/oidc"
+)
+
+// oauthFlowTTL is how long a user has to complete the sign in at the provider.
+const oauthFlowTTL = 10 * time.Minute
+
+var (
+	oauthProviders     = map[string]*oidc.Provider{}
+	oauthProviderOrder []string
+)
+
+// SetOAuthProviders configures the providers offered on the login page.
+func SetOAuthProviders(providers []*oidc.Provider) {
+	oauthProviders = map[string]*oidc.Provider{}
+	oauthProviderOrder = nil
+	for _, provider := range providers {
+		oauthProviders[provider.Name] = provider
+		oauthProviderOrder = append(oauthProviderOrder, provider.Name)
+	}
+}
+
+type oauthProviderLink struct {
+	Name        string
+	DisplayName string
+}
+
+// oauthProviderLinks lists the configured providers for "Sign in with" buttons.
+func oauthProviderLinks() []oauthProviderLink {
+	links := make([]oauthProviderLink, 0, len(oauthProviderOrder))
+	for _, name := range oauthProviderOrder {
+		links = append(links, oauthProviderLink{Name: name, DisplayName: oauthProviders[name].DisplayName})
+	}
+	return links
+}
+
+// oauthFlow is what the callback needs to finish a sign in started by OAuthLoginHandler.
+type oauthFlow struct {
+	provider   string
+	verifier   string
+	nonce      string
+	linkUserID string // set when a logged-in user is linking an account instead of signing in
+	expires    time.Time
+}
+
+var (
+	oauthFlowsMu sync.Mutex
+	oauthFlows   = map[string]oauthFlow{}
+)
+
+func saveOAuthFlow(state string, flow oauthFlow) {
+	oauthFlowsMu.Lock()
+	defer oauthFlowsMu.Unlock()
+
+	now := time.Now()
+	for key, existing := range oauthFlows {
+		if now.After(existing.expires) {
+			delete(oauthFlows, key)
+		}
+	}
+	oauthFlows[state] = flow
+}
+
+// takeOAuthFlow removes and returns the flow for a state, so each state can be used once.
+func takeOAuthFlow(state string) (oauthFlow, bool) {
+	oauthFlowsMu.Lock()
+	defer oauthFlowsMu.Unlock()
+
+	flow, ok := oauthFlows[state]
+	delete(oauthFlows, state)
+	if !ok || time.Now().After(flow.expires) {
+		return oauthFlow{}, false
+	}
+	return flow, true
+}
+
+// OAuthLoginHandler sends the user to the provider's sign in page.
+// A POST with link=1 from a logged-in user links the provider account instead.
+func OAuthLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := oauthProviders[r.FormValue("provider")]
+	if !ok {
+		ErrorHandler(w, r, http.StatusNotFound, "Unknown login provider")
+		return
+	}
+
+	var linkUserID string
+	if r.FormValue("link") == "1" {
+		if r.Method != http.MethodPost {
+			ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+			return
+		}
+		userID, _, ok := currentUser(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		linkUserID = userID
+	}
+
+	state, err1 := oidc.RandomString()
+	nonce, err2 := oidc.RandomString()
+	verifier, err3 := oidc.RandomString()
+	if err1 != nil || err2 != nil || err3 != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	authURL, err := provider.AuthURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Println("Error contacting login provider:", err)
+		ErrorHandler(w, r, http.StatusBadGateway, "The login provider is not available right now")
+		return
+	}
+
+	saveOAuthFlow(state, oauthFlow{
+		provider:   provider.Name,
+		verifier:   verifier,
+		nonce:      nonce,
+		linkUserID: linkUserID,
+		expires:    time.Now().Add(oauthFlowTTL),
+	})
+
+	// Binding the state to this browser stops another site from finishing a sign in for it.
+	http.SetCookie(w, &http.Cookie{
+		Name:     "oauth_state",
+		Value:    state,
+		Path:     "/oauth/",
+		Expires:  time.Now().Add(oauthFlowTTL),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OAuthCallbackHandler finishes the sign in when the provider sends the user back.
+func OAuthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	cookie, err := r.Cookie("oauth_state")
+	http.SetCookie(w, &http.Cookie{Name: "oauth_state", Value: "", Path: "/oauth/", MaxAge: -1})
+	if err != nil || state == "" || cookie.Value != state {
+		renderLogin(w, "Your sign in attempt expired, please try again", "")
+		return
+	}
+
+	flow, ok := takeOAuthFlow(state)
+	if !ok {
+		renderLogin(w, "Your sign in attempt expired, please try again", "")
+		return
+	}
+	if r.URL.Query().Get("error") != "" {
+		renderLogin(w, "Sign in was cancelled", "")
+		return
+	}
+
+	provider := oauthProviders[flow.provider]
+	claims, err := provider.Exchange(r.Context(), r.URL.Query().Get("code"), flow.verifier, flow.nonce)
+	if err != nil {
+		log.Println("Error completing external sign in:", err)
+		renderLogin(w, "Could not sign in with "+provider.DisplayName, "")
+		return
+	}
+
+	userID, err := models.GetUserIDByIdentity(provider.Name, claims.Subject)
+	if err != nil && err != sql.ErrNoRows {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	// Linking an external account to the logged-in user
+	if flow.linkUserID != "" {
+		if userID != "" && userID != flow.linkUserID {
+			ErrorHandler(w, r, http.StatusConflict, "This "+provider.DisplayName+" account is already linked to another user")
+			return
+		}
+		if userID == "" {
+			if err := models.LinkIdentity(flow.linkUserID, provider.Name, claims.Subject, claims.Email); err != nil {
+				ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+				return
+			}
+		}
+		http.Redirect(w, r, "/linked_accounts?notification=linked", http.StatusSeeOther)
+		return
+	}
+
+	// Returning user
+	if userID != "" {
+		beginLogin(w, r, userID)
+		return
+	}
+
+	// First sign in: never attach to an existing account by email alone, since that would let
+	// anyone controlling the address at the provider take over the forum account.
+	if claims.Email == "" {
+		renderLogin(w, provider.DisplayName+" did not share an email address, which is needed to create an account", "")
+		return
+	}
+	emailExists, err := models.CheckEmailExists(claims.Email)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if emailExists {
+		renderLogin(w, "An account with this email already exists. Log in with your password, then link "+provider.DisplayName+" from the linked accounts page.", "")
+		return
+	}
+
+	username, err := models.AvailableUsername(claims.PreferredUsername, claims.Name, claims.Email)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	userID, err = models.RegisterExternalUser(claims.Email, username, claims.EmailVerified)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if err := models.LinkIdentity(userID, provider.Name, claims.Subject, claims.Email); err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if !claims.EmailVerified {
+		if err := sendVerificationEmail(userID); err != nil {
+			log.Println("Error sending verification email:", err)
+		}
+	}
+
+	completeLogin(w, r, userID)
+}
+
+// LinkedAccountsHandler lists the external accounts of the logged-in user with link and unlink buttons.
+func LinkedAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, username, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	identities, err := models.GetIdentitiesForUser(userID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	type providerRow struct {
+		Name        string
+		DisplayName string
+		Linked      bool
+		Email       string
+	}
+	var rows []providerRow
+	for _, link := range oauthProviderLinks() {
+		row := providerRow{Name: link.Name, DisplayName: link.DisplayName}
+		for _, identity := range identities {
+			if identity.Provider == link.Name {
+				row.Linked = true
+				row.Email = identity.Email
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	tmpl, err := template.ParseFiles("templates/linked_accounts.html")
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error loading template")
+		return
+	}
+
+	data := struct {
+		LoggedIn     bool
+		Username     string
+		Unread       int
+		Providers    []providerRow
+		Notification string
+	}{
+		LoggedIn:     true,
+		Username:     username,
+		Unread:       unreadNotifications(userID),
+		Providers:    rows,
+		Notification: r.URL.Query().Get("notification"),
+	}
+
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		log.Println("Error executing template:", err)
+	}
+}
+
+// UnlinkAccountHandler removes a linked external account, as long as the user keeps another way to log in.
+func UnlinkAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	userID, _, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	hasPassword, err := models.HasPassword(userID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	identities, err := models.GetIdentitiesForUser(userID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if !hasPassword && len(identities) <= 1 {
+		ErrorHandler(w, r, http.StatusBadRequest, "Set a password with \"Forgot your password?\" before removing your only login method")
+		return
+	}
+
+	if err := models.UnlinkIdentity(userID, r.FormValue("provider")); err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	http.Redirect(w, r, "/linked_accounts?notification=unlinked", http.StatusSeeOther)
+}
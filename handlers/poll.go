@@ -0,0 +1,88 @@
+package handlers
+
+// voting in polls
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+
+	"forum/models"
+)
+
+// pollResults is the JSON form of a poll's results, sent to the voter and to everyone viewing the post.
+type pollResults struct {
+	PostID  string              `json:"post_id"`
+	Voters  int                 `json:"voters"`
+	Options []pollOptionResults `json:"options"`
+}
+
+type pollOptionResults struct {
+	ID      string   `json:"id"`
+	Votes   int      `json:"votes"`
+	Percent int      `json:"percent"`
+	Voters  []string `json:"voters,omitempty"` // empty for anonymous polls
+}
+
+func newPollResults(poll *models.Poll) pollResults {
+	results := pollResults{PostID: poll.PostID, Voters: poll.Voters}
+	for _, option := range poll.Options {
+		results.Options = append(results.Options, pollOptionResults{
+			ID:      option.ID,
+			Votes:   option.Votes,
+			Percent: option.Percent,
+			Voters:  option.Voters,
+		})
+	}
+	return results
+}
+
+// VoteHandler records the logged-in user's vote in the poll of a post. Scripts get the new
+// results as JSON; forms are redirected back to the page they were sent from.
+func VoteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+	userID, _, ok := currentUser(r)
+	if !ok {
+		reactionError(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+
+	postID := r.FormValue("post_id")
+	if !requireOpenPost(w, r, postID, false) {
+		return
+	}
+	err := models.Vote(postID, userID, r.Form["option"])
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		reactionError(w, r, http.StatusNotFound, "Poll not found")
+		return
+	case models.ErrPollClosed:
+		reactionError(w, r, http.StatusConflict, "The poll is closed")
+		return
+	case models.ErrAlreadyVoted:
+		reactionError(w, r, http.StatusConflict, "You have already voted in this poll")
+		return
+	case models.ErrInvalidChoice:
+		reactionError(w, r, http.StatusBadRequest, "Please choose from the poll's options")
+		return
+	default:
+		reactionError(w, r, http.StatusInternalServerError, "Error saving the vote")
+		return
+	}
+
+	poll, err := models.GetPoll(postID, userID)
+	if err != nil || poll == nil {
+		reactionError(w, r, http.StatusInternalServerError, "Error fetching the poll")
+		return
+	}
+	publishPoll(poll)
+
+	if !wantsJSON(r) {
+		http.Redirect(w, r, safeRedirectTarget(r, "/posts/"+url.PathEscape(postID)), http.StatusSeeOther)
+		return
+	}
+	writeJSON(w, http.StatusOK, newPollResults(poll))
+}
@@ -2,8 +2,14 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"html/template"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"forum/models"
 )
@@ -28,19 +34,94 @@ func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !requireVerifiedEmail(w, r, userID) {
+		return
+	}
+
+	title := r.FormValue("title")
 	content := r.FormValue("content")
 	categories := r.Form["categories"]
 
+	// Titles are stored as typed; templates escape them
+	title = strings.TrimSpace(title)
 	content = models.SanitizeInput(content)
 	if !models.IsValidContent(content) || len(categories) == 0 {
 		ErrorHandler(w, r, http.StatusBadRequest, "Content and at least one category are required to create a post")
 		return
 	}
+	if !models.IsValidTitle(title) {
+		ErrorHandler(w, r, http.StatusBadRequest, fmt.Sprintf("Please give the post a title of at most %d characters", models.MaxPostTitleLength))
+		return
+	}
+	// Archived categories take no new posts
+	for _, categoryID := range categories {
+		category, err := models.GetCategory(categoryID)
+		if err == sql.ErrNoRows || (err == nil && category.Archived) {
+			ErrorHandler(w, r, http.StatusBadRequest, "Please choose categories from the list")
+			return
+		} else if err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching categories")
+			return
+		}
+	}
+	tags, err := models.ParseTags(r.FormValue("tags"))
+	if err == nil {
+		tags = models.AddHashtags(tags, content)
+	}
+	if err == models.ErrTooManyTags {
+		ErrorHandler(w, r, http.StatusBadRequest, fmt.Sprintf("A post can have at most %d tags", models.MaxTagsPerPost))
+		return
+	} else if err == models.ErrTagTooLong {
+		ErrorHandler(w, r, http.StatusBadRequest, fmt.Sprintf("Tags can be at most %d characters long", models.MaxTagLength))
+		return
+	}
+	spoilerFor := r.FormValue("spoiler_for")
+	if !models.IsValidSpoilerFor(spoilerFor) {
+		ErrorHandler(w, r, http.StatusBadRequest, fmt.Sprintf("The book in a spoiler warning can be at most %d characters long", models.MaxSpoilerForLength))
+		return
+	}
+	publishAt, err := parsePublishAt(r.FormValue("publish_at"), r.FormValue("publish_offset"), time.Now())
+	if err != nil {
+		ErrorHandler(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	// A poll is added when its question or options are filled in
+	pollQuestion := r.FormValue("poll_question")
+	pollOptions := models.ParsePollOptions(r.FormValue("poll_options"))
+	hasPoll := strings.TrimSpace(pollQuestion) != "" || len(pollOptions) > 0
+	var pollClosesAt time.Time
+	if hasPoll {
+		switch models.ValidatePoll(pollQuestion, pollOptions) {
+		case models.ErrPollQuestion:
+			ErrorHandler(w, r, http.StatusBadRequest, fmt.Sprintf("Please give the poll a question of at most %d characters", models.MaxPollQuestionLength))
+			return
+		case models.ErrPollOptions:
+			ErrorHandler(w, r, http.StatusBadRequest, fmt.Sprintf("A poll needs %d to %d different options, one per line", models.MinPollOptions, models.MaxPollOptions))
+			return
+		case models.ErrPollOption:
+			ErrorHandler(w, r, http.StatusBadRequest, fmt.Sprintf("Poll options can be at most %d characters long", models.MaxPollOptionLength))
+			return
+		}
+		if value := r.FormValue("poll_closes_at"); value != "" {
+			pollClosesAt, err = parseLocalTime(value, r.FormValue("publish_offset"))
+			if err != nil || !pollClosesAt.After(time.Now()) {
+				ErrorHandler(w, r, http.StatusBadRequest, "Please choose a closing time for the poll in the future")
+				return
+			}
+		}
+	}
+	if models.ContainsLink(content) && !requirePrivilege(w, r, userID, models.PrivilegePostLinks) {
+		return
+	}
 
 	var imagePath string
 	if file, header, err := r.FormFile("image"); err == nil {
 		defer file.Close()
 
+		if !requirePrivilege(w, r, userID, models.PrivilegeUploadImages) {
+			return
+		}
+
 		// Validate the image
 		if err := validateImage(file, header); err != nil {
 			ErrorHandler(w, r, http.StatusBadRequest, err.Error())
@@ -55,23 +136,75 @@ func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	postID, err := models.CreatePost(userID, content, imagePath)
-	if err != nil {
+	post := models.NewPost{
+		Title:       title,
+		Content:     content,
+		ImagePath:   imagePath,
+		CategoryIDs: categories,
+		Tags:        tags,
+		SpoilerFor:  spoilerFor,
+		PublishAt:   publishAt,
+	}
+	if hasPoll {
+		post.Poll = &models.NewPoll{
+			Question:  pollQuestion,
+			Options:   pollOptions,
+			Multiple:  r.FormValue("poll_multiple") == "on",
+			Anonymous: r.FormValue("poll_anonymous") == "on",
+			ClosesAt:  pollClosesAt,
+		}
+	}
+	if _, err := models.CreateFullPost(userID, post); err != nil {
 		ErrorHandler(w, r, http.StatusInternalServerError, "Error creating post")
 		return
 	}
-
-	for _, categoryID := range categories {
-		err = models.AddCategoryToPost(postID, categoryID)
-		if err != nil {
-			ErrorHandler(w, r, http.StatusInternalServerError, "Error associating category")
-			return
+	if draftID := r.FormValue("draft_id"); draftID != "" {
+		if err := models.DeleteDraft(userID, draftID); err != nil {
+			log.Println("Error deleting a published draft:", err)
 		}
 	}
 
+	if !publishAt.IsZero() {
+		http.Redirect(w, r, "/my_posts", http.StatusSeeOther)
+		return
+	}
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+// maxScheduleAhead is how far in the future a post can be scheduled.
+const maxScheduleAhead = 365 * 24 * time.Hour
+
+// parseLocalTime reads a datetime-local input. The input has no time zone, so the form also sends
+// the browser's offset from UTC in minutes, as JavaScript's getTimezoneOffset gives it; without one
+// the server's time zone is assumed.
+func parseLocalTime(value, offset string) (time.Time, error) {
+	const layout = "2006-01-02T15:04"
+	minutes, err := strconv.Atoi(offset)
+	if err != nil {
+		return time.ParseInLocation(layout, value, time.Local)
+	}
+	t, err := time.Parse(layout, value)
+	return t.Add(time.Duration(minutes) * time.Minute), err
+}
+
+// parsePublishAt reads the time a post is scheduled for. An empty value means now.
+func parsePublishAt(value, offset string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	publishAt, err := parseLocalTime(value, offset)
+	if err != nil {
+		return time.Time{}, errors.New("Please enter the publishing time as a date and time")
+	}
+	if !publishAt.After(now) {
+		return time.Time{}, errors.New("Please choose a publishing time in the future")
+	}
+	if publishAt.Sub(now) > maxScheduleAhead {
+		return time.Time{}, errors.New("Posts can be scheduled at most a year ahead")
+	}
+	return publishAt, nil
+}
+
 // Handler for liking a post
 func LikeHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -82,49 +215,31 @@ func LikeHandler(w http.ResponseWriter, r *http.Request) {
 	// Check if the user is logged in
 	cookie, err := r.Cookie("session_token")
 	if err != nil || cookie.Value == "" {
-		ErrorHandler(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		reactionError(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
 		return
 	}
 
 	userID, _, err := models.GetIDBySessionToken(cookie.Value)
 	if err != nil {
-		ErrorHandler(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		reactionError(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
 		return
 	}
 	postID := r.FormValue("post_id")
+	if !requireOpenPost(w, r, postID, false) {
+		return
+	}
 
 	// Like the post
 	err = models.LikePost(userID, postID)
 	if err != nil {
-		// if err.Error() == "you have already liked this post" {
-		// 	// Redirect back to the main page with a notification
-		// 	http.Redirect(w, r, "/?notification=already_liked", http.StatusSeeOther)
-		// 	return
-		// }
-
-		http.Error(w, "Error liking post: "+err.Error(), http.StatusInternalServerError)
-		ErrorHandler(w, r, http.StatusInternalServerError, "Error liking post")
+		reactionError(w, r, http.StatusInternalServerError, "Error liking post")
 		return
 	}
 
-	// Update the post's like and dislike counts
-	err = models.UpdatePostLikesDislikes(postID)
-	if err != nil {
-		ErrorHandler(w, r, http.StatusInternalServerError, "Error updating like count")
-		return
-	}
+	publishPostReactions(postID)
 
-	// Redirect back to the main page
-	// http.Redirect(w, r, "/", http.StatusSeeOther)
-	referer := r.Header.Get("Referer")
-	http.Redirect(w, r, referer, http.StatusSeeOther)
-	// if strings.Contains(referer, "/post") {
-	// 	// If the referer is a post page, redirect back to that page
-	// 	http.Redirect(w, r, referer, http.StatusSeeOther)
-	// } else {
-	// 	// Otherwise, redirect to the homepage
-	// 	http.Redirect(w, r, "/", http.StatusSeeOther)
-	// }
+	// Answer the script with the new counts, or send the form back to the page it came from
+	respondPostReaction(w, r, userID, postID)
 }
 
 // Handler for disliking a post
@@ -137,42 +252,83 @@ func DislikeHandler(w http.ResponseWriter, r *http.Request) {
 	// Check if the user is logged in
 	cookie, err := r.Cookie("session_token")
 	if err != nil || cookie.Value == "" {
-		ErrorHandler(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		reactionError(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
 		return
 	}
 
 	userID, _, err := models.GetIDBySessionToken(cookie.Value)
 	if err != nil {
-		ErrorHandler(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		reactionError(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
 		return
 	}
 	postID := r.FormValue("post_id")
+	if !requireOpenPost(w, r, postID, false) {
+		return
+	}
 
 	// Dislike the post
 	err = models.DislikePost(userID, postID)
 	if err != nil {
-		// if err.Error() == "you have already disliked this post" {
-		// 	// Redirect back to the main page with a notification
-		// 	http.Redirect(w, r, "/?notification=already_disliked", http.StatusSeeOther)
-		// 	return
-		// }
-		ErrorHandler(w, r, http.StatusInternalServerError, "Error disliking post")
+		reactionError(w, r, http.StatusInternalServerError, "Error disliking post")
 		return
 	}
 
-	// Update the post's like and dislike counts
-	err = models.UpdatePostLikesDislikes(postID)
-	if err != nil {
-		ErrorHandler(w, r, http.StatusInternalServerError, "Error updating dislike count")
+	publishPostReactions(postID)
+
+	respondPostReaction(w, r, userID, postID)
+}
+
+// previewResponse is the rendered Markdown returned by PreviewHandler.
+type previewResponse struct {
+	HTML string `json:"html"`
+}
+
+// PreviewHandler renders the Markdown of a post or comment being written, as it will be published.
+func PreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": http.StatusText(http.StatusMethodNotAllowed)})
+		return
+	}
+	if _, _, ok := currentUser(r); !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": http.StatusText(http.StatusUnauthorized)})
+		return
+	}
+
+	content := models.SanitizeInput(r.FormValue("content"))
+	writeJSON(w, http.StatusOK, previewResponse{HTML: string(models.RenderContent(content))})
+}
+
+// LegacyPostHandler permanently redirects the old /post?id=<id> links to the post's page.
+func LegacyPostHandler(w http.ResponseWriter, r *http.Request) {
+	post, err := models.GetPostByID(r.URL.Query().Get("id"))
+	if err == sql.ErrNoRows {
+		ErrorHandler(w, r, http.StatusNotFound, "Post not found")
+		return
+	} else if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching post")
+		return
+	}
+	// The redirect would give away the title of a scheduled post
+	if _, viewer, _ := currentUser(r); post.Scheduled && viewer != post.Author {
+		ErrorHandler(w, r, http.StatusNotFound, "Post not found")
 		return
 	}
+	query := r.URL.Query()
+	query.Del("id")
+	r.URL.RawQuery = query.Encode()
+	redirectToPost(w, r, post)
+}
 
-	// Redirect back to the main page
-	// http.Redirect(w, r, "/", http.StatusSeeOther)
-	referer := r.Header.Get("Referer")
-	http.Redirect(w, r, referer, http.StatusSeeOther)
+// redirectToPost permanently redirects to the canonical URL of the post, keeping the query string.
+func redirectToPost(w http.ResponseWriter, r *http.Request, post models.Post) {
+	target := post.URL()
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
 }
 
+// PostPageHandler shows a post and its comments at /posts/<id>/<slug>.
 func PostPageHandler(w http.ResponseWriter, r *http.Request) {
 	// Ensure we're handling a GET request
 	if r.Method != http.MethodGet {
@@ -180,8 +336,8 @@ func PostPageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get the post ID from the query string
-	postID := r.URL.Query().Get("id")
+	// The path is /posts/<id>/<slug>; only the ID is needed to find the post
+	postID := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/posts/"), "/", 2)[0]
 	if postID == "" {
 		ErrorHandler(w, r, http.StatusBadRequest, "Missing post ID")
 		return
@@ -197,6 +353,17 @@ func PostPageHandler(w http.ResponseWriter, r *http.Request) {
 		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching post")
 		return
 	}
+	// Until a scheduled post is published, only its author can see it
+	if _, viewer, _ := currentUser(r); post.Scheduled && viewer != post.Author {
+		ErrorHandler(w, r, http.StatusNotFound, "Post not found")
+		return
+	}
+
+	// Links without the slug, or with an outdated one, go to the canonical URL
+	if r.URL.EscapedPath() != post.URL() {
+		redirectToPost(w, r, post)
+		return
+	}
 
 	// Fetch comments for the post
 	comments, err := models.GetCommentsForPost(postID)
@@ -208,89 +375,161 @@ func PostPageHandler(w http.ResponseWriter, r *http.Request) {
 	notification := r.URL.Query().Get("notification")
 
 	// Load the comments.html template
-	tmpl, err := template.ParseFiles("templates/comments.html")
+	tmpl, err := template.ParseFiles("templates/comments.html", "templates/poll.html")
 	if err != nil {
 		http.Error(w, "Error loading template", http.StatusInternalServerError)
 		return
 	}
 
 	var loggedIn bool
-	var username string
+	var userID, username string
 	cookie, err := r.Cookie("session_token")
 	if err == nil {
 		loggedIn = true
-		_, username, _ = models.GetIDBySessionToken(cookie.Value)
+		userID, username, _ = models.GetIDBySessionToken(cookie.Value)
 	}
 
-	data := struct {
-		Post         models.Post
-		Comments     []models.Comment
-		LoggedIn     bool
-		Username     string
-		Notification string
-	}{
-		Post:         post,
-		Comments:     comments,
-		LoggedIn:     loggedIn,
-		Username:     username,
-		Notification: notification,
+	// Mark the viewer's own likes and dislikes and count the emoji reactions
+	posts := []models.Post{post}
+	err = models.LoadPostReactions(userID, posts)
+	if err == nil {
+		err = models.LoadPostAuthorReputations(posts)
 	}
-
-	tmpl.Execute(w, data)
-}
-
-func MyPostsHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session_token")
-	if err != nil || cookie.Value == "" {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
+	if err == nil {
+		err = models.LoadCommentReactions(userID, comments)
 	}
-
-	userID, _, err := models.GetIDBySessionToken(cookie.Value)
-	if err != nil {
-		ErrorHandler(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
-		return
+	if err == nil {
+		err = models.LoadCommentAuthorReputations(comments)
 	}
-
-	// Fetch posts created by the logged-in user
-	posts, err := models.GetPostsByUser(userID)
+	if err == nil {
+		err = models.LoadPostBookmarks(userID, posts)
+	}
+	if err == nil {
+		err = models.LoadCommentBookmarks(userID, comments)
+	}
+	if err == nil {
+		err = models.LoadPostPolls(userID, posts)
+	}
+	post = posts[0]
 	if err != nil {
-		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching posts")
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching reactions")
 		return
 	}
-
-	categories, err := models.GetAllCategories()
+	reactionTypes, err := models.EnabledReactionTypes()
 	if err != nil {
-		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching categories")
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching reactions")
 		return
 	}
+	var collections []models.Collection
+	var isModerator bool
+	var pins []models.PostPin
+	if loggedIn {
+		collections, err = models.GetCollections(userID)
+		if err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching lists")
+			return
+		}
 
-	// Render the posts page with "My Posts"
-	tmpl, err := template.ParseFiles("templates/posts.html")
-	if err != nil {
-		http.Error(w, "Error loading template", http.StatusInternalServerError)
-		return
+		// Moderators get the pin and lock controls
+		role, err := models.GetUserRole(userID)
+		if err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		isModerator = models.IsPrivilegedRole(role)
+		if isModerator {
+			pins, err = models.GetPostPins(postID)
+			if err != nil {
+				ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching pins")
+				return
+			}
+		}
 	}
 
 	data := struct {
-		Posts            []models.Post
-		Categories       []models.Category
-		LoggedIn         bool
-		Username         string
-		SelectedCategory string
-		SelectedFilter   string
+		Post           models.Post
+		Comments       []models.Comment
+		LoggedIn       bool
+		Username       string
+		Unread         int
+		RevealSpoilers bool
+		Notification   string
+		ReactionTypes  []models.ReactionType // for comments added live
+		Collections    []models.Collection
+		CanReact       bool // logged in and the post is not archived
+		IsModerator    bool
+		Pins           []models.PostPin // where the post is or can be pinned, for moderators
 	}{
-		Posts:            posts,
-		Categories:       categories,
-		LoggedIn:         true,
-		SelectedCategory: "",
-		SelectedFilter:   "",
+		Post:           post,
+		Comments:       comments,
+		LoggedIn:       loggedIn,
+		Username:       username,
+		Unread:         unreadNotifications(userID),
+		RevealSpoilers: revealSpoilers(userID),
+		Notification:   notification,
+		ReactionTypes:  reactionTypes,
+		Collections:    collections,
+		CanReact:       loggedIn && !post.Archived,
+		IsModerator:    isModerator,
+		Pins:           pins,
 	}
 
 	tmpl.Execute(w, data)
 }
 
+// postsPage is the data of posts.html, which lists the user's own posts, liked posts, bookmarks and tags.
+type postsPage struct {
+	Title            string // shown instead of the post count when set
+	Posts            []models.Post
+	Comments         []models.Comment // saved comments, on bookmark lists only
+	Categories       []models.Category
+	Collections      []models.Collection // the viewer's lists, offered on the bookmark buttons
+	Collection       *models.Collection  // the list being shown, nil for bookmarks outside any list
+	BookmarkList     bool
+	CollectionID     string
+	IsOwner          bool // whether the viewer owns the bookmark list being shown
+	LoggedIn         bool
+	Username         string
+	Unread           int  // unread notifications, shown on the bell
+	RevealSpoilers   bool // whether spoilers are shown without clicking them open
+	SelectedCategory string
+	SelectedFilter   string
+	PrevPage         int    // 0 when on the first page
+	NextPage         int    // 0 when on the last page
+	PageURL          string // the page links are this followed by the page number
+}
+
+// postFilters fetches the posts of each filter tab on posts.html; every filter has its own route.
+var postFilters = map[string]func(userID string) ([]models.Post, error){
+	"created":   models.GetPostsByUser,
+	"liked":     models.GetLikedPostsByUser,
+	"disliked":  models.GetDislikedPostsByUser,
+	"commented": models.GetCommentedPostsByUser,
+	"mentioned": models.GetMentionedPostsByUser,
+}
+
+func MyPostsHandler(w http.ResponseWriter, r *http.Request) {
+	userPostsHandler(w, r, "created")
+}
+
 func LikedPostsHandler(w http.ResponseWriter, r *http.Request) {
+	userPostsHandler(w, r, "liked")
+}
+
+func DislikedPostsHandler(w http.ResponseWriter, r *http.Request) {
+	userPostsHandler(w, r, "disliked")
+}
+
+func CommentedPostsHandler(w http.ResponseWriter, r *http.Request) {
+	userPostsHandler(w, r, "commented")
+}
+
+func MentionedPostsHandler(w http.ResponseWriter, r *http.Request) {
+	userPostsHandler(w, r, "mentioned")
+}
+
+// userPostsHandler lists the posts the logged-in user created, liked, disliked, commented on or was mentioned in.
+func userPostsHandler(w http.ResponseWriter, r *http.Request, filter string) {
 	cookie, err := r.Cookie("session_token")
 	if err != nil || cookie.Value == "" {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
@@ -303,10 +542,18 @@ func LikedPostsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Fetch posts liked by the logged-in user
-	posts, err := models.GetLikedPostsByUser(userID)
+	posts, err := postFilters[filter](userID)
+	if err == nil {
+		err = models.LoadPostReactions(userID, posts)
+	}
+	if err == nil {
+		err = models.LoadPostAuthorReputations(posts)
+	}
+	if err == nil {
+		err = models.LoadPostBookmarks(userID, posts)
+	}
 	if err != nil {
-		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching liked posts")
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching posts")
 		return
 	}
 
@@ -316,26 +563,27 @@ func LikedPostsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Render the posts page with "Liked Posts"
+	collections, err := models.GetCollections(userID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching lists")
+		return
+	}
+
 	tmpl, err := template.ParseFiles("templates/posts.html")
 	if err != nil {
 		http.Error(w, "Error loading template", http.StatusInternalServerError)
 		return
 	}
 
-	data := struct {
-		Posts            []models.Post
-		Categories       []models.Category
-		LoggedIn         bool
-		Username         string
-		SelectedCategory string
-		SelectedFilter   string
-	}{
+	data := postsPage{
 		Posts:            posts,
 		Categories:       categories,
+		Collections:      collections,
 		LoggedIn:         true,
+		Unread:           unreadNotifications(userID),
+		RevealSpoilers:   revealSpoilers(userID),
 		SelectedCategory: "",
-		SelectedFilter:   "",
+		SelectedFilter:   filter,
 	}
 
 	tmpl.Execute(w, data)
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"forum/models"
+)
+
+func TestParsePublishAt(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value   string
+		offset  string
+		want    time.Time
+		wantErr bool
+	}{
+		{"", "", time.Time{}, false},
+		{"2024-05-01T15:30", "0", time.Date(2024, 5, 1, 15, 30, 0, 0, time.UTC), false},
+		// Berlin in summer is two hours ahead of UTC, which getTimezoneOffset gives as -120
+		{"2024-05-01T15:30", "-120", time.Date(2024, 5, 1, 13, 30, 0, 0, time.UTC), false},
+		{"2024-05-01T13:30", "-120", time.Time{}, true},
+		{"2026-05-01T12:00", "0", time.Time{}, true},
+		{"tomorrow", "0", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parsePublishAt(tt.value, tt.offset, now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q %q: expected error %v; got %v", tt.value, tt.offset, tt.wantErr, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%q %q: expected %v; got %v", tt.value, tt.offset, tt.want, got)
+		}
+	}
+}
+
+func TestScheduledPostStaysHidden(t *testing.T) {
+	setupTestDB(t)
+	useTestWorkDir(t)
+
+	authorID, authorToken := loginTestUser(t, "author")
+	_, readerToken := loginTestUser(t, "reader")
+	postID, err := models.CreateScheduledPost(authorID, "Secret launch", "Soon", "", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither the old post links nor the event stream give away a scheduled post to anyone but its author
+	routes := []struct {
+		path    string
+		handler http.HandlerFunc
+		visible func(*httptest.ResponseRecorder) bool
+	}{
+		{"/post?id=", LegacyPostHandler, func(rr *httptest.ResponseRecorder) bool {
+			return rr.Header().Get("Location") != ""
+		}},
+		{"/post/events?id=", PostEventsHandler, func(rr *httptest.ResponseRecorder) bool {
+			return rr.Header().Get("Content-Type") == "text/event-stream"
+		}},
+	}
+	tests := []struct {
+		viewer       string
+		sessionToken string
+		want         bool
+	}{
+		{"author", authorToken, true},
+		{"reader", readerToken, false},
+		{"visitor", "", false},
+	}
+	for _, route := range routes {
+		for _, test := range tests {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel() // the event stream ends at once
+			req := httptest.NewRequest(http.MethodGet, route.path+postID, nil).WithContext(ctx)
+			if test.sessionToken != "" {
+				req.AddCookie(&http.Cookie{Name: "session_token", Value: test.sessionToken})
+			}
+			rr := httptest.NewRecorder()
+			route.handler(rr, req)
+			if got := route.visible(rr); got != test.want {
+				t.Errorf("%s for the %s: expected visible %v; got %v", route.path, test.viewer, test.want, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package handlers
+
+// public user profiles
+import (
+	"database/sql"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"forum/models"
+)
+
+// profileRecentItems is how many recent posts and comments a profile lists.
+const profileRecentItems = 5
+
+// ProfileHandler shows the public page of the user named in /user/{username}.
+func ProfileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/user/")
+	if name == "" || strings.Contains(name, "/") {
+		ErrorHandler(w, r, http.StatusNotFound, "User not found")
+		return
+	}
+
+	profile, err := models.GetProfileByUsername(name)
+	if err == sql.ErrNoRows {
+		ErrorHandler(w, r, http.StatusNotFound, "User not found")
+		return
+	} else if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	posts, err := models.GetRecentPostsByUser(profile.UserID, profileRecentItems)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching posts")
+		return
+	}
+	comments, err := models.GetRecentCommentsByUser(profile.UserID, profileRecentItems)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching comments")
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/profile.html")
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error loading template")
+		return
+	}
+
+	followers, following, err := models.GetFollowCounts(profile.UserID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	userID, username, loggedIn := currentUser(r)
+	var isFollowing bool
+	if loggedIn {
+		isFollowing, err = models.IsFollowingUser(userID, profile.UserID)
+		if err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+	}
+
+	data := struct {
+		LoggedIn       bool
+		Username       string
+		Unread         int
+		RevealSpoilers bool
+		IsOwnProfile   bool
+		IsFollowing    bool
+		Followers      int
+		Following      int
+		Profile        models.Profile
+		Posts          []models.Post
+		Comments       []models.Comment
+		Privileges     []privilegeStatus
+		Notification   string
+	}{
+		LoggedIn:       loggedIn,
+		Username:       username,
+		Unread:         unreadNotifications(userID),
+		RevealSpoilers: revealSpoilers(userID),
+		IsOwnProfile:   loggedIn && userID == profile.UserID,
+		IsFollowing:    isFollowing,
+		Followers:      followers,
+		Following:      following,
+		Profile:        profile,
+		Posts:          posts,
+		Comments:       comments,
+		Privileges:     privilegeStatuses(profile.Reputation),
+		Notification:   r.URL.Query().Get("notification"),
+	}
+
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		log.Println("Error executing template:", err)
+	}
+}
+
+// revealSpoilers reports whether spoilers open by themselves for the user; errors keep them closed.
+func revealSpoilers(userID string) bool {
+	if userID == "" {
+		return false
+	}
+	reveal, err := models.RevealsSpoilers(userID)
+	if err != nil {
+		log.Println("Error fetching the spoiler setting:", err)
+	}
+	return reveal
+}
+
+// ProfileSettingsHandler lets the logged-in user edit their bio, avatar and spoiler setting.
+func ProfileSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, username, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	profile, err := models.GetProfileByUsername(username)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		renderProfileSettings(w, r, profile, "")
+		return
+	}
+
+	bio := strings.TrimSpace(strings.ReplaceAll(r.FormValue("bio"), "\r\n", "\n"))
+	if utf8.RuneCountInString(bio) > models.MaxBioLength {
+		profile.Bio = bio
+		renderProfileSettings(w, r, profile, "Your bio is too long")
+		return
+	}
+
+	avatarPath := profile.AvatarPath
+	if r.FormValue("remove_avatar") == "on" {
+		avatarPath = ""
+	}
+	if file, header, err := r.FormFile("avatar"); err == nil {
+		defer file.Close()
+
+		// Avatars go through the same checks as post images
+		if err := validateImage(file, header); err != nil {
+			renderProfileSettings(w, r, profile, err.Error())
+			return
+		}
+		avatarPath, err = saveImage(file, header)
+		if err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if err := models.UpdateProfile(userID, bio, avatarPath); err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if err := models.SetRevealSpoilers(userID, r.FormValue("reveal_spoilers") == "on"); err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if profile.AvatarPath != "" && profile.AvatarPath != avatarPath && strings.HasPrefix(profile.AvatarPath, "uploads/") {
+		if err := os.Remove(profile.AvatarPath); err != nil {
+			log.Println("Error removing old avatar:", err)
+		}
+	}
+
+	http.Redirect(w, r, "/user/"+url.PathEscape(username)+"?notification=profile_saved", http.StatusSeeOther)
+}
+
+func renderProfileSettings(w http.ResponseWriter, r *http.Request, profile models.Profile, errorMessage string) {
+	tmpl, err := template.ParseFiles("templates/profile_settings.html")
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error loading template")
+		return
+	}
+
+	data := struct {
+		LoggedIn       bool
+		Username       string
+		Unread         int
+		RevealSpoilers bool
+		Profile        models.Profile
+		MaxBioLength   int
+		Error          string
+	}{
+		LoggedIn:       true,
+		Username:       profile.Username,
+		Unread:         unreadNotifications(profile.UserID),
+		RevealSpoilers: revealSpoilers(profile.UserID),
+		Profile:        profile,
+		MaxBioLength:   models.MaxBioLength,
+		Error:          errorMessage,
+	}
+
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		log.Println("Error executing template:", err)
+	}
+}
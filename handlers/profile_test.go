@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"forum/models"
+)
+
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00")
+
+// imageFile serves in-memory bytes as an uploaded file.
+type imageFile struct {
+	*bytes.Reader
+}
+
+func (imageFile) Close() error { return nil }
+
+func TestValidateImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		size    int64
+		wantErr string
+	}{
+		{"png", testPNG, int64(len(testPNG)), ""},
+		{"text", []byte("just some notes"), 15, "Unsupported image type"},
+		{"too large", testPNG, maxImageSize + 1, "too large"},
+	}
+	for _, test := range tests {
+		header := &multipart.FileHeader{Filename: "avatar.png", Size: test.size}
+		err := validateImage(imageFile{bytes.NewReader(test.content)}, header)
+		if test.wantErr == "" && err != nil || test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("%s: expected error %q; got %v", test.name, test.wantErr, err)
+		}
+	}
+}
+
+func TestProfileSettingsHandler(t *testing.T) {
+	setupTestDB(t)
+	useTestWorkDir(t)
+
+	userID, sessionToken := loginTestUser(t, "reader")
+
+	// Invalid settings are shown again with the reason and nothing is saved
+	tests := []struct {
+		name       string
+		bio        string
+		avatar     []byte
+		wantStatus int
+		wantBody   string
+		wantAvatar bool
+	}{
+		{"bio too long", strings.Repeat("a", models.MaxBioLength+1), nil, http.StatusOK, "Your bio is too long", false},
+		{"not an image", "Hello", []byte("just some notes"), http.StatusOK, "Unsupported image type", false},
+		{"valid", "Hello", testPNG, http.StatusSeeOther, "", true},
+	}
+	for _, test := range tests {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("bio", test.bio)
+		if test.avatar != nil {
+			part, err := form.CreateFormFile("avatar", "avatar.png")
+			if err != nil {
+				t.Fatal(err)
+			}
+			part.Write(test.avatar)
+		}
+		form.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/settings", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+		rr := httptest.NewRecorder()
+		ProfileSettingsHandler(rr, req)
+		if rr.Code != test.wantStatus || !strings.Contains(rr.Body.String(), test.wantBody) {
+			t.Errorf("%s: expected status %d with %q; got %d (%s)", test.name, test.wantStatus, test.wantBody, rr.Code, rr.Body.String())
+		}
+		avatarPath, err := models.GetAvatarPath(userID)
+		if err != nil || (avatarPath != "") != test.wantAvatar {
+			t.Errorf("%s: expected an avatar stored %v; got %q (%v)", test.name, test.wantAvatar, avatarPath, err)
+		}
+	}
+	profile, err := models.GetProfileByUsername("reader")
+	if err != nil || profile.Bio != "Hello" {
+		t.Errorf("expected only the valid bio saved; got %q (%v)", profile.Bio, err)
+	}
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"forum/models"
+)
+
+// RateLimitPolicy describes a token bucket: Burst requests at once, refilled at Rate requests per second.
+// Only state-changing requests are counted unless Reads is set, for routes that are only read.
+type RateLimitPolicy struct {
+	Rate  float64
+	Burst int
+	Reads bool
+}
+
+// rateLimitPolicies holds the limits for every rate-limited route, applied per IP and per logged-in user.
+var rateLimitPolicies = map[string]RateLimitPolicy{
+	"/login":                     {Rate: 5.0 / 60, Burst: 5},
+	"/login/two_factor":          {Rate: 5.0 / 60, Burst: 5},
+	"/oauth/login":               {Rate: 10.0 / 60, Burst: 10},
+	"/register":                  {Rate: 3.0 / 3600, Burst: 3},
+	"/forgot_password":           {Rate: 3.0 / 3600, Burst: 3},
+	"/reset_password":            {Rate: 5.0 / 60, Burst: 5},
+	"/settings":                  {Rate: 10.0 / 60, Burst: 10},
+	"/change_password":           {Rate: 5.0 / 60, Burst: 5},
+	"/resend_verification":       {Rate: 3.0 / 3600, Burst: 3},
+	"/two_factor/enable":         {Rate: 5.0 / 60, Burst: 5},
+	"/two_factor/disable":        {Rate: 5.0 / 60, Burst: 5},
+	"/two_factor/recovery_codes": {Rate: 5.0 / 60, Burst: 5},
+	"/create_post":               {Rate: 1.0 / 30, Burst: 3},
+	"/create_comment":            {Rate: 1.0 / 10, Burst: 5},
+	"/follow":                    {Rate: 1, Burst: 10},
+	"/follow_category":           {Rate: 1, Burst: 10},
+	"/like":                      {Rate: 1, Burst: 10},
+	"/dislike":                   {Rate: 1, Burst: 10},
+	"/like_comment":              {Rate: 1, Burst: 10},
+	"/dislike_comment":           {Rate: 1, Burst: 10},
+	"/react":                     {Rate: 1, Burst: 10},
+	"/poll/vote":                 {Rate: 1, Burst: 5},
+	"/bookmark":                  {Rate: 1, Burst: 10},
+	"/collections":               {Rate: 10.0 / 60, Burst: 10},
+	"/preview":                   {Rate: 2, Burst: 10},
+	"/drafts/save":               {Rate: 1, Burst: 5},
+	"/tag_suggestions":           {Rate: 5, Burst: 20, Reads: true},
+	"/user_suggestions":          {Rate: 5, Burst: 20, Reads: true},
+}
+
+// bucketIdleTimeout is how long an unused bucket is kept before it is dropped.
+const bucketIdleTimeout = 10 * time.Minute
+
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// rateLimiter keeps one token bucket per key for a single policy.
+type rateLimiter struct {
+	policy  RateLimitPolicy
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+func newRateLimiter(policy RateLimitPolicy) *rateLimiter {
+	return &rateLimiter{
+		policy:  policy,
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// allow takes a token from the key's bucket. When the bucket is empty it reports
+// how long the caller has to wait for the next token.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(l.policy.Burst), lastSeen: now}
+		l.buckets[key] = bucket
+	}
+
+	elapsed := now.Sub(bucket.lastSeen).Seconds()
+	bucket.tokens = math.Min(float64(l.policy.Burst), bucket.tokens+elapsed*l.policy.Rate)
+	bucket.lastSeen = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	wait := (1 - bucket.tokens) / l.policy.Rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// cleanup drops buckets that have been idle for longer than bucketIdleTimeout.
+func (l *rateLimiter) cleanup() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := l.now().Add(-bucketIdleTimeout)
+	for key, bucket := range l.buckets {
+		if bucket.lastSeen.Before(cutoff) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = make(map[string]*rateLimiter)
+	cleanupRun sync.Once
+)
+
+// limiterFor returns the shared limiter for a route, creating it on first use.
+func limiterFor(route string, policy RateLimitPolicy) *rateLimiter {
+	cleanupRun.Do(func() {
+		go func() {
+			for range time.Tick(bucketIdleTimeout) {
+				limitersMu.Lock()
+				for _, limiter := range limiters {
+					limiter.cleanup()
+				}
+				limitersMu.Unlock()
+			}
+		}()
+	})
+
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+
+	limiter, ok := limiters[route]
+	if !ok {
+		limiter = newRateLimiter(policy)
+		limiters[route] = limiter
+	}
+	return limiter
+}
+
+// RateLimit wraps a handler with the policy configured for route in rateLimitPolicies.
+// Requests are counted against the client IP and, when logged in, against the user as well.
+func RateLimit(route string, next http.HandlerFunc) http.HandlerFunc {
+	policy, ok := rateLimitPolicies[route]
+	if !ok {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Unless the policy says otherwise, only state-changing requests are limited;
+		// rendering the login form is free.
+		if !policy.Reads && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			next(w, r)
+			return
+		}
+
+		limiter := limiterFor(route, policy)
+		keys := []string{"ip:" + clientIP(r)}
+		if cookie, err := r.Cookie("session_token"); err == nil && cookie.Value != "" {
+			if userID, _, err := models.GetIDBySessionToken(cookie.Value); err == nil {
+				keys = append(keys, "user:"+userID)
+			}
+		}
+
+		for _, key := range keys {
+			if ok, wait := limiter.allow(key); !ok {
+				w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+				// Scripts show the message next to the button they were sending from
+				if wantsJSON(r) {
+					writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "Too many requests, please slow down"})
+					return
+				}
+				w.WriteHeader(http.StatusTooManyRequests)
+				ErrorHandler(w, r, http.StatusTooManyRequests, "Too many requests, please slow down")
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+// clientIP returns the remote address of the request without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
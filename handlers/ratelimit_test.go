@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(RateLimitPolicy{Rate: 1, Burst: 2})
+	limiter.now = func() time.Time { return now }
+
+	// Case 1: the burst is available immediately
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.allow("ip:1.2.3.4"); !ok {
+			t.Fatalf("request %d: expected to be allowed", i+1)
+		}
+	}
+
+	// Case 2: the bucket is empty and reports the wait time
+	ok, wait := limiter.allow("ip:1.2.3.4")
+	if ok || wait != time.Second {
+		t.Errorf("expected rejection with 1s wait; got ok=%v wait=%v", ok, wait)
+	}
+
+	// Case 3: other keys have their own bucket
+	if ok, _ := limiter.allow("ip:5.6.7.8"); !ok {
+		t.Errorf("expected a different key to be allowed")
+	}
+
+	// Case 4: tokens are refilled over time
+	now = now.Add(time.Second)
+	if ok, _ := limiter.allow("ip:1.2.3.4"); !ok {
+		t.Errorf("expected a refilled token to be allowed")
+	}
+
+	// Case 5: idle buckets are dropped
+	now = now.Add(bucketIdleTimeout + time.Second)
+	limiter.cleanup()
+	if len(limiter.buckets) != 0 {
+		t.Errorf("expected idle buckets to be removed; got %d", len(limiter.buckets))
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	rateLimitPolicies["/test_limited"] = RateLimitPolicy{Rate: 0.001, Burst: 1}
+	defer delete(rateLimitPolicies, "/test_limited")
+
+	handler := RateLimit("/test_limited", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("POST", "/test_limited", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %v; got %v", http.StatusOK, rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected status %v with Retry-After; got %v", http.StatusTooManyRequests, rr.Code)
+	}
+
+	// Scripts get the message as JSON
+	req.Header.Set("Accept", "application/json")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusTooManyRequests || !strings.Contains(rr.Body.String(), `"error":"Too many requests`) {
+		t.Errorf("expected a JSON error; got %v %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRateLimitReads(t *testing.T) {
+	rateLimitPolicies["/test_form"] = RateLimitPolicy{Rate: 0.001, Burst: 1}
+	rateLimitPolicies["/test_lookup"] = RateLimitPolicy{Rate: 0.001, Burst: 1, Reads: true}
+	defer delete(rateLimitPolicies, "/test_form")
+	defer delete(rateLimitPolicies, "/test_lookup")
+
+	// GET requests are free unless the policy limits reads
+	tests := []struct {
+		route string
+		want  int
+	}{
+		{"/test_form", http.StatusOK},
+		{"/test_lookup", http.StatusTooManyRequests},
+	}
+	for _, test := range tests {
+		handler := RateLimit(test.route, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+		var rr *httptest.ResponseRecorder
+		for i := 0; i < 2; i++ {
+			rr = httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, test.route, nil))
+		}
+		if rr.Code != test.want {
+			t.Errorf("%s: expected the second GET to get %d; got %d", test.route, test.want, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package handlers
+
+// likes, dislikes and emoji reactions
+import (
+	"database/sql"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"forum/models"
+)
+
+// reactionResponse is returned to fetch requests after a like or dislike.
+type reactionResponse struct {
+	Likes    int  `json:"likes"`
+	Dislikes int  `json:"dislikes"`
+	Liked    bool `json:"liked"`    // whether the viewer now likes it
+	Disliked bool `json:"disliked"` // whether the viewer now dislikes it
+}
+
+// wantsJSON reports whether the request was sent by script and expects a JSON answer.
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Error encoding JSON:", err)
+	}
+}
+
+// reactionError answers a failed reaction with JSON for scripts and the error page for forms.
+func reactionError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if wantsJSON(r) {
+		writeJSON(w, status, map[string]string{"error": message})
+		return
+	}
+	if status == http.StatusUnauthorized {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	ErrorHandler(w, r, status, message)
+}
+
+// safeRedirectTarget returns the path of the Referer when it points to this site,
+// so form posts can go back to the page they came from without redirecting elsewhere.
+func safeRedirectTarget(r *http.Request, fallback string) string {
+	referer, err := url.Parse(r.Header.Get("Referer"))
+	if err != nil || referer.Host != r.Host || (referer.Scheme != "http" && referer.Scheme != "https") {
+		return fallback
+	}
+	path := referer.EscapedPath()
+	// Paths like //evil.example or /\evil.example are treated as other hosts by browsers
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return fallback
+	}
+	if referer.RawQuery != "" {
+		path += "?" + referer.RawQuery
+	}
+	return path
+}
+
+// respondPostReaction answers a successful like or dislike of a post.
+func respondPostReaction(w http.ResponseWriter, r *http.Request, userID, postID string) {
+	if !wantsJSON(r) {
+		http.Redirect(w, r, safeRedirectTarget(r, "/"), http.StatusSeeOther)
+		return
+	}
+
+	post, err := models.GetPostByID(postID)
+	if err != nil {
+		reactionError(w, r, http.StatusInternalServerError, "Error fetching post")
+		return
+	}
+	liked, disliked, err := models.GetPostReaction(userID, postID)
+	if err != nil {
+		reactionError(w, r, http.StatusInternalServerError, "Error fetching reaction")
+		return
+	}
+	writeJSON(w, http.StatusOK, reactionResponse{Likes: post.Likes, Dislikes: post.Dislikes, Liked: liked, Disliked: disliked})
+}
+
+// respondCommentReaction answers a successful like or dislike of a comment.
+func respondCommentReaction(w http.ResponseWriter, r *http.Request, userID, commentID string) {
+	comment, err := models.GetCommentByID(commentID)
+	if err != nil {
+		reactionError(w, r, http.StatusInternalServerError, "Error fetching comment")
+		return
+	}
+	if !wantsJSON(r) {
+		http.Redirect(w, r, "/posts/"+url.PathEscape(comment.PostID), http.StatusSeeOther)
+		return
+	}
+
+	liked, disliked, err := models.GetCommentReaction(userID, commentID)
+	if err != nil {
+		reactionError(w, r, http.StatusInternalServerError, "Error fetching reaction")
+		return
+	}
+	writeJSON(w, http.StatusOK, reactionResponse{Likes: comment.Likes, Dislikes: comment.Dislikes, Liked: liked, Disliked: disliked})
+}
+
+// emojiReactionResponse is returned to fetch requests after an emoji reaction is toggled.
+type emojiReactionResponse struct {
+	Type    string `json:"type"`
+	Count   int    `json:"count"`
+	Reacted bool   `json:"reacted"` // whether the viewer now has this reaction
+}
+
+// ReactHandler toggles one of the emoji reactions of the logged-in user on a post or comment.
+func ReactHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	userID, _, ok := currentUser(r)
+	if !ok {
+		reactionError(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+
+	targetType := r.FormValue("target_type")
+	targetID := r.FormValue("target_id")
+	reaction := r.FormValue("type")
+
+	postID, err := models.ReactionTargetPostID(targetType, targetID)
+	if err == sql.ErrNoRows {
+		reactionError(w, r, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	} else if err != nil {
+		reactionError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if !requireOpenPost(w, r, postID, false) {
+		return
+	}
+
+	reacted, count, err := models.ToggleEmojiReaction(userID, targetType, targetID, reaction)
+	if err == models.ErrUnknownReaction {
+		reactionError(w, r, http.StatusBadRequest, "Unknown reaction")
+		return
+	} else if err != nil {
+		reactionError(w, r, http.StatusInternalServerError, "Error saving reaction")
+		return
+	}
+	publishEmojiReaction(postID, targetType, targetID, reaction, count)
+
+	if !wantsJSON(r) {
+		http.Redirect(w, r, safeRedirectTarget(r, "/posts/"+url.PathEscape(postID)), http.StatusSeeOther)
+		return
+	}
+	writeJSON(w, http.StatusOK, emojiReactionResponse{Type: reaction, Count: count, Reacted: reacted})
+}
+
+// ReactionsHandler lists who reacted to a post or comment.
+func ReactionsHandler(w http.ResponseWriter, r *http.Request) {
+	targetType := models.ReactionTargetPost
+	targetID := r.URL.Query().Get("post_id")
+	if commentID := r.URL.Query().Get("comment_id"); commentID != "" {
+		targetType = models.ReactionTargetComment
+		targetID = commentID
+	}
+
+	postID, err := models.ReactionTargetPostID(targetType, targetID)
+	if err == sql.ErrNoRows {
+		ErrorHandler(w, r, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	} else if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	groups, err := models.GetReactionGroups(targetType, targetID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching reactions")
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/reactions.html")
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error loading template")
+		return
+	}
+
+	userID, username, loggedIn := currentUser(r)
+	data := struct {
+		LoggedIn  bool
+		Username  string
+		Unread    int
+		PostID    string
+		OnComment bool
+		Groups    []models.ReactionGroup
+	}{
+		LoggedIn:  loggedIn,
+		Username:  username,
+		Unread:    unreadNotifications(userID),
+		PostID:    postID,
+		OnComment: targetType == models.ReactionTargetComment,
+		Groups:    groups,
+	}
+
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		log.Println("Error executing template:", err)
+	}
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSafeRedirectTarget(t *testing.T) {
+	tests := []struct {
+		referer string
+		want    string
+	}{
+		{"http://forum.test/post?id=42", "/post?id=42"},
+		{"https://forum.test/?category=3&feed=following", "/?category=3&feed=following"},
+		{"http://forum.test", "/"},
+		{"", "/"},
+		{"http://evil.test/post?id=42", "/"},
+		{"//evil.test/", "/"},
+		{"http://forum.test//evil.test/", "/"},
+		{"http://forum.test/\\evil.test/", "/%5Cevil.test/"},
+		{"javascript://forum.test/%0aalert(1)", "/"},
+		{"/post?id=42", "/"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "http://forum.test/like", nil)
+		req.Header.Set("Referer", tt.referer)
+		if got := safeRedirectTarget(req, "/"); got != tt.want {
+			t.Errorf("referer %q: expected %q; got %q", tt.referer, tt.want, got)
+		}
+	}
+}
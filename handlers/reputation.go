@@ -0,0 +1,47 @@
+package handlers
+
+// privileges unlocked by reputation
+import (
+	"fmt"
+	"net/http"
+
+	"forum/models"
+)
+
+// privilegeActions describes each privilege in error messages.
+var privilegeActions = map[string]string{
+	models.PrivilegeUploadImages: "upload images",
+	models.PrivilegePostLinks:    "post links",
+}
+
+// requirePrivilege renders an error and returns false unless the user's reputation unlocks the privilege.
+func requirePrivilege(w http.ResponseWriter, r *http.Request, userID, privilege string) bool {
+	allowed, err := models.HasPrivilege(userID, privilege)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return false
+	}
+	if !allowed {
+		ErrorHandler(w, r, http.StatusForbidden, fmt.Sprintf("You need at least %d reputation to %s",
+			models.PrivilegeThreshold(privilege), privilegeActions[privilege]))
+		return false
+	}
+	return true
+}
+
+// privilegeStatus is a privilege as listed on a profile.
+type privilegeStatus struct {
+	Label     string
+	Threshold int
+	Unlocked  bool
+}
+
+// privilegeStatuses lists every privilege with whether the reputation unlocks it.
+func privilegeStatuses(reputation int) []privilegeStatus {
+	var statuses []privilegeStatus
+	for _, privilege := range models.PrivilegeLabels {
+		threshold := models.PrivilegeThreshold(privilege.Key)
+		statuses = append(statuses, privilegeStatus{Label: privilege.Label, Threshold: threshold, Unlocked: reputation >= threshold})
+	}
+	return statuses
+}
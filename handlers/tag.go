@@ -0,0 +1,119 @@
+package handlers
+
+// tag pages and tag autocomplete
+import (
+	"database/sql"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"forum/models"
+)
+
+const (
+	tagPageSize        = 20
+	tagCloudSize       = 30 // tags shown in the sidebar of the main page
+	tagSuggestionLimit = 8
+)
+
+// TagPageHandler lists the posts with the tag in /tags/<name>. Names that only look like the tag,
+// such as other spellings or letter cases, redirect to its page.
+func TagPageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	tag, err := models.GetTag(strings.TrimPrefix(r.URL.Path, "/tags/"))
+	if err == sql.ErrNoRows {
+		ErrorHandler(w, r, http.StatusNotFound, "Tag not found")
+		return
+	} else if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching tag")
+		return
+	}
+	if r.URL.Path != "/tags/"+tag.Name {
+		http.Redirect(w, r, "/tags/"+url.PathEscape(tag.Name), http.StatusMovedPermanently)
+		return
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	userID, username, loggedIn := currentUser(r)
+	posts, hasMore, err := models.GetPostsByTag(tag.Name, page, tagPageSize)
+	if err == nil {
+		err = models.LoadPostReactions(userID, posts)
+	}
+	if err == nil {
+		err = models.LoadPostAuthorReputations(posts)
+	}
+	if err == nil {
+		err = models.LoadPostBookmarks(userID, posts)
+	}
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching posts")
+		return
+	}
+
+	var collections []models.Collection
+	if loggedIn {
+		collections, err = models.GetCollections(userID)
+		if err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, "Error fetching lists")
+			return
+		}
+	}
+
+	nextPage := 0
+	if hasMore {
+		nextPage = page + 1
+	}
+
+	tmpl, err := template.ParseFiles("templates/posts.html")
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error loading template")
+		return
+	}
+
+	data := postsPage{
+		Title:          "#" + tag.Name,
+		Posts:          posts,
+		Collections:    collections,
+		LoggedIn:       loggedIn,
+		Username:       username,
+		Unread:         unreadNotifications(userID),
+		RevealSpoilers: revealSpoilers(userID),
+		PrevPage:       page - 1,
+		NextPage:       nextPage,
+		PageURL:        "/tags/" + url.PathEscape(tag.Name) + "?page=",
+	}
+
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		log.Println("Error executing template:", err)
+	}
+}
+
+// TagSuggestionsHandler returns the names of the tags that start like ?q=, most used first, as JSON.
+func TagSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": http.StatusText(http.StatusMethodNotAllowed)})
+		return
+	}
+
+	names, err := models.SuggestTags(r.URL.Query().Get("q"), tagSuggestionLimit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Error fetching tags"})
+		return
+	}
+	if names == nil {
+		names = []string{}
+	}
+	writeJSON(w, http.StatusOK, names)
+}
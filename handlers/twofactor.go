@@ -0,0 +1,196 @@
+package handlers
+
+// two-factor authentication settings
+import (
+	"encoding/base64"
+	"html/template"
+	"log"
+	"net/http"
+
+	"forum/models"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const totpIssuer = "Book Forum"
+
+type twoFactorPage struct {
+	LoggedIn      bool
+	Username      string
+	Unread        int // unread notifications, shown on the bell
+	Status        models.TwoFactorStatus
+	Required      bool
+	Secret        string
+	URI           string
+	QRCode        template.URL
+	RecoveryCodes []string
+	Error         string
+	Notification  string
+}
+
+// renderTwoFactorPage shows the 2FA status, or the enrolment QR code when 2FA is off.
+func renderTwoFactorPage(w http.ResponseWriter, r *http.Request, userID, username string, page twoFactorPage) {
+	status, err := models.GetTwoFactorStatus(userID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	required, err := models.IsTwoFactorRequired(userID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	page.LoggedIn = true
+	page.Username = username
+	page.Unread = unreadNotifications(userID)
+	page.Status = status
+	page.Required = required
+
+	if !status.Enabled {
+		secret := status.PendingSecret
+		if secret == "" {
+			secret, err = models.StartTwoFactorEnrolment(userID)
+			if err != nil {
+				ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+				return
+			}
+		}
+
+		email, err := models.GetEmailByID(userID)
+		if err != nil {
+			ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+
+		page.Secret = secret
+		page.URI = models.TOTPProvisioningURI(totpIssuer, email, secret)
+		png, err := qrcode.Encode(page.URI, qrcode.Medium, 256)
+		if err != nil {
+			log.Println("Error encoding QR code:", err)
+		} else {
+			page.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+		}
+	}
+
+	tmpl, err := template.ParseFiles("templates/two_factor.html")
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, "Error loading template")
+		return
+	}
+
+	err = tmpl.Execute(w, page)
+	if err != nil {
+		log.Println("Error executing template:", err)
+	}
+}
+
+// TwoFactorHandler shows the two-factor authentication settings of the logged-in user.
+func TwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	userID, username, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	renderTwoFactorPage(w, r, userID, username, twoFactorPage{Notification: r.URL.Query().Get("notification")})
+}
+
+// EnableTwoFactorHandler confirms enrolment with a code from the authenticator app.
+func EnableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	userID, username, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	codes, err := models.EnableTwoFactor(userID, r.FormValue("code"))
+	if err == models.ErrInvalidToken {
+		renderTwoFactorPage(w, r, userID, username, twoFactorPage{Error: "That code is not valid, please try again"})
+		return
+	} else if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	renderTwoFactorPage(w, r, userID, username, twoFactorPage{RecoveryCodes: codes})
+}
+
+// DisableTwoFactorHandler turns 2FA off after checking a current code, unless the user's role requires it.
+func DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	userID, username, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	required, err := models.IsTwoFactorRequired(userID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if required {
+		renderTwoFactorPage(w, r, userID, username, twoFactorPage{Error: "Two-factor authentication is required for your role"})
+		return
+	}
+
+	valid, err := models.VerifySecondFactor(userID, r.FormValue("code"))
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if !valid {
+		renderTwoFactorPage(w, r, userID, username, twoFactorPage{Error: "That code is not valid, please try again"})
+		return
+	}
+
+	if err := models.DisableTwoFactor(userID); err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	http.Redirect(w, r, "/two_factor", http.StatusSeeOther)
+}
+
+// RecoveryCodesHandler replaces the user's recovery codes after checking a current code.
+func RecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		ErrorHandler(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	userID, username, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	valid, err := models.VerifySecondFactor(userID, r.FormValue("code"))
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if !valid {
+		renderTwoFactorPage(w, r, userID, username, twoFactorPage{Error: "That code is not valid, please try again"})
+		return
+	}
+
+	codes, err := models.RegenerateRecoveryCodes(userID)
+	if err != nil {
+		ErrorHandler(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	renderTwoFactorPage(w, r, userID, username, twoFactorPage{RecoveryCodes: codes})
+}
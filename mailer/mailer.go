@@ -0,0 +1,141 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mailer sends plain text emails to users.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+var errHeaderInjection = errors.New("mailer: header values must not contain line breaks")
+
+// buildMessage formats an RFC 5322 message with a UTF-8 plain text body.
+func buildMessage(from, to, subject, body string) ([]byte, error) {
+	if strings.ContainsAny(from+to+subject, "\r\n") {
+		return nil, errHeaderInjection
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String()), nil
+}
+
+// SMTPMailer delivers emails through an SMTP server. Username may be empty for servers without auth.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers a single email through the configured SMTP server.
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	msg, err := buildMessage(m.From, to, subject, body)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	// The envelope sender must be a bare address, while From may include a display name.
+	sender := m.From
+	if addr, err := mail.ParseAddress(m.From); err == nil {
+		sender = addr.Address
+	}
+
+	return smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, sender, []string{to}, msg)
+}
+
+// FileMailer appends every email to a single file instead of sending it, for development and tests.
+type FileMailer struct {
+	Path string
+	From string
+	mu   sync.Mutex
+}
+
+// Send appends the message to the mail file, creating it if needed.
+func (m *FileMailer) Send(to, subject, body string) error {
+	msg, err := buildMessage(m.From, to, subject, body)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(m.Path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s\r\n\r\n", msg)
+	return err
+}
+
+// LogMailer writes emails to the standard logger instead of sending them.
+type LogMailer struct{}
+
+// Send logs the recipient, subject and body.
+func (LogMailer) Send(to, subject, body string) error {
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return errHeaderInjection
+	}
+	log.Printf("mail to %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+// FromEnv builds a Mailer from SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD, MAIL_FROM and MAIL_FILE.
+// Without SMTP_HOST, mail goes to MAIL_FILE if set and to the log otherwise.
+func FromEnv() Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Book Forum <no-reply@localhost>"
+	}
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return &SMTPMailer{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	}
+
+	if path := os.Getenv("MAIL_FILE"); path != "" {
+		return &FileMailer{Path: path, From: from}
+	}
+
+	return LogMailer{}
+}
@@ -0,0 +1,105 @@
+package mailer
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// startSMTPStandIn accepts a single SMTP session on a local port and sends the DATA payload to the returned channel.
+func startSMTPStandIn(t *testing.T) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost SMTP stand-in")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "DATA"):
+				reply("354 end data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				received <- data.String()
+				reply("250 OK")
+			case strings.HasPrefix(command, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	return listener.Addr().String(), received
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	addr, received := startSMTPStandIn(t)
+	host, port, _ := net.SplitHostPort(addr)
+
+	m := &SMTPMailer{Host: host, Port: port, From: "Book Forum <no-reply@example.com>"}
+	if err := m.Send("reader@example.com", "Confirm your email address", "Hello\nthere"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data := <-received
+	for _, want := range []string{"To: reader@example.com", "Subject: Confirm your email address", "Hello\r\nthere"} {
+		if !strings.Contains(data, want) {
+			t.Errorf("expected message to contain %q; got %q", want, data)
+		}
+	}
+}
+
+func TestFileMailerSend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail", "outbox.eml")
+	m := &FileMailer{Path: path, From: "no-reply@example.com"}
+
+	if err := m.Send("reader@example.com", "Reset your password", "link"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "Subject: Reset your password") {
+		t.Errorf("expected the message in the mail file; got %q", data)
+	}
+
+	// Header injection through the subject is rejected
+	if err := m.Send("reader@example.com", "Hi\r\nBcc: victim@example.com", "link"); err == nil {
+		t.Errorf("expected an error for a subject containing a line break")
+	}
+}
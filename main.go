@@ -3,9 +3,14 @@ package main
 import (
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"forum/handlers"
+	"forum/mailer"
 	"forum/models"
+	"forum/oidc"
 )
 
 func main() {
@@ -15,24 +20,200 @@ func main() {
 	}
 
 	models.SetDB(db)
+	if err := models.BackfillUsernameSkeletons(); err != nil {
+		log.Fatal(err)
+	}
+	if err := models.BackfillCategorySlugs(); err != nil {
+		log.Fatal(err)
+	}
+
+	if value := os.Getenv("PASSWORD_MIN_LENGTH"); value != "" {
+		minLength, err := strconv.Atoi(value)
+		if err != nil {
+			log.Fatal("PASSWORD_MIN_LENGTH must be a number")
+		}
+		policy := models.GetPasswordPolicy()
+		policy.MinLength = minLength
+		models.SetPasswordPolicy(policy)
+	}
+	if value := os.Getenv("BCRYPT_COST"); value != "" {
+		cost, err := strconv.Atoi(value)
+		if err != nil {
+			log.Fatal("BCRYPT_COST must be a number")
+		}
+		models.SetBcryptCost(cost)
+	}
+
+	reputationPolicy := models.GetReputationPolicy()
+	if value := os.Getenv("REPUTATION_WEIGHTS"); value != "" {
+		weights, err := models.ParseReputationNumbers(value)
+		if err != nil {
+			log.Fatal("REPUTATION_WEIGHTS: ", err)
+		}
+		for key, weight := range weights {
+			// The defaults hold every reaction, so an unknown key is a typo or a renamed reaction
+			if _, ok := reputationPolicy.Weights[key]; !ok {
+				log.Fatal("REPUTATION_WEIGHTS: unknown reaction ", key)
+			}
+			reputationPolicy.Weights[key] = weight
+		}
+	}
+	if value := os.Getenv("REPUTATION_HALF_LIFE_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil {
+			log.Fatal("REPUTATION_HALF_LIFE_DAYS must be a number")
+		}
+		reputationPolicy.HalfLife = time.Duration(days) * 24 * time.Hour
+	}
+	if value := os.Getenv("REPUTATION_THRESHOLDS"); value != "" {
+		thresholds, err := models.ParseReputationNumbers(value)
+		if err != nil {
+			log.Fatal("REPUTATION_THRESHOLDS: ", err)
+		}
+		for key, threshold := range thresholds {
+			reputationPolicy.Thresholds[key] = int(threshold)
+		}
+	}
+	models.SetReputationPolicy(reputationPolicy)
+
+	if secret := os.Getenv("FORUM_SECRET"); secret != "" {
+		models.SetTokenSecret([]byte(secret))
+	} else {
+		log.Println("FORUM_SECRET is not set, email links will stop working after a restart")
+	}
+
+	siteURL := os.Getenv("FORUM_BASE_URL")
+	if siteURL == "" {
+		siteURL = "http://localhost:8080"
+	}
+	handlers.SetMailer(mailer.FromEnv(), siteURL)
+
+	if path := os.Getenv("OIDC_CONFIG"); path != "" {
+		configs, err := oidc.LoadConfig(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var providers []*oidc.Provider
+		for _, config := range configs {
+			providers = append(providers, oidc.NewProvider(config, siteURL+"/oauth/callback"))
+		}
+		handlers.SetOAuthProviders(providers)
+	}
 
 	// Routes
 	http.HandleFunc("/", handlers.MainPageHandler)
-	http.HandleFunc("/register", handlers.RegisterHandler)
-	http.HandleFunc("/login", handlers.LoginHandler)
+	http.HandleFunc("/register", handlers.RateLimit("/register", handlers.RegisterHandler))
+	http.HandleFunc("/login", handlers.RateLimit("/login", handlers.LoginHandler))
+	http.HandleFunc("/login/two_factor", handlers.RateLimit("/login/two_factor", handlers.LoginTwoFactorHandler))
 	http.HandleFunc("/logout", handlers.LogoutHandler)
-	http.HandleFunc("/create_post", handlers.CreatePostHandler)
-	http.HandleFunc("/post", handlers.PostPageHandler)
-	http.HandleFunc("/like", handlers.LikeHandler)
-	http.HandleFunc("/dislike", handlers.DislikeHandler)
-	http.HandleFunc("/create_comment", handlers.CreateCommentHandler)
-	http.HandleFunc("/like_comment", handlers.LikeCommentHandler)
-	http.HandleFunc("/dislike_comment", handlers.DislikeCommentHandler)
+	http.HandleFunc("/two_factor", handlers.TwoFactorHandler)
+	http.HandleFunc("/two_factor/enable", handlers.RateLimit("/two_factor/enable", handlers.EnableTwoFactorHandler))
+	http.HandleFunc("/two_factor/disable", handlers.RateLimit("/two_factor/disable", handlers.DisableTwoFactorHandler))
+	http.HandleFunc("/two_factor/recovery_codes", handlers.RateLimit("/two_factor/recovery_codes", handlers.RecoveryCodesHandler))
+	http.HandleFunc("/oauth/login", handlers.RateLimit("/oauth/login", handlers.OAuthLoginHandler))
+	http.HandleFunc("/oauth/callback", handlers.OAuthCallbackHandler)
+	http.HandleFunc("/linked_accounts", handlers.LinkedAccountsHandler)
+	http.HandleFunc("/linked_accounts/unlink", handlers.UnlinkAccountHandler)
+	http.HandleFunc("/user/", handlers.ProfileHandler)
+	http.HandleFunc("/follow", handlers.RateLimit("/follow", handlers.FollowHandler))
+	http.HandleFunc("/follow_category", handlers.RateLimit("/follow_category", handlers.FollowCategoryHandler))
+	http.HandleFunc("/notifications", handlers.NotificationsHandler)
+	http.HandleFunc("/notifications/read", handlers.MarkNotificationsReadHandler)
+	http.HandleFunc("/notifications/preferences", handlers.NotificationPreferencesHandler)
+	http.HandleFunc("/settings", handlers.RateLimit("/settings", handlers.ProfileSettingsHandler))
+	http.HandleFunc("/admin", handlers.AdminHandler)
+	http.HandleFunc("/admin/settings", handlers.AdminSettingsHandler)
+	http.HandleFunc("/admin/reactions", handlers.AdminReactionsHandler)
+	http.HandleFunc("/admin/categories", handlers.AdminCategoriesHandler)
+	http.HandleFunc("/admin/roles", handlers.AdminRolesHandler)
+	http.HandleFunc("/verify_email", handlers.VerifyEmailHandler)
+	http.HandleFunc("/resend_verification", handlers.RateLimit("/resend_verification", handlers.ResendVerificationHandler))
+	http.HandleFunc("/forgot_password", handlers.RateLimit("/forgot_password", handlers.ForgotPasswordHandler))
+	http.HandleFunc("/reset_password", handlers.RateLimit("/reset_password", handlers.ResetPasswordHandler))
+	http.HandleFunc("/change_password", handlers.RateLimit("/change_password", handlers.ChangePasswordHandler))
+	http.HandleFunc("/create_post", handlers.RateLimit("/create_post", handlers.CreatePostHandler))
+	http.HandleFunc("/post", handlers.LegacyPostHandler)
+	http.HandleFunc("/posts/", handlers.PostPageHandler)
+	http.HandleFunc("/preview", handlers.RateLimit("/preview", handlers.PreviewHandler))
+	http.HandleFunc("/drafts", handlers.DraftsHandler)
+	http.HandleFunc("/drafts/save", handlers.RateLimit("/drafts/save", handlers.SaveDraftHandler))
+	http.HandleFunc("/drafts/delete", handlers.DeleteDraftHandler)
+	http.HandleFunc("/post/events", handlers.PostEventsHandler)
+	http.HandleFunc("/like", handlers.RateLimit("/like", handlers.LikeHandler))
+	http.HandleFunc("/dislike", handlers.RateLimit("/dislike", handlers.DislikeHandler))
+	http.HandleFunc("/create_comment", handlers.RateLimit("/create_comment", handlers.CreateCommentHandler))
+	http.HandleFunc("/like_comment", handlers.RateLimit("/like_comment", handlers.LikeCommentHandler))
+	http.HandleFunc("/dislike_comment", handlers.RateLimit("/dislike_comment", handlers.DislikeCommentHandler))
+	http.HandleFunc("/react", handlers.RateLimit("/react", handlers.ReactHandler))
+	http.HandleFunc("/poll/vote", handlers.RateLimit("/poll/vote", handlers.VoteHandler))
+	http.HandleFunc("/poll/events", handlers.PollEventsHandler)
+	http.HandleFunc("/moderate_post", handlers.ModeratePostHandler)
+	http.HandleFunc("/reactions", handlers.ReactionsHandler)
 	http.HandleFunc("/my_posts", handlers.MyPostsHandler)
 	http.HandleFunc("/liked_posts", handlers.LikedPostsHandler)
+	http.HandleFunc("/c/", handlers.CategoryPageHandler)
+	http.HandleFunc("/disliked_posts", handlers.DislikedPostsHandler)
+	http.HandleFunc("/commented_posts", handlers.CommentedPostsHandler)
+	http.HandleFunc("/mentioned_posts", handlers.MentionedPostsHandler)
+	http.HandleFunc("/activity", handlers.ActivityHandler)
+	http.HandleFunc("/bookmarks", handlers.BookmarksHandler)
+	http.HandleFunc("/bookmark", handlers.RateLimit("/bookmark", handlers.BookmarkHandler))
+	http.HandleFunc("/collections", handlers.RateLimit("/collections", handlers.CollectionsHandler))
+	http.HandleFunc("/tags/", handlers.TagPageHandler)
+	http.HandleFunc("/tag_suggestions", handlers.RateLimit("/tag_suggestions", handlers.TagSuggestionsHandler))
+	http.HandleFunc("/user_suggestions", handlers.RateLimit("/user_suggestions", handlers.UserSuggestionsHandler))
 	http.Handle("/ui/", http.StripPrefix("/ui/", http.FileServer(http.Dir("./ui"))))
 	http.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir("uploads"))))
 
+	go publishScheduledPosts(scheduledPostsInterval)
+	go archiveInactivePosts(archiveInterval)
+	go pruneLoginFailures(loginFailuresInterval)
+
 	log.Println("Server started on http://localhost:8080")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
+
+// scheduledPostsInterval is how often scheduled posts are checked; a post goes live at most this late.
+const scheduledPostsInterval = 30 * time.Second
+
+// publishScheduledPosts publishes the scheduled posts that are due, every interval.
+func publishScheduledPosts(interval time.Duration) {
+	for range time.Tick(interval) {
+		if _, err := models.PublishScheduledPosts(time.Now()); err != nil {
+			log.Println("Error publishing scheduled posts:", err)
+		}
+	}
+}
+
+// archiveInterval is how often inactive posts are archived.
+const archiveInterval = time.Hour
+
+// archiveInactivePosts archives the posts that have been inactive for the period set on the
+// admin page, every interval. The period is read each time, so changes apply without a restart.
+func archiveInactivePosts(interval time.Duration) {
+	for range time.Tick(interval) {
+		inactivity, err := models.ArchiveAfter()
+		if err != nil {
+			log.Println("Error reading the archiving period:", err)
+			continue
+		}
+		if inactivity == 0 {
+			continue
+		}
+		if _, err := models.ArchiveInactivePosts(time.Now(), inactivity); err != nil {
+			log.Println("Error archiving inactive posts:", err)
+		}
+	}
+}
+
+// loginFailuresInterval is how often failed logins that no longer count are deleted.
+const loginFailuresInterval = time.Hour
+
+// pruneLoginFailures deletes expired failed logins and lockouts, every interval.
+func pruneLoginFailures(interval time.Duration) {
+	for range time.Tick(interval) {
+		if _, err := models.PruneLoginFailures(time.Now()); err != nil {
+			log.Println("Error pruning failed logins:", err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"unicode/utf8"
+)
+
+// Kinds of activity on a user's timeline
+const (
+	ActivityPost     = "post"
+	ActivityComment  = "comment"
+	ActivityLike     = "like"
+	ActivityDislike  = "dislike"
+	ActivityReaction = "reaction"
+)
+
+// Activity is one entry of a user's timeline: something they posted, commented or reacted to.
+type Activity struct {
+	Kind               string
+	TargetType         string       // ReactionTargetPost or ReactionTargetComment
+	Reaction           ReactionType // the emoji reaction, for ActivityReaction
+	PostID             string
+	Excerpt            string // the start of the post or comment, as plain text
+	CreatedAtFormatted string // empty for reactions given before their time was recorded
+}
+
+const activityExcerptLength = 140
+
+// activityQuery selects (kind, target type, reaction, post ID, content, time) for everything a user did.
+// Each part keeps the DATETIME column as is, so the driver still returns it as a time.
+const activityQuery = `
+        SELECT 'post', 'post', '', posts.id, posts.content, posts.created_at
+        FROM posts WHERE posts.user_id = ?1
+        UNION ALL
+        SELECT 'comment', 'comment', '', comments.post_id, comments.content, comments.created_at
+        FROM comments WHERE comments.user_id = ?1
+        UNION ALL
+        SELECT CASE WHEN post_likes.is_like THEN 'like' ELSE 'dislike' END, 'post', '', posts.id, posts.content, post_likes.created_at
+        FROM post_likes JOIN posts ON post_likes.post_id = posts.id
+        WHERE post_likes.user_id = ?1
+        UNION ALL
+        SELECT CASE WHEN comment_likes.is_like THEN 'like' ELSE 'dislike' END, 'comment', '', comments.post_id, comments.content, comment_likes.created_at
+        FROM comment_likes JOIN comments ON comment_likes.comment_id = comments.id
+        WHERE comment_likes.user_id = ?1
+        UNION ALL
+        SELECT 'reaction', 'post', reactions.type, posts.id, posts.content, reactions.created_at
+        FROM reactions JOIN posts ON reactions.target_type = 'post' AND reactions.target_id = posts.id
+        WHERE reactions.user_id = ?1
+        UNION ALL
+        SELECT 'reaction', 'comment', reactions.type, comments.post_id, comments.content, reactions.created_at
+        FROM reactions JOIN comments ON reactions.target_type = 'comment' AND reactions.target_id = comments.id
+        WHERE reactions.user_id = ?1
+        ORDER BY 6 DESC
+        LIMIT ?2 OFFSET ?3`
+
+// GetUserActivity returns one page of the user's posts, comments and reactions, newest first,
+// and whether there are more.
+func GetUserActivity(userID string, page, perPage int) ([]Activity, bool, error) {
+	rows, err := db.Query(activityQuery, userID, perPage+1, (page-1)*perPage)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var activities []Activity
+	for rows.Next() {
+		var activity Activity
+		var reaction, content string
+		var createdAt sql.NullTime
+		err := rows.Scan(&activity.Kind, &activity.TargetType, &reaction, &activity.PostID, &content, &createdAt)
+		if err != nil {
+			return nil, false, err
+		}
+		if reaction != "" {
+			activity.Reaction = reactionTypeByKey(reaction)
+		}
+		activity.Excerpt = excerpt(content, activityExcerptLength)
+		if createdAt.Valid {
+			activity.CreatedAtFormatted = createdAt.Time.Format("02.01.2006 15:04")
+		}
+		activities = append(activities, activity)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(activities) > perPage
+	if hasMore {
+		activities = activities[:perPage]
+	}
+	return activities, hasMore, nil
+}
+
+// reactionTypeByKey returns the emoji reaction with the given key, enabled or not.
+func reactionTypeByKey(key string) ReactionType {
+	for _, reactionType := range EmojiReactionTypes {
+		if reactionType.Key == key {
+			return reactionType
+		}
+	}
+	return ReactionType{Key: key, Label: key}
+}
+
+// excerpt turns stored, escaped content into plain text of at most n characters.
+func excerpt(content string, n int) string {
+	return truncateText(plainText(content), n)
+}
+
+// truncateText shortens text to n characters, marking the cut with an ellipsis.
+func truncateText(text string, n int) string {
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	return strings.TrimRight(string([]rune(text)[:n]), " ") + "…"
+}
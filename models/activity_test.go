@@ -0,0 +1,96 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+)
+
+// createTestActivity has readerID like one post, dislike another and react to their own comment on it.
+func createTestActivity(t *testing.T, readerID, authorID string) (likedID, dislikedID string) {
+	t.Helper()
+	likedID = createTestPost(t, authorID, "Liked post")
+	dislikedID = createTestPost(t, authorID, "Disliked post")
+	if err := LikePost(readerID, likedID); err != nil {
+		t.Fatal(err)
+	}
+	if err := DislikePost(readerID, dislikedID); err != nil {
+		t.Fatal(err)
+	}
+	commentID, err := CreateComment(dislikedID, readerID, "I &amp; my comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ToggleEmojiReaction(readerID, ReactionTargetComment, commentID, "funny"); err != nil {
+		t.Fatal(err)
+	}
+	return likedID, dislikedID
+}
+
+func TestPostsByUserFilters(t *testing.T) {
+	setupTestDB(t)
+
+	readerID := registerTestUser(t, "reader")
+	authorID := registerTestUser(t, "author")
+	likedID, dislikedID := createTestActivity(t, readerID, authorID)
+
+	// Each filter only holds its own posts
+	tests := []struct {
+		name  string
+		fetch func(string) ([]Post, error)
+		want  string
+	}{
+		{"liked", GetLikedPostsByUser, likedID},
+		{"disliked", GetDislikedPostsByUser, dislikedID},
+		{"commented", GetCommentedPostsByUser, dislikedID},
+	}
+	for _, test := range tests {
+		posts, err := test.fetch(readerID)
+		if err != nil || len(posts) != 1 || posts[0].ID != test.want {
+			t.Errorf("%s: expected only post %s; got %v (%v)", test.name, test.want, posts, err)
+		}
+	}
+}
+
+func TestGetUserActivity(t *testing.T) {
+	setupTestDB(t)
+
+	readerID := registerTestUser(t, "reader")
+	authorID := registerTestUser(t, "author")
+	createTestActivity(t, readerID, authorID)
+
+	// The timeline merges everything, newest first, with plain text excerpts
+	activities, hasMore, err := GetUserActivity(readerID, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, activity := range activities {
+		got = append(got, activity.Kind+" "+activity.TargetType)
+		if activity.CreatedAtFormatted == "" {
+			t.Errorf("%s: expected a date", activity.Kind)
+		}
+	}
+	want := []string{"reaction comment", "comment comment", "dislike post", "like post"}
+	if fmt.Sprint(got) != fmt.Sprint(want) || hasMore {
+		t.Fatalf("expected %v; got %v (more: %v)", want, got, hasMore)
+	}
+	if activities[0].Reaction.Key != "funny" || activities[1].Excerpt != "I & my comment" {
+		t.Errorf("unexpected entries: %+v, %+v", activities[0], activities[1])
+	}
+
+	// Pages
+	tests := []struct {
+		page     int
+		wantLen  int
+		wantMore bool
+	}{
+		{1, 3, true},
+		{2, 1, false},
+	}
+	for _, test := range tests {
+		activities, hasMore, err := GetUserActivity(readerID, test.page, 3)
+		if err != nil || len(activities) != test.wantLen || hasMore != test.wantMore {
+			t.Errorf("page %d: expected %d entries, more %v; got %d, %v (%v)", test.page, test.wantLen, test.wantMore, len(activities), hasMore, err)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+)
+
+// Limits on reading lists.
+const (
+	MaxCollectionNameLength = 50
+	MaxCollectionsPerUser   = 50
+)
+
+var (
+	ErrCollectionName     = errors.New("list names must be between 1 and 50 characters")
+	ErrCollectionExists   = errors.New("you already have a list with this name")
+	ErrTooManyCollections = errors.New("you cannot create more lists")
+)
+
+// Collection is a named reading list of bookmarks. Bookmarks outside any list have an empty collection ID.
+type Collection struct {
+	ID        string
+	UserID    string
+	Owner     string // username of the owner
+	Name      string
+	IsPublic  bool
+	ItemCount int
+}
+
+// CreateCollection creates a named reading list for the user and returns its ID.
+func CreateCollection(userID, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > MaxCollectionNameLength {
+		return "", ErrCollectionName
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM collections WHERE user_id = ?", userID).Scan(&count); err != nil {
+		return "", err
+	}
+	if count >= MaxCollectionsPerUser {
+		return "", ErrTooManyCollections
+	}
+
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM collections WHERE user_id = ? AND name = ?)", userID, name).Scan(&exists)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "", ErrCollectionExists
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+	_, err = db.Exec("INSERT INTO collections (id, user_id, name, is_public, created_at) VALUES (?, ?, ?, FALSE, ?)",
+		id.String(), userID, name, time.Now())
+	return id.String(), err
+}
+
+// DeleteCollection removes one of the user's lists together with its bookmarks.
+func DeleteCollection(userID, collectionID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM collections WHERE id = ? AND user_id = ?", collectionID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.Exec("DELETE FROM bookmarks WHERE collection_id = ? AND user_id = ?", collectionID, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetCollectionPublic shares one of the user's lists with everyone who has its link, or makes it private again.
+func SetCollectionPublic(userID, collectionID string, public bool) error {
+	result, err := db.Exec("UPDATE collections SET is_public = ? WHERE id = ? AND user_id = ?", public, collectionID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetCollections returns the user's lists in alphabetical order with their number of bookmarks.
+func GetCollections(userID string) ([]Collection, error) {
+	rows, err := db.Query(`
+        SELECT collections.id, collections.user_id, users.username, collections.name, collections.is_public,
+               (SELECT COUNT(*) FROM bookmarks WHERE bookmarks.collection_id = collections.id)
+        FROM collections
+        JOIN users ON collections.user_id = users.id
+        WHERE collections.user_id = ?
+        ORDER BY collections.name COLLATE NOCASE
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []Collection
+	for rows.Next() {
+		var c Collection
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Owner, &c.Name, &c.IsPublic, &c.ItemCount); err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+	return collections, rows.Err()
+}
+
+// GetCollection retrieves a list by ID.
+func GetCollection(collectionID string) (Collection, error) {
+	var c Collection
+	err := db.QueryRow(`
+        SELECT collections.id, collections.user_id, users.username, collections.name, collections.is_public,
+               (SELECT COUNT(*) FROM bookmarks WHERE bookmarks.collection_id = collections.id)
+        FROM collections
+        JOIN users ON collections.user_id = users.id
+        WHERE collections.id = ?
+    `, collectionID).Scan(&c.ID, &c.UserID, &c.Owner, &c.Name, &c.IsPublic, &c.ItemCount)
+	return c, err
+}
+
+// ToggleBookmark saves a post or comment to one of the user's lists (or to no list when collectionID
+// is empty), or removes it when it is already there. It reports whether the item is bookmarked afterwards.
+func ToggleBookmark(userID, collectionID, targetType, targetID string) (bool, error) {
+	if collectionID != "" {
+		collection, err := GetCollection(collectionID)
+		if err != nil {
+			return false, err
+		}
+		if collection.UserID != userID {
+			return false, sql.ErrNoRows
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM bookmarks WHERE user_id = ? AND collection_id = ? AND target_type = ? AND target_id = ?",
+		userID, collectionID, targetType, targetID)
+	if err != nil {
+		return false, err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if removed == 0 {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return false, err
+		}
+		_, err = tx.Exec("INSERT INTO bookmarks (id, user_id, collection_id, target_type, target_id, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+			id.String(), userID, collectionID, targetType, targetID, time.Now())
+		if err != nil {
+			return false, err
+		}
+	}
+	return removed == 0, tx.Commit()
+}
+
+// GetBookmarkedPosts returns one page of the posts in a list, most recently saved first.
+func GetBookmarkedPosts(userID, collectionID string, page, perPage int) ([]Post, bool, error) {
+	rows, err := db.Query(`
+        SELECT posts.id, posts.content, posts.created_at, posts.likes, posts.dislikes, posts.image_path, posts.title, posts.spoiler_for, posts.locked, posts.archived_at, users.username
+        FROM bookmarks
+        JOIN posts ON bookmarks.target_type = 'post' AND bookmarks.target_id = posts.id
+        JOIN users ON posts.user_id = users.id
+        WHERE bookmarks.user_id = ? AND bookmarks.collection_id = ?
+        ORDER BY bookmarks.created_at DESC
+        LIMIT ? OFFSET ?
+    `, userID, collectionID, perPage+1, (page-1)*perPage)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	posts, err := scanPosts(rows)
+	if err != nil {
+		return nil, false, err
+	}
+	hasMore := len(posts) > perPage
+	if hasMore {
+		posts = posts[:perPage]
+	}
+	return posts, hasMore, nil
+}
+
+// GetBookmarkedComments returns one page of the comments in a list, most recently saved first.
+func GetBookmarkedComments(userID, collectionID string, page, perPage int) ([]Comment, bool, error) {
+	rows, err := db.Query(`
+        SELECT comments.id, comments.post_id, comments.content, comments.created_at, users.username, comments.likes, comments.dislikes
+        FROM bookmarks
+        JOIN comments ON bookmarks.target_type = 'comment' AND bookmarks.target_id = comments.id
+        JOIN users ON comments.user_id = users.id
+        WHERE bookmarks.user_id = ? AND bookmarks.collection_id = ?
+        ORDER BY bookmarks.created_at DESC
+        LIMIT ? OFFSET ?
+    `, userID, collectionID, perPage+1, (page-1)*perPage)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		var comment Comment
+		var createdAt time.Time
+		err := rows.Scan(&comment.ID, &comment.PostID, &comment.Content, &createdAt, &comment.Author, &comment.Likes, &comment.Dislikes)
+		if err != nil {
+			return nil, false, err
+		}
+		comment.CreatedAtFormatted = createdAt.Format("02.01.2006 15:04")
+		comment.Content = RenderContent(string(comment.Content))
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(comments) > perPage
+	if hasMore {
+		comments = comments[:perPage]
+	}
+	return comments, hasMore, nil
+}
+
+// bookmarkedTargets returns which of the targets the user has saved in any list.
+func bookmarkedTargets(userID, targetType string, targetIDs []string) (map[string]bool, error) {
+	bookmarked := make(map[string]bool)
+	if userID == "" || len(targetIDs) == 0 {
+		return bookmarked, nil
+	}
+	args := []interface{}{userID, targetType}
+	for _, id := range targetIDs {
+		args = append(args, id)
+	}
+	rows, err := db.Query("SELECT DISTINCT target_id FROM bookmarks WHERE user_id = ? AND target_type = ? AND target_id IN ("+placeholders(len(targetIDs))+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		bookmarked[id] = true
+	}
+	return bookmarked, rows.Err()
+}
+
+// LoadPostBookmarks marks the posts the user has bookmarked.
+func LoadPostBookmarks(userID string, posts []Post) error {
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	bookmarked, err := bookmarkedTargets(userID, ReactionTargetPost, ids)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].Bookmarked = bookmarked[posts[i].ID]
+	}
+	return nil
+}
+
+// LoadCommentBookmarks marks the comments the user has bookmarked.
+func LoadCommentBookmarks(userID string, comments []Comment) error {
+	ids := make([]string, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+	bookmarked, err := bookmarkedTargets(userID, ReactionTargetComment, ids)
+	if err != nil {
+		return err
+	}
+	for i := range comments {
+		comments[i].Bookmarked = bookmarked[comments[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+)
+
+func TestCreateCollection(t *testing.T) {
+	setupTestDB(t)
+
+	readerID := registerTestUser(t, "reader")
+	otherID := registerTestUser(t, "other")
+	if _, err := CreateCollection(readerID, "  To read "); err != nil {
+		t.Fatal(err)
+	}
+
+	// Names are validated and unique per user
+	tests := []struct {
+		name    string
+		userID  string
+		list    string
+		wantErr error
+	}{
+		{"same name", readerID, "To read", ErrCollectionExists},
+		{"blank name", readerID, " ", ErrCollectionName},
+		{"another user", otherID, "To read", nil},
+	}
+	for _, test := range tests {
+		if _, err := CreateCollection(test.userID, test.list); err != test.wantErr {
+			t.Errorf("%s: expected %v; got %v", test.name, test.wantErr, err)
+		}
+	}
+}
+
+// createBookmarkedPosts creates three posts and bookmarks them in a new list of readerID,
+// returning the list and the posts, oldest first.
+func createBookmarkedPosts(t *testing.T, readerID, otherID string) (string, []string) {
+	t.Helper()
+	listID, err := CreateCollection(readerID, "To read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var postIDs []string
+	for i := 0; i < 3; i++ {
+		postID := createTestPost(t, otherID, fmt.Sprintf("Post %d", i))
+		if bookmarked, err := ToggleBookmark(readerID, listID, ReactionTargetPost, postID); err != nil || !bookmarked {
+			t.Fatalf("expected the post to be bookmarked; got %v (%v)", bookmarked, err)
+		}
+		postIDs = append(postIDs, postID)
+	}
+	return listID, postIDs
+}
+
+func TestToggleBookmark(t *testing.T) {
+	setupTestDB(t)
+
+	readerID := registerTestUser(t, "reader")
+	otherID := registerTestUser(t, "other")
+	listID, postIDs := createBookmarkedPosts(t, readerID, otherID)
+	commentID, err := CreateComment(postIDs[0], otherID, "A comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bookmarks toggle, lists are kept apart, and other users' lists are refused
+	tests := []struct {
+		name           string
+		userID         string
+		listID         string
+		targetType     string
+		targetID       string
+		wantBookmarked bool
+		wantErr        error
+	}{
+		{"repeated", readerID, listID, ReactionTargetPost, postIDs[1], false, nil},
+		{"comment without a list", readerID, "", ReactionTargetComment, commentID, true, nil},
+		{"another user's list", otherID, listID, ReactionTargetPost, postIDs[0], false, sql.ErrNoRows},
+	}
+	for _, test := range tests {
+		bookmarked, err := ToggleBookmark(test.userID, test.listID, test.targetType, test.targetID)
+		if err != test.wantErr || bookmarked != test.wantBookmarked {
+			t.Errorf("%s: expected %v (%v); got %v (%v)", test.name, test.wantBookmarked, test.wantErr, bookmarked, err)
+		}
+	}
+
+	comments, _, err := GetBookmarkedComments(readerID, "", 1, 10)
+	if err != nil || len(comments) != 1 || comments[0].ID != commentID {
+		t.Errorf("expected the saved comment; got %v (%v)", comments, err)
+	}
+	posts := []Post{{ID: postIDs[0]}, {ID: postIDs[1]}}
+	if err := LoadPostBookmarks(readerID, posts); err != nil {
+		t.Fatal(err)
+	}
+	if !posts[0].Bookmarked || posts[1].Bookmarked {
+		t.Errorf("unexpected bookmark flags: %v, %v", posts[0].Bookmarked, posts[1].Bookmarked)
+	}
+}
+
+func TestGetBookmarkedPosts(t *testing.T) {
+	setupTestDB(t)
+
+	readerID := registerTestUser(t, "reader")
+	otherID := registerTestUser(t, "other")
+	listID, postIDs := createBookmarkedPosts(t, readerID, otherID)
+
+	// Pages hold the most recently saved first
+	tests := []struct {
+		page     int
+		want     string
+		wantMore bool
+	}{
+		{1, postIDs[2], true},
+		{2, postIDs[1], true},
+		{3, postIDs[0], false},
+	}
+	for _, test := range tests {
+		posts, hasMore, err := GetBookmarkedPosts(readerID, listID, test.page, 1)
+		if err != nil || len(posts) != 1 || posts[0].ID != test.want || hasMore != test.wantMore {
+			t.Errorf("page %d: unexpected %v, %v (%v)", test.page, posts, hasMore, err)
+		}
+	}
+}
+
+func TestCollectionSharingAndDeletion(t *testing.T) {
+	setupTestDB(t)
+
+	readerID := registerTestUser(t, "reader")
+	otherID := registerTestUser(t, "other")
+	listID, _ := createBookmarkedPosts(t, readerID, otherID)
+
+	// Sharing is limited to the owner, and deleting a list drops its bookmarks
+	if err := SetCollectionPublic(otherID, listID, true); err != sql.ErrNoRows {
+		t.Errorf("expected another user to be refused; got %v", err)
+	}
+	if err := SetCollectionPublic(readerID, listID, true); err != nil {
+		t.Fatal(err)
+	}
+	collection, err := GetCollection(listID)
+	if err != nil || !collection.IsPublic || collection.Owner != "reader" || collection.ItemCount != 3 {
+		t.Errorf("unexpected list: %+v (%v)", collection, err)
+	}
+	if err := DeleteCollection(readerID, listID); err != nil {
+		t.Fatal(err)
+	}
+	posts, _, err := GetBookmarkedPosts(readerID, listID, 1, 10)
+	if err != nil || len(posts) != 0 {
+		t.Errorf("expected the list's bookmarks to be gone; got %v (%v)", posts, err)
+	}
+}
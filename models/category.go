@@ -0,0 +1,397 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+)
+
+const MaxCategoryNameLength = 50
+
+var (
+	ErrCategoryName     = errors.New("category names must be between 1 and 50 characters")
+	ErrCategoryExists   = errors.New("a category with this name already exists")
+	ErrCategorySlugUsed = errors.New("another category already uses this slug")
+	ErrMergeIntoItself  = errors.New("a category cannot be merged into itself")
+	ErrCategoryCycle    = errors.New("a category cannot be placed under itself or its subcategories")
+)
+
+type Category struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Slug        string `json:"slug"` // used in /c/<slug> links
+	Description string `json:"description"`
+	ParentID    string `json:"parent_id"`  // empty for top-level categories
+	Position    int    `json:"position"`   // order among the categories with the same parent
+	Archived    bool   `json:"archived"`   // archived categories keep their posts but take no new ones
+	PostCount   int    `json:"post_count"` // posts in the category and its subcategories
+	Depth       int    `json:"depth"`      // nesting level in ListCategories
+}
+
+// categorySubtree selects the ID bound to ? and the IDs of all the categories below it.
+const categorySubtree = `
+        WITH RECURSIVE subtree(id) AS (
+            SELECT ?
+            UNION SELECT categories.id FROM categories JOIN subtree ON categories.parent_id = subtree.id
+        ) SELECT id FROM subtree`
+
+const categoryColumns = `
+        categories.id, categories.name, COALESCE(categories.slug, ''), COALESCE(categories.description, ''),
+        COALESCE(categories.parent_id, ''), categories.position, categories.archived,
+        (SELECT COUNT(DISTINCT post_id) FROM post_categories
+         JOIN posts ON posts.id = post_categories.post_id
+         WHERE posts.publish_at IS NULL AND category_id IN (
+            WITH RECURSIVE subtree(id) AS (
+                SELECT categories.id
+                UNION SELECT children.id FROM categories AS children JOIN subtree ON children.parent_id = subtree.id
+            ) SELECT id FROM subtree))`
+
+func scanCategory(row interface{ Scan(...interface{}) error }) (Category, error) {
+	var c Category
+	err := row.Scan(&c.ID, &c.Name, &c.Slug, &c.Description, &c.ParentID, &c.Position, &c.Archived, &c.PostCount)
+	return c, err
+}
+
+// GetAllCategories returns the categories that take new posts, in display order, with their post counts.
+func GetAllCategories() ([]Category, error) {
+	return ListCategories(false)
+}
+
+// ListCategories returns the categories in display order, each followed by its subcategories,
+// with their post counts. Archived categories are included when asked to.
+func ListCategories(includeArchived bool) ([]Category, error) {
+	query := "SELECT " + categoryColumns + " FROM categories"
+	if !includeArchived {
+		query += " WHERE NOT categories.archived"
+	}
+	rows, err := db.Query(query + " ORDER BY categories.position, categories.name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []Category
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return categoryTree(categories), nil
+}
+
+// categoryTree orders the categories so each one is followed by its subcategories, and sets their depth.
+// Categories whose parent is not in the list are shown at the top level.
+func categoryTree(categories []Category) []Category {
+	listed := make(map[string]bool)
+	for _, category := range categories {
+		listed[category.ID] = true
+	}
+	children := make(map[string][]Category)
+	for _, category := range categories {
+		parent := category.ParentID
+		if !listed[parent] {
+			parent = ""
+		}
+		children[parent] = append(children[parent], category)
+	}
+
+	var tree []Category
+	var add func(parent string, depth int)
+	add = func(parent string, depth int) {
+		for _, category := range children[parent] {
+			category.Depth = depth
+			tree = append(tree, category)
+			add(category.ID, depth+1)
+		}
+	}
+	add("", 0)
+	return tree
+}
+
+// GetCategory retrieves a category by ID.
+func GetCategory(categoryID string) (Category, error) {
+	return scanCategory(db.QueryRow("SELECT "+categoryColumns+" FROM categories WHERE categories.id = ?", categoryID))
+}
+
+// GetCategoryBySlug retrieves a category by its slug.
+func GetCategoryBySlug(slug string) (Category, error) {
+	return scanCategory(db.QueryRow("SELECT "+categoryColumns+" FROM categories WHERE categories.slug = ?", slug))
+}
+
+// Slugify turns a category name into the lowercase, dash-separated form used in URLs.
+func Slugify(name string) string {
+	if slug := slugWords(name); slug != "" {
+		return slug
+	}
+	return "category"
+}
+
+// slugWords lowercases the letters and digits of s and joins the words with dashes.
+func slugWords(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// uniqueSlug returns the slug, or the slug with a number appended, that no other category uses.
+func uniqueSlug(slug, categoryID string) (string, error) {
+	candidate := slug
+	for n := 2; ; n++ {
+		var taken bool
+		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE slug = ? AND id != ?)", candidate, categoryID).Scan(&taken)
+		if err != nil || !taken {
+			return candidate, err
+		}
+		candidate = slug + "-" + strconv.Itoa(n)
+	}
+}
+
+func validCategoryName(name string) bool {
+	return name != "" && utf8.RuneCountInString(name) <= MaxCategoryNameLength
+}
+
+// CreateCategory adds a category at the end of the list and returns its ID.
+func CreateCategory(name, description string) (string, error) {
+	name = strings.TrimSpace(name)
+	if !validCategoryName(name) {
+		return "", ErrCategoryName
+	}
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE name = ?)", name).Scan(&exists); err != nil {
+		return "", err
+	}
+	if exists {
+		return "", ErrCategoryExists
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+	slug, err := uniqueSlug(Slugify(name), id.String())
+	if err != nil {
+		return "", err
+	}
+	_, err = db.Exec(`
+        INSERT INTO categories (id, name, slug, description, position, archived)
+        VALUES (?, ?, ?, ?, (SELECT COALESCE(MAX(position), 0) + 1 FROM categories), FALSE)
+    `, id.String(), name, slug, strings.TrimSpace(description))
+	return id.String(), err
+}
+
+// UpdateCategory renames a category and changes its slug, description and parent.
+// An empty slug is derived from the name; an empty parent makes it a top-level category.
+func UpdateCategory(categoryID, name, slug, description, parentID string) error {
+	name = strings.TrimSpace(name)
+	if !validCategoryName(name) {
+		return ErrCategoryName
+	}
+	if strings.TrimSpace(slug) == "" {
+		slug = name
+	}
+	slug = Slugify(slug)
+
+	var nameTaken, slugTaken bool
+	err := db.QueryRow(`
+        SELECT EXISTS(SELECT 1 FROM categories WHERE name = ? AND id != ?),
+               EXISTS(SELECT 1 FROM categories WHERE slug = ? AND id != ?)
+    `, name, categoryID, slug, categoryID).Scan(&nameTaken, &slugTaken)
+	if err != nil {
+		return err
+	}
+	if nameTaken {
+		return ErrCategoryExists
+	}
+	if slugTaken {
+		return ErrCategorySlugUsed
+	}
+
+	if parentID != "" {
+		var exists, cycle bool
+		err := db.QueryRow(`
+            SELECT EXISTS(SELECT 1 FROM categories WHERE id = ?), ? IN (`+categorySubtree+`)
+        `, parentID, parentID, categoryID).Scan(&exists, &cycle)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return sql.ErrNoRows
+		}
+		if cycle {
+			return ErrCategoryCycle
+		}
+	}
+
+	result, err := db.Exec("UPDATE categories SET name = ?, slug = ?, description = ?, parent_id = ? WHERE id = ?",
+		name, slug, strings.TrimSpace(description), parentID, categoryID)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result)
+}
+
+// MoveCategory moves a category one place up or down among the categories with the same parent.
+func MoveCategory(categoryID string, up bool) error {
+	category, err := GetCategory(categoryID)
+	if err != nil {
+		return err
+	}
+	all, err := ListCategories(true)
+	if err != nil {
+		return err
+	}
+	var categories []Category
+	index := -1
+	for _, sibling := range all {
+		if sibling.ParentID == category.ParentID {
+			if sibling.ID == categoryID {
+				index = len(categories)
+			}
+			categories = append(categories, sibling)
+		}
+	}
+	other := index + 1
+	if up {
+		other = index - 1
+	}
+	if other < 0 || other >= len(categories) {
+		return nil
+	}
+	categories[index], categories[other] = categories[other], categories[index]
+
+	// Positions are rewritten for every sibling so older rows that share a position get a distinct one
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i, category := range categories {
+		if _, err := tx.Exec("UPDATE categories SET position = ? WHERE id = ?", i+1, category.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SetCategoryArchived archives a category, or brings it back. Archived categories keep their posts
+// and stay reachable by link, but are hidden from the sidebar and the new post form.
+func SetCategoryArchived(categoryID string, archived bool) error {
+	result, err := db.Exec("UPDATE categories SET archived = ? WHERE id = ?", archived, categoryID)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result)
+}
+
+// MergeCategories moves every post, follower and subcategory of the source category to the target
+// and deletes the source. Posts and users already in both keep a single link to the target.
+func MergeCategories(sourceID, targetID string) error {
+	if sourceID == targetID {
+		return ErrMergeIntoItself
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var found int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM categories WHERE id IN (?, ?)", sourceID, targetID).Scan(&found); err != nil {
+		return err
+	}
+	if found != 2 {
+		return sql.ErrNoRows
+	}
+
+	statements := []string{
+		// A target below the source first takes the source's place, so no category ends up under itself
+		`UPDATE categories SET parent_id = (SELECT parent_id FROM categories WHERE id = ?1)
+         WHERE id = ?2 AND ?2 IN (
+             WITH RECURSIVE subtree(id) AS (
+                 SELECT ?1
+                 UNION SELECT categories.id FROM categories JOIN subtree ON categories.parent_id = subtree.id
+             ) SELECT id FROM subtree)`,
+		"UPDATE categories SET parent_id = ?2 WHERE parent_id = ?1",
+		"INSERT OR IGNORE INTO post_categories (post_id, category_id) SELECT post_id, ?2 FROM post_categories WHERE category_id = ?1",
+		"DELETE FROM post_categories WHERE category_id = ?1",
+		"INSERT OR IGNORE INTO category_follows (user_id, category_id, created_at) SELECT user_id, ?2, created_at FROM category_follows WHERE category_id = ?1",
+		"DELETE FROM category_follows WHERE category_id = ?1",
+		"INSERT OR IGNORE INTO pinned_posts (post_id, category_id, pinned_at) SELECT post_id, ?2, pinned_at FROM pinned_posts WHERE category_id = ?1",
+		"DELETE FROM pinned_posts WHERE category_id = ?1",
+		"DELETE FROM categories WHERE id = ?1",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, sourceID, targetID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// BackfillCategorySlugs gives a slug and a position to categories created before they existed.
+func BackfillCategorySlugs() error {
+	rows, err := db.Query("SELECT id, name FROM categories WHERE slug IS NULL OR slug = '' ORDER BY name")
+	if err != nil {
+		return err
+	}
+	type category struct{ id, name string }
+	var categories []category
+	for rows.Next() {
+		var c category
+		if err := rows.Scan(&c.id, &c.name); err != nil {
+			rows.Close()
+			return err
+		}
+		categories = append(categories, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, c := range categories {
+		slug, err := uniqueSlug(Slugify(c.name), c.id)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("UPDATE categories SET slug = ?, position = (SELECT COALESCE(MAX(position), 0) + 1 FROM categories) WHERE id = ?", slug, c.id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expectOneRow returns sql.ErrNoRows when a statement did not change any row.
+func expectOneRow(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
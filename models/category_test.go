@@ -0,0 +1,280 @@
+package models
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Fantasy", "fantasy"},
+		{"Science Fiction", "science-fiction"},
+		{"  Sci-Fi & Fantasy!  ", "sci-fi-fantasy"},
+		{"Классика", "классика"},
+		{"2024 Picks", "2024-picks"},
+		{"!!!", "category"},
+	}
+	for _, test := range tests {
+		if got := Slugify(test.name); got != test.want {
+			t.Errorf("Slugify(%q) = %q; want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDefaultCategories(t *testing.T) {
+	setupTestDB(t)
+
+	// The default categories come with slugs, in order
+	categories, err := GetAllCategories()
+	if err != nil || len(categories) < 3 {
+		t.Fatalf("expected the default categories; got %v (%v)", categories, err)
+	}
+	if categories[2].Name != "Science Fiction" || categories[2].Slug != "science-fiction" {
+		t.Errorf("unexpected third category: %+v", categories[2])
+	}
+}
+
+func TestCreateAndUpdateCategory(t *testing.T) {
+	setupTestDB(t)
+
+	epicID, err := CreateCategory("Epic  Fantasy!", "Long books")
+	if err != nil {
+		t.Fatal(err)
+	}
+	epic, err := GetCategory(epicID)
+	if err != nil || epic.Slug != "epic-fantasy" || epic.Description != "Long books" {
+		t.Errorf("unexpected new category: %+v (%v)", epic, err)
+	}
+	if _, err := CreateCategory("Fantasy", ""); err != ErrCategoryExists {
+		t.Errorf("expected ErrCategoryExists; got %v", err)
+	}
+
+	// Slugs are unique, and follow the name unless one is given
+	tests := []struct {
+		name     string
+		slug     string
+		wantErr  error
+		wantSlug string
+	}{
+		{"Epic", "Fantasy", ErrCategorySlugUsed, "epic-fantasy"},
+		{"Epic", "", nil, "epic"},
+		{"Epic", "big-books", nil, "big-books"},
+	}
+	for _, test := range tests {
+		if err := UpdateCategory(epicID, test.name, test.slug, "", ""); err != test.wantErr {
+			t.Errorf("slug %q: expected %v; got %v", test.slug, test.wantErr, err)
+		}
+		if epic, _ := GetCategory(epicID); epic.Slug != test.wantSlug {
+			t.Errorf("slug %q: expected the slug %q; got %q", test.slug, test.wantSlug, epic.Slug)
+		}
+	}
+}
+
+func TestMoveCategory(t *testing.T) {
+	setupTestDB(t)
+
+	epicID, err := CreateCategory("Epic", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Moving up swaps places with the previous category
+	if err := MoveCategory(epicID, true); err != nil {
+		t.Fatal(err)
+	}
+	categories, err := GetAllCategories()
+	if err != nil || categories[len(categories)-2].ID != epicID {
+		t.Errorf("expected Epic to be second to last; got %v (%v)", categories, err)
+	}
+}
+
+func TestSetCategoryArchived(t *testing.T) {
+	setupTestDB(t)
+
+	epicID, err := CreateCategory("Epic", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetCategoryArchived(epicID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Archived categories are hidden but still reachable
+	categories, err := GetAllCategories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, category := range categories {
+		if category.ID == epicID {
+			t.Error("expected the archived category to be hidden")
+		}
+	}
+	if epic, err := GetCategoryBySlug("epic"); err != nil || !epic.Archived {
+		t.Errorf("expected the archived category by slug; got %+v (%v)", epic, err)
+	}
+}
+
+func TestMergeCategories(t *testing.T) {
+	setupTestDB(t)
+
+	fantasy, err := GetCategoryBySlug("fantasy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	epicID, err := CreateCategory("Epic", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorID := registerTestUser(t, "author")
+	bothID := createTestPost(t, authorID, "In both")
+	onlyEpicID := createTestPost(t, authorID, "Only epic")
+	for _, link := range [][2]string{{bothID, epicID}, {bothID, fantasy.ID}, {onlyEpicID, epicID}} {
+		if err := AddCategoryToPost(link[0], link[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, categoryID := range []string{epicID, fantasy.ID} {
+		if err := FollowCategory(authorID, categoryID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Merging moves posts and followers without duplicates
+	if err := MergeCategories(epicID, epicID); err != ErrMergeIntoItself {
+		t.Errorf("expected ErrMergeIntoItself; got %v", err)
+	}
+	if err := MergeCategories(epicID, fantasy.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetCategory(epicID); err != sql.ErrNoRows {
+		t.Errorf("expected the merged category to be gone; got %v", err)
+	}
+	if fantasy, _ = GetCategory(fantasy.ID); fantasy.PostCount != 2 {
+		t.Errorf("expected 2 posts in Fantasy; got %d", fantasy.PostCount)
+	}
+	followed, err := GetFollowedCategoryIDs(authorID)
+	if err != nil || len(followed) != 1 || !followed[fantasy.ID] {
+		t.Errorf("expected only Fantasy to be followed; got %v (%v)", followed, err)
+	}
+}
+
+// createCategoryTree puts Epic Fantasy under Fantasy and Grimdark under Epic Fantasy.
+func createCategoryTree(t *testing.T) (fantasyID, epicID, grimdarkID string) {
+	t.Helper()
+	fantasy, err := GetCategoryBySlug("fantasy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epicID, err = CreateCategory("Epic Fantasy", ""); err != nil {
+		t.Fatal(err)
+	}
+	if grimdarkID, err = CreateCategory("Grimdark", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateCategory(epicID, "Epic Fantasy", "", "", fantasy.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateCategory(grimdarkID, "Grimdark", "", "", epicID); err != nil {
+		t.Fatal(err)
+	}
+	return fantasy.ID, epicID, grimdarkID
+}
+
+func TestSubcategoryOrder(t *testing.T) {
+	setupTestDB(t)
+
+	fantasyID, epicID, grimdarkID := createCategoryTree(t)
+
+	// Subcategories follow their parent in the list, one level deeper
+	categories, err := GetAllCategories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, category := range categories {
+		if category.ID == fantasyID {
+			if i+2 >= len(categories) || categories[i+1].ID != epicID || categories[i+2].ID != grimdarkID {
+				t.Fatalf("expected Epic Fantasy and Grimdark under Fantasy; got %v", categories)
+			}
+			if categories[i+1].Depth != 1 || categories[i+2].Depth != 2 {
+				t.Errorf("unexpected depths %d and %d", categories[i+1].Depth, categories[i+2].Depth)
+			}
+		}
+	}
+}
+
+func TestCategoryParentValidation(t *testing.T) {
+	setupTestDB(t)
+
+	fantasyID, epicID, grimdarkID := createCategoryTree(t)
+
+	// A category cannot be moved under itself, its subcategories or an unknown category
+	tests := []struct {
+		name       string
+		categoryID string
+		parentID   string
+		wantErr    error
+	}{
+		{"itself", fantasyID, fantasyID, ErrCategoryCycle},
+		{"subcategory", fantasyID, grimdarkID, ErrCategoryCycle},
+		{"unknown parent", epicID, "missing", sql.ErrNoRows},
+	}
+	for _, test := range tests {
+		category, err := GetCategory(test.categoryID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := UpdateCategory(test.categoryID, category.Name, "", "", test.parentID); err != test.wantErr {
+			t.Errorf("%s: expected %v; got %v", test.name, test.wantErr, err)
+		}
+	}
+}
+
+func TestSubcategoryPosts(t *testing.T) {
+	setupTestDB(t)
+
+	fantasyID, epicID, grimdarkID := createCategoryTree(t)
+	authorID := registerTestUser(t, "author")
+	postID := createTestPost(t, authorID, "A grim tale")
+	for _, categoryID := range []string{grimdarkID, epicID} {
+		if err := AddCategoryToPost(postID, categoryID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A category lists the posts of its subcategories, and counts them once
+	posts, err := GetFilteredPosts(PostFilter{CategoryIDs: []string{fantasyID}})
+	if err != nil || len(posts) != 1 || posts[0].ID != postID {
+		t.Errorf("expected the post under Fantasy; got %v (%v)", posts, err)
+	}
+	if fantasy, err := GetCategory(fantasyID); err != nil || fantasy.PostCount != 1 {
+		t.Errorf("expected 1 post in Fantasy; got %d (%v)", fantasy.PostCount, err)
+	}
+
+	// Following a category includes its subcategories
+	readerID := registerTestUser(t, "reader")
+	if err := FollowCategory(readerID, fantasyID); err != nil {
+		t.Fatal(err)
+	}
+	feed, _, err := GetFollowingFeed(readerID, 1, 10)
+	if err != nil || len(feed) != 1 {
+		t.Errorf("expected the post in the Following feed; got %v (%v)", feed, err)
+	}
+}
+
+func TestMergeCategoryKeepsSubcategories(t *testing.T) {
+	setupTestDB(t)
+
+	fantasyID, epicID, grimdarkID := createCategoryTree(t)
+
+	// Merging a category hands its subcategories to the target
+	if err := MergeCategories(epicID, fantasyID); err != nil {
+		t.Fatal(err)
+	}
+	grimdark, err := GetCategory(grimdarkID)
+	if err != nil || grimdark.ParentID != fantasyID {
+		t.Errorf("expected Grimdark under Fantasy; got %+v (%v)", grimdark, err)
+	}
+}
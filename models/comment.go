@@ -1,7 +1,6 @@
 package models
 
 import (
-	"database/sql"
 	"html"
 	"html/template"
 	"strings"
@@ -18,99 +17,44 @@ type Comment struct {
 	CreatedAtFormatted string
 	Likes              int
 	Dislikes           int
-	Author             string // The username of the comment's author
-	UserHasLiked       bool   // Whether the logged-in user has liked this comment
-	UserHasDisliked    bool   // Whether the logged-in user has disliked this comment
+	Author             string          // The username of the comment's author
+	UserHasLiked       bool            // Whether the logged-in user has liked this comment
+	UserHasDisliked    bool            // Whether the logged-in user has disliked this comment
+	Reactions          []ReactionCount // emoji reactions, filled by LoadCommentReactions
+	AuthorReputation   int             // filled by LoadCommentAuthorReputations
+	Bookmarked         bool            // whether the viewer saved it in any list, filled by LoadCommentBookmarks
 }
 
-func CreateComment(postID, userID, content string) error {
+func CreateComment(postID, userID, content string) (string, error) {
 	commentID, err := uuid.NewV4()
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	_, err = db.Exec("INSERT INTO comments (id, post_id, user_id, content, created_at) VALUES (?, ?, ?, ?, ?)",
 		commentID.String(), postID, userID, content, time.Now())
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return nil
+	logNotificationError(notifyPostAuthor(userID, NotificationComment, postID, commentID.String()))
+	logNotificationError(recordMentions(userID, content, postID, commentID.String()))
+	return commentID.String(), nil
 }
 
+// LikeComment toggles the user's like of a comment; a dislike is turned into a like.
 func LikeComment(userID, commentID string) error {
-	var interactionID string
-	var isLike bool
-
-	err := db.QueryRow("SELECT id, is_like FROM comment_likes WHERE user_id = ? AND comment_id = ?", userID, commentID).Scan(&interactionID, &isLike)
-	if err == sql.ErrNoRows {
-		// Insert a new like record
-		likeID, _ := uuid.NewV4()
-		_, err = db.Exec("INSERT INTO comment_likes (id, user_id, comment_id, is_like) VALUES (?, ?, ?, TRUE)", likeID.String(), userID, commentID)
-		if err != nil {
-			return err
-		}
-	} else if err != nil {
-		return err
-	} else if isLike {
-		_, err = db.Exec("DELETE FROM comment_likes WHERE user_id = ? AND comment_id = ?", userID, commentID)
+	reacted, err := toggleReaction(commentReactions, userID, commentID, true)
+	if err != nil || !reacted {
 		return err
-	} else {
-		// Change the dislike to a like
-		_, err = db.Exec("UPDATE comment_likes SET is_like = TRUE WHERE id = ?", interactionID)
-		if err != nil {
-			return err
-		}
 	}
-
+	logNotificationError(notifyCommentAuthor(userID, commentID))
 	return nil
 }
 
+// DislikeComment toggles the user's dislike of a comment; a like is turned into a dislike.
 func DislikeComment(userID, commentID string) error {
-	var interactionID string
-	var isLike bool
-
-	err := db.QueryRow("SELECT id, is_like FROM comment_likes WHERE user_id = ? AND comment_id = ?", userID, commentID).Scan(&interactionID, &isLike)
-	if err == sql.ErrNoRows {
-		// Insert a new dislike record
-		dislikeID, _ := uuid.NewV4()
-		_, err = db.Exec("INSERT INTO comment_likes (id, user_id, comment_id, is_like) VALUES (?, ?, ?, FALSE)", dislikeID.String(), userID, commentID)
-		if err != nil {
-			return err
-		}
-	} else if err != nil {
-		return err
-	} else if !isLike {
-		_, err = db.Exec("DELETE FROM comment_likes WHERE user_id = ? AND comment_id = ?", userID, commentID)
-		return err
-	} else {
-		// Change the like to a dislike
-		_, err = db.Exec("UPDATE comment_likes SET is_like = FALSE WHERE id = ?", interactionID)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-func UpdateCommentLikesDislikes(commentID string) error {
-	var likeCount, dislikeCount int
-
-	// Count likes
-	err := db.QueryRow("SELECT COUNT(*) FROM comment_likes WHERE comment_id = ? AND is_like = TRUE", commentID).Scan(&likeCount)
-	if err != nil {
-		return err
-	}
-
-	// Count dislikes
-	err = db.QueryRow("SELECT COUNT(*) FROM comment_likes WHERE comment_id = ? AND is_like = FALSE", commentID).Scan(&dislikeCount)
-	if err != nil {
-		return err
-	}
-
-	// Update the posts table with new like and dislike counts
-	_, err = db.Exec("UPDATE comments SET likes = ?, dislikes = ? WHERE id = ?", likeCount, dislikeCount, commentID)
+	_, err := toggleReaction(commentReactions, userID, commentID, false)
 	return err
 }
 
@@ -136,13 +80,32 @@ func GetCommentsForPost(postID string) ([]Comment, error) {
 			return nil, err
 		}
 		comment.CreatedAtFormatted = createdAt.Format("02.01.2006 15:04")
-		comment.Content = template.HTML(strings.ReplaceAll(string(comment.Content), "\n", "<br>"))
+		comment.Content = RenderContent(string(comment.Content))
 		comments = append(comments, comment)
 	}
 
 	return comments, nil
 }
 
+// GetCommentByID retrieves a single comment, formatted the same way as on the post page.
+func GetCommentByID(commentID string) (Comment, error) {
+	var comment Comment
+	var createdAt time.Time
+	err := db.QueryRow(`
+        SELECT comments.id, comments.post_id, comments.content, comments.created_at, users.username, comments.likes, comments.dislikes
+        FROM comments
+        JOIN users ON comments.user_id = users.id
+        WHERE comments.id = ?
+    `, commentID).Scan(&comment.ID, &comment.PostID, &comment.Content, &createdAt, &comment.Author, &comment.Likes, &comment.Dislikes)
+	if err != nil {
+		return comment, err
+	}
+	comment.CreatedAt = createdAt
+	comment.CreatedAtFormatted = createdAt.Format("02.01.2006 15:04")
+	comment.Content = RenderContent(string(comment.Content))
+	return comment, nil
+}
+
 func SanitizeInput(input string) string {
 	// input = html.UnescapeString(input)
 	// input = strings.ReplaceAll(input, "<br>", "")
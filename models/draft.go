@@ -0,0 +1,131 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// MaxDraftsPerUser bounds the drafts a user can keep; autosave stops creating new ones beyond it.
+const MaxDraftsPerUser = 50
+
+var (
+	ErrTooManyDrafts = errors.New("too many drafts")
+	ErrDraftNotFound = errors.New("draft not found")
+)
+
+// Draft is an unfinished post, saved as the author types it. The fields hold the form input
+// as typed; it is only sanitized when the draft is published.
+type Draft struct {
+	ID                 string
+	Title              string
+	Content            string
+	Tags               string
+	CategoryIDs        []string
+	SpoilerFor         string
+	UpdatedAtFormatted string
+	Excerpt            string // the start of the content, for the drafts list
+}
+
+// SaveDraft stores a draft of the user's. A draft without an ID is created and its new ID returned;
+// otherwise the user's draft with that ID is overwritten.
+func SaveDraft(userID string, draft Draft) (string, error) {
+	categories := strings.Join(draft.CategoryIDs, ",")
+	if draft.ID != "" {
+		result, err := db.Exec(`
+            UPDATE drafts SET title = ?, content = ?, tags = ?, categories = ?, spoiler_for = ?, updated_at = ?
+            WHERE id = ? AND user_id = ?
+        `, draft.Title, draft.Content, draft.Tags, categories, draft.SpoilerFor, time.Now(), draft.ID, userID)
+		if err != nil {
+			return "", err
+		}
+		if affected, err := result.RowsAffected(); err != nil {
+			return "", err
+		} else if affected == 0 {
+			return "", ErrDraftNotFound
+		}
+		return draft.ID, nil
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM drafts WHERE user_id = ?", userID).Scan(&count); err != nil {
+		return "", err
+	}
+	if count >= MaxDraftsPerUser {
+		return "", ErrTooManyDrafts
+	}
+
+	draftID, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+	_, err = db.Exec(`
+        INSERT INTO drafts (id, user_id, title, content, tags, categories, spoiler_for, updated_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `, draftID.String(), userID, draft.Title, draft.Content, draft.Tags, categories, draft.SpoilerFor, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return draftID.String(), nil
+}
+
+// GetDrafts returns the user's drafts, most recently saved first.
+func GetDrafts(userID string) ([]Draft, error) {
+	rows, err := db.Query(`
+        SELECT id, title, content, tags, categories, spoiler_for, updated_at
+        FROM drafts WHERE user_id = ?
+        ORDER BY updated_at DESC
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drafts []Draft
+	for rows.Next() {
+		draft, err := scanDraft(rows)
+		if err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, draft)
+	}
+	return drafts, rows.Err()
+}
+
+// GetDraft retrieves one of the user's drafts; drafts of other users are not found.
+func GetDraft(userID, draftID string) (Draft, error) {
+	draft, err := scanDraft(db.QueryRow(`
+        SELECT id, title, content, tags, categories, spoiler_for, updated_at
+        FROM drafts WHERE id = ? AND user_id = ?
+    `, draftID, userID))
+	if err == sql.ErrNoRows {
+		return draft, ErrDraftNotFound
+	}
+	return draft, err
+}
+
+// scanDraft reads a row of (id, title, content, tags, categories, spoiler_for, updated_at).
+func scanDraft(row interface{ Scan(...interface{}) error }) (Draft, error) {
+	var draft Draft
+	var categories string
+	var updatedAt time.Time
+	err := row.Scan(&draft.ID, &draft.Title, &draft.Content, &draft.Tags, &categories, &draft.SpoilerFor, &updatedAt)
+	if err != nil {
+		return draft, err
+	}
+	if categories != "" {
+		draft.CategoryIDs = strings.Split(categories, ",")
+	}
+	draft.UpdatedAtFormatted = updatedAt.Format("02.01.2006 15:04")
+	draft.Excerpt = excerpt(SanitizeInput(draft.Content), ExcerptLength)
+	return draft, nil
+}
+
+// DeleteDraft removes one of the user's drafts.
+func DeleteDraft(userID, draftID string) error {
+	_, err := db.Exec("DELETE FROM drafts WHERE id = ? AND user_id = ?", draftID, userID)
+	return err
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestSaveDraft(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+
+	// A draft is created once and then overwritten
+	draftID, err := SaveDraft(authorID, Draft{Title: "Review", Content: "First <b>paragraph</b>", CategoryIDs: []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SaveDraft(authorID, Draft{ID: draftID, Title: "Review", Content: "First paragraph\n\nSecond"}); err != nil {
+		t.Fatal(err)
+	}
+	drafts, err := GetDrafts(authorID)
+	if err != nil || len(drafts) != 1 || drafts[0].Content != "First paragraph\n\nSecond" || len(drafts[0].CategoryIDs) != 0 {
+		t.Errorf("expected one updated draft; got %+v (%v)", drafts, err)
+	}
+	if err := DeleteDraft(authorID, draftID); err != nil {
+		t.Fatal(err)
+	}
+	if drafts, err := GetDrafts(authorID); err != nil || len(drafts) != 0 {
+		t.Errorf("expected the draft deleted; got %v (%v)", drafts, err)
+	}
+}
+
+func TestDraftOwnership(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	otherID := registerTestUser(t, "other")
+	draftID, err := SaveDraft(authorID, Draft{Content: "Mine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the author can read or change a draft, and deleting someone else's draft does nothing
+	tests := []struct {
+		name string
+		try  func() error
+	}{
+		{"read", func() error { _, err := GetDraft(otherID, draftID); return err }},
+		{"save", func() error { _, err := SaveDraft(otherID, Draft{ID: draftID, Content: "taken over"}); return err }},
+	}
+	for _, test := range tests {
+		if err := test.try(); err != ErrDraftNotFound {
+			t.Errorf("%s: expected ErrDraftNotFound; got %v", test.name, err)
+		}
+	}
+	if err := DeleteDraft(otherID, draftID); err != nil {
+		t.Fatal(err)
+	}
+	if draft, err := GetDraft(authorID, draftID); err != nil || draft.Content != "Mine" {
+		t.Errorf("expected the draft unchanged; got %+v (%v)", draft, err)
+	}
+}
+
+func TestScheduledPost(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	otherID := registerTestUser(t, "other")
+	publishAt := time.Now().Add(time.Hour)
+	postID, err := CreateScheduledPost(authorID, "Later", "ping @other", "", publishAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	categoryID, err := CreateCategory("Upcoming", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AddCategoryToPost(postID, categoryID); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetPostTags(postID, []string{"soon"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// visible reports how much of the post shows to everyone but its author
+	type visibility struct {
+		feed, mentions, categoryCount, tagCount, cloudSize int
+		reactionErr, commentErr                            error
+	}
+	visible := func() visibility {
+		t.Helper()
+		var v visibility
+		posts, err := GetFilteredPosts(PostFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.feed = len(posts)
+		if v.mentions, err = CountUnreadNotifications(otherID); err != nil {
+			t.Fatal(err)
+		}
+		category, err := GetCategory(categoryID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tag, err := GetTag("soon")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cloud, err := GetTagCloud(10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.categoryCount, v.tagCount, v.cloudSize = category.PostCount, tag.PostCount, len(cloud)
+		_, v.reactionErr = ReactionTargetPostID(ReactionTargetPost, postID)
+		v.commentErr = CheckPostOpen(postID, true)
+		return v
+	}
+
+	// The scheduled post is listed for its author, and nothing else gives it away
+	posts, err := GetPostsByUser(authorID)
+	if err != nil || len(posts) != 1 || !posts[0].Scheduled {
+		t.Errorf("expected the author to see the scheduled post; got %v (%v)", posts, err)
+	}
+	if got, want := visible(), (visibility{reactionErr: sql.ErrNoRows, commentErr: sql.ErrNoRows}); got != want {
+		t.Errorf("before publishing: expected %+v; got %+v", want, got)
+	}
+
+	// The scheduler publishes the post once it is due, dated when it was due
+	tests := []struct {
+		now  time.Time
+		want int
+	}{
+		{time.Now(), 0},
+		{publishAt.Add(time.Minute), 1},
+		{publishAt.Add(2 * time.Minute), 0},
+	}
+	for _, test := range tests {
+		if published, err := PublishScheduledPosts(test.now); err != nil || published != test.want {
+			t.Errorf("at %s: expected %d published; got %d (%v)", test.now.Format(time.Kitchen), test.want, published, err)
+		}
+	}
+	post, err := GetPostByID(postID)
+	if err != nil || post.Scheduled || post.CreatedAtFormatted != publishAt.Format("02.01.2006 15:04") {
+		t.Errorf("expected a published post dated %s; got %+v (%v)", publishAt.Format("02.01.2006 15:04"), post, err)
+	}
+	if got, want := visible(), (visibility{feed: 1, mentions: 1, categoryCount: 1, tagCount: 1, cloudSize: 1}); got != want {
+		t.Errorf("after publishing: expected %+v; got %+v", want, got)
+	}
+}
@@ -0,0 +1,338 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// What an emoji reaction can be attached to
+const (
+	ReactionTargetPost    = "post"
+	ReactionTargetComment = "comment"
+)
+
+// ReactionType is a kind of reaction shown on posts and comments.
+type ReactionType struct {
+	Key   string
+	Emoji string
+	Label string
+	// Weight is the default reputation a reaction of this type gives the author of the content
+	Weight float64
+}
+
+// Like and dislike stay the default pair, stored in post_likes and comment_likes.
+var (
+	LikeReaction    = ReactionType{Key: "like", Emoji: "👍", Label: "Like"}
+	DislikeReaction = ReactionType{Key: "dislike", Emoji: "👎", Label: "Dislike"}
+)
+
+// EmojiReactionTypes lists the reactions users can add besides like and dislike.
+// Admins choose which of them are enabled.
+var EmojiReactionTypes = []ReactionType{
+	{Key: "love", Emoji: "❤️", Label: "Love", Weight: 3},
+	{Key: "funny", Emoji: "😂", Label: "Funny", Weight: 2},
+	{Key: "insightful", Emoji: "💡", Label: "Insightful", Weight: 5},
+	{Key: "sad", Emoji: "😢", Label: "Sad", Weight: 1},
+	{Key: "spoiler_warning", Emoji: "⚠️", Label: "Spoiler warning", Weight: 0},
+}
+
+var ErrUnknownReaction = errors.New("unknown or disabled reaction")
+
+// ReactionCount is the number of reactions of one type on a post or comment.
+type ReactionCount struct {
+	ReactionType
+	Count   int
+	Reacted bool // whether the viewer added this reaction
+}
+
+// ReactionGroup lists who reacted to a post or comment with one type.
+type ReactionGroup struct {
+	ReactionType
+	Usernames []string
+}
+
+// EnabledReactionTypes returns the emoji reactions enabled by the admins; all are enabled by default.
+func EnabledReactionTypes() ([]ReactionType, error) {
+	value, err := GetSetting(SettingEnabledReactions, "")
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return EmojiReactionTypes, nil
+	}
+
+	enabled := make(map[string]bool)
+	for _, key := range strings.Split(value, ",") {
+		enabled[key] = true
+	}
+	var types []ReactionType
+	for _, reactionType := range EmojiReactionTypes {
+		if enabled[reactionType.Key] {
+			types = append(types, reactionType)
+		}
+	}
+	return types, nil
+}
+
+// SetEnabledReactionTypes stores which emoji reactions are enabled; unknown keys are ignored.
+func SetEnabledReactionTypes(keys []string) error {
+	wanted := make(map[string]bool)
+	for _, key := range keys {
+		wanted[key] = true
+	}
+	var enabled []string
+	for _, reactionType := range EmojiReactionTypes {
+		if wanted[reactionType.Key] {
+			enabled = append(enabled, reactionType.Key)
+		}
+	}
+	// An empty setting means "all", so turning every reaction off is stored as "none"
+	value := strings.Join(enabled, ",")
+	if value == "" {
+		value = "none"
+	}
+	return SetSetting(SettingEnabledReactions, value)
+}
+
+// enabledReactionType returns the enabled emoji reaction with the given key.
+func enabledReactionType(key string) (ReactionType, error) {
+	types, err := EnabledReactionTypes()
+	if err != nil {
+		return ReactionType{}, err
+	}
+	for _, reactionType := range types {
+		if reactionType.Key == key {
+			return reactionType, nil
+		}
+	}
+	return ReactionType{}, ErrUnknownReaction
+}
+
+// ToggleEmojiReaction adds the user's emoji reaction to a post or comment, or removes it
+// when it is already there. It returns whether the user holds the reaction afterwards
+// and the new number of reactions of that type.
+func ToggleEmojiReaction(userID, targetType, targetID, key string) (bool, int, error) {
+	if _, err := enabledReactionType(key); err != nil {
+		return false, 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM reactions WHERE user_id = ? AND target_type = ? AND target_id = ? AND type = ?",
+		userID, targetType, targetID, key)
+	if err != nil {
+		return false, 0, err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return false, 0, err
+	}
+	if removed == 0 {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return false, 0, err
+		}
+		_, err = tx.Exec("INSERT INTO reactions (id, user_id, target_type, target_id, type, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+			id.String(), userID, targetType, targetID, key, time.Now())
+		if err != nil {
+			return false, 0, err
+		}
+	}
+
+	var count int
+	err = tx.QueryRow("SELECT COUNT(*) FROM reactions WHERE target_type = ? AND target_id = ? AND type = ?",
+		targetType, targetID, key).Scan(&count)
+	if err != nil {
+		return false, 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, 0, err
+	}
+	forgetAuthorReputation(reactionContentTables[targetType], targetID)
+	return removed == 0, count, nil
+}
+
+// getReactionCounts returns the enabled emoji reaction counts of each target, with the viewer's own reactions marked.
+func getReactionCounts(userID, targetType string, targetIDs []string) (map[string][]ReactionCount, error) {
+	types, err := EnabledReactionTypes()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string][]ReactionCount)
+	if len(targetIDs) == 0 || len(types) == 0 {
+		return counts, nil
+	}
+
+	args := []interface{}{userID, targetType}
+	for _, id := range targetIDs {
+		args = append(args, id)
+	}
+	rows, err := db.Query(`
+        SELECT target_id, type, COUNT(*), MAX(user_id = ?)
+        FROM reactions
+        WHERE target_type = ? AND target_id IN (`+placeholders(len(targetIDs))+`)
+        GROUP BY target_id, type
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type key struct{ target, reaction string }
+	found := make(map[key]ReactionCount)
+	for rows.Next() {
+		var targetID, reaction string
+		var count ReactionCount
+		if err := rows.Scan(&targetID, &reaction, &count.Count, &count.Reacted); err != nil {
+			return nil, err
+		}
+		found[key{targetID, reaction}] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Every enabled type is listed, in catalog order, so the page can offer all of them
+	for _, id := range targetIDs {
+		for _, reactionType := range types {
+			count := found[key{id, reactionType.Key}]
+			count.ReactionType = reactionType
+			counts[id] = append(counts[id], count)
+		}
+	}
+	return counts, nil
+}
+
+// LoadPostReactions fills the viewer's like and dislike state and the emoji reaction counts of the posts.
+func LoadPostReactions(userID string, posts []Post) error {
+	if err := setViewerPostReactions(userID, posts); err != nil {
+		return err
+	}
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	counts, err := getReactionCounts(userID, ReactionTargetPost, ids)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].Reactions = counts[posts[i].ID]
+	}
+	return nil
+}
+
+// LoadCommentReactions fills the viewer's like and dislike state and the emoji reaction counts of the comments.
+func LoadCommentReactions(userID string, comments []Comment) error {
+	if err := setViewerCommentReactions(userID, comments); err != nil {
+		return err
+	}
+	ids := make([]string, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+	counts, err := getReactionCounts(userID, ReactionTargetComment, ids)
+	if err != nil {
+		return err
+	}
+	for i := range comments {
+		comments[i].Reactions = counts[comments[i].ID]
+	}
+	return nil
+}
+
+// GetReactionGroups lists who reacted to a post or comment, grouped by reaction with like and dislike first.
+func GetReactionGroups(targetType, targetID string) ([]ReactionGroup, error) {
+	likesQuery := "SELECT users.username, post_likes.is_like FROM post_likes JOIN users ON post_likes.user_id = users.id WHERE post_likes.post_id = ? ORDER BY users.username"
+	if targetType == ReactionTargetComment {
+		likesQuery = "SELECT users.username, comment_likes.is_like FROM comment_likes JOIN users ON comment_likes.user_id = users.id WHERE comment_likes.comment_id = ? ORDER BY users.username"
+	}
+
+	usernames := make(map[string][]string)
+	rows, err := db.Query(likesQuery, targetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var username string
+		var isLike bool
+		if err := rows.Scan(&username, &isLike); err != nil {
+			return nil, err
+		}
+		if isLike {
+			usernames[LikeReaction.Key] = append(usernames[LikeReaction.Key], username)
+		} else {
+			usernames[DislikeReaction.Key] = append(usernames[DislikeReaction.Key], username)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := collectReactors(usernames, targetType, targetID); err != nil {
+		return nil, err
+	}
+
+	types, err := EnabledReactionTypes()
+	if err != nil {
+		return nil, err
+	}
+	var groups []ReactionGroup
+	for _, reactionType := range append([]ReactionType{LikeReaction, DislikeReaction}, types...) {
+		if len(usernames[reactionType.Key]) > 0 {
+			groups = append(groups, ReactionGroup{ReactionType: reactionType, Usernames: usernames[reactionType.Key]})
+		}
+	}
+	return groups, nil
+}
+
+// collectReactors adds the usernames of the emoji reactions on a target to the map, keyed by type.
+func collectReactors(usernames map[string][]string, targetType, targetID string) error {
+	rows, err := db.Query(`
+        SELECT reactions.type, users.username
+        FROM reactions
+        JOIN users ON reactions.user_id = users.id
+        WHERE reactions.target_type = ? AND reactions.target_id = ?
+        ORDER BY users.username
+    `, targetType, targetID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var reaction, username string
+		if err := rows.Scan(&reaction, &username); err != nil {
+			return err
+		}
+		usernames[reaction] = append(usernames[reaction], username)
+	}
+	return rows.Err()
+}
+
+// ReactionTargetPostID returns the post a reaction target belongs to, or sql.ErrNoRows if it does not exist
+// or belongs to a post that is not published yet.
+func ReactionTargetPostID(targetType, targetID string) (string, error) {
+	var postID string
+	var err error
+	switch targetType {
+	case ReactionTargetPost:
+		err = db.QueryRow("SELECT id FROM posts WHERE id = ? AND publish_at IS NULL", targetID).Scan(&postID)
+	case ReactionTargetComment:
+		err = db.QueryRow(`
+            SELECT comments.post_id FROM comments JOIN posts ON posts.id = comments.post_id
+            WHERE comments.id = ? AND posts.publish_at IS NULL
+        `, targetID).Scan(&postID)
+	default:
+		err = sql.ErrNoRows
+	}
+	return postID, err
+}
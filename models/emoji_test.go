@@ -0,0 +1,124 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestToggleEmojiReaction(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	readerID := registerTestUser(t, "reader")
+	postID := createTestPost(t, authorID, "A post to react to")
+
+	// A repeated reaction is toggled off; the count includes other users' reactions
+	steps := []struct {
+		userID      string
+		wantReacted bool
+		wantCount   int
+	}{
+		{readerID, true, 1},
+		{authorID, true, 2},
+		{readerID, false, 1},
+	}
+	for i, step := range steps {
+		reacted, count, err := ToggleEmojiReaction(step.userID, ReactionTargetPost, postID, "love")
+		if err != nil || reacted != step.wantReacted || count != step.wantCount {
+			t.Errorf("step %d: expected reacted=%v count=%d; got %v, %d (%v)", i+1, step.wantReacted, step.wantCount, reacted, count, err)
+		}
+	}
+}
+
+func TestLoadPostReactions(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	readerID := registerTestUser(t, "reader")
+	postID := createTestPost(t, authorID, "A post to react to")
+	if _, _, err := ToggleEmojiReaction(authorID, ReactionTargetPost, postID, "love"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ToggleEmojiReaction(readerID, ReactionTargetPost, postID, "funny"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Counts list every enabled type and mark the viewer's own reactions
+	posts := []Post{{ID: postID}}
+	if err := LoadPostReactions(readerID, posts); err != nil {
+		t.Fatal(err)
+	}
+	if len(posts[0].Reactions) != len(EmojiReactionTypes) {
+		t.Fatalf("expected %d reaction types; got %d", len(EmojiReactionTypes), len(posts[0].Reactions))
+	}
+	want := map[string]ReactionCount{
+		"love":  {Count: 1},
+		"funny": {Count: 1, Reacted: true},
+	}
+	for _, reaction := range posts[0].Reactions {
+		if w := want[reaction.Key]; reaction.Count != w.Count || reaction.Reacted != w.Reacted {
+			t.Errorf("%s: expected %d reactions, reacted %v; got %+v", reaction.Key, w.Count, w.Reacted, reaction)
+		}
+	}
+}
+
+func TestGetReactionGroups(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	readerID := registerTestUser(t, "reader")
+	postID := createTestPost(t, authorID, "A post to react to")
+	if _, _, err := ToggleEmojiReaction(authorID, ReactionTargetPost, postID, "love"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ToggleEmojiReaction(readerID, ReactionTargetPost, postID, "funny"); err != nil {
+		t.Fatal(err)
+	}
+	if err := LikePost(readerID, postID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The who-reacted list includes likes first
+	groups, err := GetReactionGroups(ReactionTargetPost, postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, group := range groups {
+		got = append(got, group.Key+":"+fmt.Sprint(group.Usernames))
+	}
+	want := []string{"like:[reader]", "love:[author]", "funny:[reader]"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected groups %v; got %v", want, got)
+	}
+}
+
+func TestEnabledReactionTypes(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	postID := createTestPost(t, authorID, "A post to react to")
+
+	tests := []struct {
+		enabled []string
+		key     string
+		wantErr error
+	}{
+		{[]string{"love"}, "love", nil},
+		{[]string{"love"}, "funny", ErrUnknownReaction},
+		{[]string{"love"}, "like", ErrUnknownReaction},
+		{[]string{"love"}, "nonsense", ErrUnknownReaction},
+		{nil, "love", ErrUnknownReaction},
+	}
+	for _, test := range tests {
+		if err := SetEnabledReactionTypes(test.enabled); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := ToggleEmojiReaction(authorID, ReactionTargetPost, postID, test.key); err != test.wantErr {
+			t.Errorf("%s with %v enabled: expected %v; got %v", test.key, test.enabled, test.wantErr, err)
+		}
+	}
+	if types, err := EnabledReactionTypes(); err != nil || len(types) != 0 {
+		t.Errorf("expected every reaction to be disabled; got %v, %v", types, err)
+	}
+}
@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// PostFilter narrows the posts of the main page. The zero value matches every post.
+type PostFilter struct {
+	CategoryIDs []string  // each category includes its subcategories
+	MatchAll    bool      // posts must be in every category rather than in any of them
+	Author      string    // username
+	From        time.Time // zero for no lower bound
+	Until       time.Time // exclusive; zero for no upper bound
+	HasImage    bool
+	MinLikes    int
+	Unanswered  bool // only posts without comments
+}
+
+// conditions adds the filter's conditions to a query over posts joined with users.
+func (f PostFilter) conditions(b *queryBuilder) {
+	inCategory := "posts.id IN (SELECT post_id FROM post_categories WHERE category_id IN (" + categorySubtree + "))"
+	var categories queryBuilder
+	for _, categoryID := range f.CategoryIDs {
+		if f.MatchAll {
+			b.where(inCategory, categoryID)
+		} else {
+			categories.where(inCategory, categoryID)
+		}
+	}
+	b.whereAny(categories)
+
+	if f.Author != "" {
+		b.where("users.username = ?", f.Author)
+	}
+	// Posts keep the time zone they were written in, so times are compared as Julian days
+	if !f.From.IsZero() {
+		b.where("julianday(posts.created_at) >= julianday(?)", f.From)
+	}
+	if !f.Until.IsZero() {
+		b.where("julianday(posts.created_at) < julianday(?)", f.Until)
+	}
+	if f.HasImage {
+		b.where("posts.image_path IS NOT NULL AND posts.image_path != ''")
+	}
+	if f.MinLikes > 0 {
+		b.where("posts.likes >= ?", f.MinLikes)
+	}
+	if f.Unanswered {
+		b.where("NOT EXISTS (SELECT 1 FROM comments WHERE comments.post_id = posts.id)")
+	}
+}
+
+// GetFilteredPosts returns the published posts that match the filter, newest first.
+func GetFilteredPosts(filter PostFilter) ([]Post, error) {
+	var b queryBuilder
+	// Scheduled posts stay hidden until PublishScheduledPosts publishes them
+	b.where("posts.publish_at IS NULL")
+	filter.conditions(&b)
+	query, args := b.build(`
+        SELECT posts.id, posts.content, posts.created_at, posts.likes, posts.dislikes, posts.image_path, posts.title, posts.spoiler_for, posts.locked, posts.archived_at, users.username
+        FROM posts
+        JOIN users ON posts.user_id = users.id`, "ORDER BY posts.created_at DESC")
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanPosts(rows)
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetFilteredPosts(t *testing.T) {
+	setupTestDB(t)
+
+	fantasy, err := GetCategoryBySlug("fantasy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mystery, err := GetCategoryBySlug("mystery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceID := registerTestUser(t, "alice")
+	bobID := registerTestUser(t, "bob")
+
+	newPost := func(userID, content, imagePath string, categoryIDs ...string) string {
+		t.Helper()
+		postID, err := CreatePost(userID, "", content, imagePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, categoryID := range categoryIDs {
+			if err := AddCategoryToPost(postID, categoryID); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return postID
+	}
+	bothID := newPost(aliceID, "Both", "uploads/cover.png", fantasy.ID, mystery.ID)
+	fantasyID := newPost(bobID, "Fantasy only", "", fantasy.ID)
+	mysteryID := newPost(bobID, "Mystery only", "", mystery.ID)
+	if err := LikePost(aliceID, fantasyID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateComment(mysteryID, aliceID, "Who did it?"); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(filter PostFilter) map[string]bool {
+		t.Helper()
+		posts, err := GetFilteredPosts(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := make(map[string]bool)
+		for _, post := range posts {
+			found[post.ID] = true
+		}
+		return found
+	}
+
+	tests := []struct {
+		name   string
+		filter PostFilter
+		want   []string
+	}{
+		{"no filter", PostFilter{}, []string{bothID, fantasyID, mysteryID}},
+		{"any category", PostFilter{CategoryIDs: []string{fantasy.ID, mystery.ID}}, []string{bothID, fantasyID, mysteryID}},
+		{"all categories", PostFilter{CategoryIDs: []string{fantasy.ID, mystery.ID}, MatchAll: true}, []string{bothID}},
+		{"author", PostFilter{Author: "bob"}, []string{fantasyID, mysteryID}},
+		{"author and category", PostFilter{Author: "bob", CategoryIDs: []string{mystery.ID}}, []string{mysteryID}},
+		{"has image", PostFilter{HasImage: true}, []string{bothID}},
+		{"min likes", PostFilter{MinLikes: 1}, []string{fantasyID}},
+		{"unanswered", PostFilter{Unanswered: true}, []string{bothID, fantasyID}},
+		{"from tomorrow", PostFilter{From: time.Now().AddDate(0, 0, 1)}, nil},
+		{"until tomorrow", PostFilter{Until: time.Now().AddDate(0, 0, 1)}, []string{bothID, fantasyID, mysteryID}},
+		{"until yesterday", PostFilter{Until: time.Now().AddDate(0, 0, -1)}, nil},
+	}
+	for _, test := range tests {
+		found := ids(test.filter)
+		if len(found) != len(test.want) {
+			t.Errorf("%s: expected %d posts; got %d", test.name, len(test.want), len(found))
+			continue
+		}
+		for _, postID := range test.want {
+			if !found[postID] {
+				t.Errorf("%s: expected post %s", test.name, postID)
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrFollowSelf = errors.New("you cannot follow yourself")
+
+// FollowUser makes follower see the posts of followed in their Following feed.
+func FollowUser(followerID, followedID string) error {
+	if followerID == followedID {
+		return ErrFollowSelf
+	}
+	_, err := db.Exec("INSERT OR IGNORE INTO user_follows (follower_id, followed_id, created_at) VALUES (?, ?, ?)",
+		followerID, followedID, time.Now())
+	return err
+}
+
+// UnfollowUser stops following a user.
+func UnfollowUser(followerID, followedID string) error {
+	_, err := db.Exec("DELETE FROM user_follows WHERE follower_id = ? AND followed_id = ?", followerID, followedID)
+	return err
+}
+
+// IsFollowingUser reports whether follower follows followed.
+func IsFollowingUser(followerID, followedID string) (bool, error) {
+	var following bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM user_follows WHERE follower_id = ? AND followed_id = ?)",
+		followerID, followedID).Scan(&following)
+	return following, err
+}
+
+// GetFollowCounts returns how many users follow the user and how many they follow.
+func GetFollowCounts(userID string) (int, int, error) {
+	var followers, following int
+	err := db.QueryRow(`
+        SELECT (SELECT COUNT(*) FROM user_follows WHERE followed_id = ?),
+               (SELECT COUNT(*) FROM user_follows WHERE follower_id = ?)
+    `, userID, userID).Scan(&followers, &following)
+	return followers, following, err
+}
+
+// FollowCategory adds a category's posts to the user's Following feed.
+func FollowCategory(userID, categoryID string) error {
+	_, err := db.Exec("INSERT OR IGNORE INTO category_follows (user_id, category_id, created_at) VALUES (?, ?, ?)",
+		userID, categoryID, time.Now())
+	return err
+}
+
+// UnfollowCategory stops following a category.
+func UnfollowCategory(userID, categoryID string) error {
+	_, err := db.Exec("DELETE FROM category_follows WHERE user_id = ? AND category_id = ?", userID, categoryID)
+	return err
+}
+
+// GetFollowedCategoryIDs returns the set of categories the user follows.
+func GetFollowedCategoryIDs(userID string) (map[string]bool, error) {
+	rows, err := db.Query("SELECT category_id FROM category_follows WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	followed := make(map[string]bool)
+	for rows.Next() {
+		var categoryID string
+		if err := rows.Scan(&categoryID); err != nil {
+			return nil, err
+		}
+		followed[categoryID] = true
+	}
+	return followed, rows.Err()
+}
+
+// GetFollowingFeed returns one page of posts by followed users or in followed categories,
+// newest first, and whether there are more pages.
+func GetFollowingFeed(userID string, page, perPage int) ([]Post, bool, error) {
+	if page < 1 {
+		page = 1
+	}
+
+	rows, err := db.Query(`
+        SELECT posts.id, posts.content, posts.created_at, posts.likes, posts.dislikes, posts.image_path, posts.title, posts.spoiler_for, posts.locked, posts.archived_at, users.username
+        FROM posts
+        JOIN users ON posts.user_id = users.id
+        WHERE posts.publish_at IS NULL
+          AND (posts.user_id IN (SELECT followed_id FROM user_follows WHERE follower_id = ?)
+           OR posts.id IN (
+               -- Following a category includes its subcategories
+               WITH RECURSIVE followed(id) AS (
+                   SELECT category_id FROM category_follows WHERE user_id = ?
+                   UNION SELECT categories.id FROM categories JOIN followed ON categories.parent_id = followed.id
+               )
+               SELECT post_id FROM post_categories WHERE category_id IN (SELECT id FROM followed)))
+        ORDER BY posts.created_at DESC
+        LIMIT ? OFFSET ?
+    `, userID, userID, perPage+1, (page-1)*perPage)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	posts, err := scanPosts(rows)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// One extra row was requested to tell whether another page follows
+	hasMore := len(posts) > perPage
+	if hasMore {
+		posts = posts[:perPage]
+	}
+	return posts, hasMore, nil
+}
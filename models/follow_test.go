@@ -0,0 +1,118 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFollowUser(t *testing.T) {
+	setupTestDB(t)
+
+	readerID := registerTestUser(t, "reader")
+	authorID := registerTestUser(t, "author")
+
+	tests := []struct {
+		name       string
+		followedID string
+		wantErr    error
+	}{
+		{"self", readerID, ErrFollowSelf},
+		{"author", authorID, nil},
+		{"author again", authorID, nil},
+	}
+	for _, test := range tests {
+		if err := FollowUser(readerID, test.followedID); err != test.wantErr {
+			t.Errorf("%s: expected %v; got %v", test.name, test.wantErr, err)
+		}
+	}
+	if followers, following, err := GetFollowCounts(readerID); err != nil || followers != 0 || following != 1 {
+		t.Errorf("expected the reader to follow one user; got %d followers, %d following (%v)", followers, following, err)
+	}
+	if following, err := IsFollowingUser(authorID, readerID); err != nil || following {
+		t.Errorf("expected following to be one way; got %v (%v)", following, err)
+	}
+}
+
+func TestGetFollowingFeed(t *testing.T) {
+	setupTestDB(t)
+
+	readerID := registerTestUser(t, "reader")
+	authorID := registerTestUser(t, "author")
+	strangerID := registerTestUser(t, "stranger")
+	fantasyID, _, grimdarkID := createCategoryTree(t)
+	otherID, err := CreateCategory("Poetry", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Posts from oldest to newest, each with its categories
+	posts := []struct {
+		authorID, content string
+		categoryIDs       []string
+	}{
+		{authorID, "Followed author", nil},
+		{strangerID, "Followed category", []string{fantasyID}},
+		{authorID, "Both", []string{fantasyID, grimdarkID}},
+		{strangerID, "Subcategory", []string{grimdarkID}},
+		{strangerID, "Not followed", []string{otherID}},
+		{readerID, "Own post", nil},
+	}
+	now := time.Now()
+	labels := make(map[string]string)
+	for i, post := range posts {
+		postID := createTestPost(t, post.authorID, post.content)
+		labels[postID] = post.content
+		for _, categoryID := range post.categoryIDs {
+			if err := AddCategoryToPost(postID, categoryID); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := db.Exec("UPDATE posts SET created_at = ? WHERE id = ?", now.Add(time.Duration(i-len(posts))*time.Minute), postID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := FollowUser(readerID, authorID); err != nil {
+		t.Fatal(err)
+	}
+	if err := FollowCategory(readerID, fantasyID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The feed merges followed users and categories, lists each post once and splits into pages
+	tests := []struct {
+		page, perPage int
+		want          []string
+		wantMore      bool
+	}{
+		{1, 10, []string{"Subcategory", "Both", "Followed category", "Followed author"}, false},
+		{1, 4, []string{"Subcategory", "Both", "Followed category", "Followed author"}, false},
+		{1, 3, []string{"Subcategory", "Both", "Followed category"}, true},
+		{2, 3, []string{"Followed author"}, false},
+		{3, 3, nil, false},
+	}
+	for _, test := range tests {
+		feed, hasMore, err := GetFollowingFeed(readerID, test.page, test.perPage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, post := range feed {
+			got = append(got, labels[post.ID])
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) || hasMore != test.wantMore {
+			t.Errorf("page %d of %d: expected %v (more: %v); got %v (more: %v)", test.page, test.perPage, test.want, test.wantMore, got, hasMore)
+		}
+	}
+
+	// Unfollowing empties the feed
+	if err := UnfollowUser(readerID, authorID); err != nil {
+		t.Fatal(err)
+	}
+	if err := UnfollowCategory(readerID, fantasyID); err != nil {
+		t.Fatal(err)
+	}
+	if feed, _, err := GetFollowingFeed(readerID, 1, 10); err != nil || len(feed) != 0 {
+		t.Errorf("expected an empty feed after unfollowing; got %v (%v)", feed, err)
+	}
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofrs/uuid"
+)
+
+// Identity is an external login (OpenID Connect account) linked to a forum user.
+type Identity struct {
+	Provider string
+	Subject  string
+	Email    string
+}
+
+// GetUserIDByIdentity returns the forum user linked to an external account.
+func GetUserIDByIdentity(provider, subject string) (string, error) {
+	var userID string
+	err := db.QueryRow("SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?", provider, subject).Scan(&userID)
+	return userID, err
+}
+
+// LinkIdentity attaches an external account to a user. Each external account belongs to at most one user.
+func LinkIdentity(userID, provider, subject, email string) error {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("INSERT INTO user_identities (id, user_id, provider, subject, email, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		id.String(), userID, provider, subject, email, time.Now())
+	return err
+}
+
+// UnlinkIdentity removes the user's link to an external provider.
+func UnlinkIdentity(userID, provider string) error {
+	_, err := db.Exec("DELETE FROM user_identities WHERE user_id = ? AND provider = ?", userID, provider)
+	return err
+}
+
+// GetIdentitiesForUser lists the external accounts linked to a user.
+func GetIdentitiesForUser(userID string) ([]Identity, error) {
+	rows, err := db.Query("SELECT provider, subject, COALESCE(email, '') FROM user_identities WHERE user_id = ? ORDER BY provider", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []Identity
+	for rows.Next() {
+		var identity Identity
+		if err := rows.Scan(&identity.Provider, &identity.Subject, &identity.Email); err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+
+	return identities, rows.Err()
+}
+
+// HasPassword reports whether the user can log in with a password, as opposed to only external accounts.
+func HasPassword(userID string) (bool, error) {
+	var password sql.NullString
+	err := db.QueryRow("SELECT password FROM users WHERE id = ?", userID).Scan(&password)
+	return password.String != "", err
+}
+
+// RegisterExternalUser creates a user without a password for someone signing in through a provider.
+func RegisterExternalUser(email, username string, emailVerified bool) (string, error) {
+	userID, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.Exec("INSERT INTO users (id, email, username, username_skeleton, password, email_verified, created_at) VALUES (?, ?, ?, ?, '', ?, ?)",
+		userID.String(), email, username, UsernameSkeleton(username), emailVerified, time.Now())
+	return userID.String(), err
+}
+
+// AvailableUsername turns the first usable candidate into a valid username and appends
+// a number when it is taken, reserved or too similar to an existing one.
+func AvailableUsername(candidates ...string) (string, error) {
+	base := ""
+	for _, candidate := range candidates {
+		if base = usernameFromCandidate(candidate); base != "" {
+			break
+		}
+	}
+	if base == "" {
+		base = "reader"
+	}
+
+	for i := 1; ; i++ {
+		username := base
+		if i > 1 {
+			suffix := strconv.Itoa(i)
+			if len(base)+len(suffix) > usernameMaxLength {
+				username = base[:usernameMaxLength-len(suffix)]
+			}
+			username += suffix
+		}
+
+		err := ValidateUsername(username)
+		if _, isPolicyError := err.(*PolicyError); isPolicyError {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		exists, err := CheckUsernameExists(username)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return username, nil
+		}
+	}
+}
+
+// usernameFromCandidate keeps letters, digits and underscores, using the local part of an email.
+func usernameFromCandidate(candidate string) string {
+	if at := strings.Index(candidate, "@"); at >= 0 {
+		candidate = candidate[:at]
+	}
+
+	var b strings.Builder
+	for _, r := range candidate {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) || r == '_':
+			b.WriteRune(r)
+		case r == ' ' || r == '.' || r == '-':
+			b.WriteRune('_')
+		}
+	}
+
+	username := strings.Trim(b.String(), "_")
+	if len(username) > usernameMaxLength {
+		username = strings.TrimRight(username[:usernameMaxLength], "_")
+	}
+	if len(username) < usernameMinLength {
+		return ""
+	}
+	return username
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"bytes"
+	"html"
+	"html/template"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+	nethtml "golang.org/x/net/html"
+)
+
+// markdown renders CommonMark with strikethrough, bare links, spoiler blocks, mentions and hashtags. Raw HTML in the
+// source is dropped, and a line break in the source stays a line break, as it was before Markdown.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.Strikethrough, extension.Linkify, spoilerExtension{}, referenceExtension{}),
+	goldmark.WithRendererOptions(gmhtml.WithHardWraps()),
+)
+
+// markdownText renders like markdown but leaves the text of spoilers out, for excerpts.
+var markdownText = goldmark.New(
+	goldmark.WithExtensions(extension.Strikethrough, extension.Linkify, spoilerExtension{hide: true}, referenceExtension{}),
+	goldmark.WithRendererOptions(gmhtml.WithHardWraps()),
+)
+
+// contentPolicy is the allowlist of the HTML that posts and comments may contain. Images are left
+// out on purpose: they go through the upload form, which checks the author's privileges.
+var contentPolicy = func() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("p", "br", "em", "strong", "del", "blockquote", "ul", "ol", "li", "pre", "code", "hr",
+		"h1", "h2", "h3", "h4", "h5", "h6", "summary")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^spoiler$`)).OnElements("details")
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+	p.AllowStandardURLs()
+	p.AllowAttrs("href").Matching(linkTarget).OnElements("a")
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}()
+
+// linkTarget matches the hrefs a post may contain: web and mail addresses, and paths on this site.
+// Relative references with a host, like //evil.example or /\evil.example, are rejected; browsers
+// follow them off-site.
+var linkTarget = regexp.MustCompile(`^(?:(?i:https?|mailto):|#|/(?:[^/\\]|$))`)
+
+// textPolicy keeps only the text of rendered content.
+var textPolicy = bluemonday.StrictPolicy()
+
+// RenderContent turns the stored content of a post or comment into safe HTML. Content is stored
+// HTML-escaped by SanitizeInput, so it is unescaped back to the Markdown the author typed first.
+func RenderContent(stored string) template.HTML {
+	return render(markdown, stored)
+}
+
+func render(md goldmark.Markdown, stored string) template.HTML {
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(html.UnescapeString(stored)), &buf); err != nil {
+		// Rendering only fails when writing to the buffer fails; fall back to the escaped source
+		log.Println("Error rendering Markdown:", err)
+		return template.HTML(stored)
+	}
+	return template.HTML(contentPolicy.SanitizeBytes(buf.Bytes()))
+}
+
+// linkHrefs returns the targets of the links Markdown makes of stored content, unescaped as a browser
+// reads them. They are taken before contentPolicy drops the unsafe ones, so those count too.
+func linkHrefs(stored string) []string {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(html.UnescapeString(stored)), &buf); err != nil {
+		log.Println("Error rendering Markdown:", err)
+		return nil
+	}
+	var hrefs []string
+	tokenizer := nethtml.NewTokenizer(&buf)
+	for {
+		switch tokenizer.Next() {
+		case nethtml.ErrorToken:
+			return hrefs
+		case nethtml.StartTagToken:
+			token := tokenizer.Token()
+			if token.Data != "a" {
+				continue
+			}
+			for _, attr := range token.Attr {
+				if attr.Key == "href" {
+					hrefs = append(hrefs, attr.Val)
+				}
+			}
+		}
+	}
+}
+
+// plainText turns stored content into the text a reader sees, without formatting or spoilers, on one line.
+func plainText(stored string) string {
+	text := textPolicy.Sanitize(string(render(markdownText, stored)))
+	return strings.Join(strings.Fields(html.UnescapeString(text)), " ")
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	nethtml "golang.org/x/net/html"
+)
+
+func TestRenderContent(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"emphasis", "**bold** and *italic*", "<p><strong>bold</strong> and <em>italic</em></p>\n"},
+		{"line breaks", "one\ntwo", "<p>one<br>\ntwo</p>\n"},
+		{"list", "- a\n- b", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n"},
+		{"quote", "> quoted", "<blockquote>\n<p>quoted</p>\n</blockquote>\n"},
+		{"code", "`x < y`", "<p><code>x &lt; y</code></p>\n"},
+		{"link", "[site](https://example.com)", `<p><a href="https://example.com" rel="nofollow noopener" target="_blank">site</a></p>` + "\n"},
+		{"bare link", "see https://example.com", `<p>see <a href="https://example.com" rel="nofollow noopener" target="_blank">https://example.com</a></p>` + "\n"},
+		{"raw HTML", "<script>alert(1)</script>", "\n"},
+		{"javascript link", "[x](javascript:alert(1))", "<p>x</p>\n"},
+		{"image", "![cover](https://example.com/cover.png)", "<p></p>\n"},
+		{"spoiler", ":::spoiler\nhidden\n:::", `<details class="spoiler"><summary>Spoiler</summary>` + "\n<p>hidden</p>\n</details>\n"},
+		{"spoiler label", ":::spoiler <b>Dune</b>\n**hidden**\n:::\nafter", `<details class="spoiler"><summary>Spoiler: &lt;b&gt;Dune&lt;/b&gt;</summary>` + "\n<p><strong>hidden</strong></p>\n</details>\n<p>after</p>\n"},
+		{"unclosed spoiler", "before\n:::spoiler\nhidden", "<p>before</p>\n" + `<details class="spoiler"><summary>Spoiler</summary>` + "\n<p>hidden</p>\n</details>\n"},
+		{"not a spoiler", ":::spoilers", "<p>:::spoilers</p>\n"},
+		{"mention", "thanks @alice.", `<p>thanks <a href="/user/alice" rel="nofollow">@alice</a>.</p>` + "\n"},
+		{"hashtag", "#SciFi fans", `<p><a href="/tags/scifi" rel="nofollow">#SciFi</a> fans</p>` + "\n"},
+		{"not references", "a@b.c x#y #1 `@code`", `<p><a href="mailto:a@b.c" rel="nofollow">a@b.c</a> x#y #1 <code>@code</code></p>` + "\n"},
+		{"protocol-relative link", "[x](//evil.example/buy)", "<p>x</p>\n"},
+		{"backslash link", `[x](/\evil.example)`, `<p><a href="/%5Cevil.example" rel="nofollow">x</a></p>` + "\n"},
+		{"site link", "[rules](/posts/1)", `<p><a href="/posts/1" rel="nofollow">rules</a></p>` + "\n"},
+		{"mail link", "[mail](mailto:a@b.c)", `<p><a href="mailto:a@b.c" rel="nofollow">mail</a></p>` + "\n"},
+		{"mention in link", "[@bob](https://example.com)", `<p><a href="https://example.com" rel="nofollow noopener" target="_blank">@bob</a></p>` + "\n"},
+	}
+	for _, test := range tests {
+		// Content reaches the renderer escaped, as SanitizeInput stores it
+		got := string(RenderContent(SanitizeInput(test.input)))
+		if got != test.want {
+			t.Errorf("%s: RenderContent(%q) = %q; want %q", test.name, test.input, got, test.want)
+		}
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	got := plainText(SanitizeInput("# Title\n\n**Bold** & [link](https://example.com)\n\n- one\n- two"))
+	if want := "Title Bold & link one two"; got != want {
+		t.Errorf("plainText = %q; want %q", got, want)
+	}
+	got = plainText(SanitizeInput("Who dies?\n:::spoiler Chapter 3\nEveryone\n:::\nRead it"))
+	if want := "Who dies? [spoiler] Read it"; got != want {
+		t.Errorf("plainText = %q; want %q", got, want)
+	}
+}
+
+// allowedAttrs lists the attributes contentPolicy lets through on each element.
+var allowedAttrs = map[string]map[string]bool{
+	"a":       {"href": true, "rel": true, "target": true},
+	"ol":      {"start": true},
+	"code":    {"class": true},
+	"details": {"class": true},
+}
+
+func FuzzRenderContent(f *testing.F) {
+	for _, seed := range []string{
+		"**bold** _it_ `code`",
+		"<script>alert(1)</script>",
+		"<img src=x onerror=alert(1)>",
+		"[x](javascript:alert(1))",
+		"[x](JaVaScRiPt:alert(1))",
+		"[x](&#106;avascript:alert(1))",
+		"![x](data:text/html;base64,PHNjcmlwdD4=)",
+		"<a href=\"javascript:alert(1)\">x</a>",
+		"```html\n<script>alert(1)</script>\n```",
+		"[x](https://example.com \"title\" onclick=alert(1))",
+		"<svg/onload=alert(1)>",
+		"<<script>script>alert(1)<</script>/script>",
+		"&lt;script&gt;alert(1)&lt;/script&gt;",
+		"> <iframe src=https://example.com>",
+		":::spoiler <script>alert(1)</script>\n<img src=x onerror=alert(1)>\n:::",
+		"[x](//evil.example/buy)",
+		"[x](/\\evil.example)",
+		"> :::spoiler\n> - quoted\n:::",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		rendered := string(RenderContent(SanitizeInput(input)))
+		tokenizer := nethtml.NewTokenizer(strings.NewReader(rendered))
+		for {
+			tokenType := tokenizer.Next()
+			if tokenType == nethtml.ErrorToken {
+				return
+			}
+			if tokenType != nethtml.StartTagToken && tokenType != nethtml.SelfClosingTagToken {
+				continue
+			}
+			token := tokenizer.Token()
+			if !contentPolicyAllows(token.Data) {
+				t.Fatalf("element <%s> in %q rendered from %q", token.Data, rendered, input)
+			}
+			for _, attr := range token.Attr {
+				if !allowedAttrs[token.Data][attr.Key] {
+					t.Fatalf("attribute %s on <%s> in %q rendered from %q", attr.Key, token.Data, rendered, input)
+				}
+				if attr.Key == "href" {
+					// The tokenizer has already unescaped the value, as a browser would
+					link, err := url.Parse(attr.Val)
+					if err != nil || (link.Scheme != "" && link.Scheme != "http" && link.Scheme != "https" && link.Scheme != "mailto") ||
+						(link.Scheme == "" && (link.Host != "" || strings.HasPrefix(attr.Val, "/\\"))) {
+						t.Fatalf("link %q in %q rendered from %q", attr.Val, rendered, input)
+					}
+				}
+			}
+		}
+	})
+}
+
+func contentPolicyAllows(element string) bool {
+	switch element {
+	case "p", "br", "em", "strong", "del", "blockquote", "ul", "ol", "li", "pre", "code", "hr",
+		"h1", "h2", "h3", "h4", "h5", "h6", "a", "details", "summary":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,271 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Mentions (@username) and hashtags (#tag) start a word; what follows is the name.
+const (
+	mentionName = `[\p{L}\p{N}_.\-]+`
+	hashtagName = `[\p{N}_\-]*\p{L}[\p{L}\p{N}_\-]*` // at least one letter, so "#1" is not a tag
+)
+
+var (
+	mentionStart = regexp.MustCompile(`^@(` + mentionName + `)`)
+	hashtagStart = regexp.MustCompile(`^#(` + hashtagName + `)`)
+)
+
+// linkedReferences returns the mentions or hashtags, as chosen by the prefix of their destination,
+// that stored content renders as links, without the leading @ or #. References in code spans,
+// code blocks and the text of other links are plain text and left out.
+func linkedReferences(stored, destinationPrefix string) []string {
+	source := []byte(html.UnescapeString(stored))
+	document := markdown.Parser().Parse(text.NewReader(source))
+
+	var names []string
+	ast.Walk(document, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		reference, ok := n.(*referenceNode)
+		if entering && ok && !insideLink(reference) && bytes.HasPrefix(reference.Destination, []byte(destinationPrefix)) {
+			names = append(names, string(reference.Text(source)[1:]))
+		}
+		return ast.WalkContinue, nil
+	})
+	return names
+}
+
+// ExtractHashtags returns the distinct tags written as #tag in stored content, normalized.
+// Only the hashtags rendered as links count.
+func ExtractHashtags(stored string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, hashtag := range linkedReferences(stored, "/tags/") {
+		name := NormalizeTag(hashtag)
+		if seen[TagSkeleton(name)] {
+			continue
+		}
+		seen[TagSkeleton(name)] = true
+		tags = append(tags, name)
+		if len(tags) == MaxTagsPerPost {
+			break
+		}
+	}
+	return tags
+}
+
+// AddHashtags adds the hashtags of stored content to the tags given in the form,
+// skipping duplicates and stopping at MaxTagsPerPost.
+func AddHashtags(tags []string, stored string) []string {
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		seen[TagSkeleton(tag)] = true
+	}
+	for _, tag := range ExtractHashtags(stored) {
+		if len(tags) >= MaxTagsPerPost {
+			break
+		}
+		if !seen[TagSkeleton(tag)] {
+			seen[TagSkeleton(tag)] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// recordMentions stores the users mentioned in a post or comment and notifies them.
+// Mentions of users that do not exist and of the author are ignored.
+func recordMentions(actorID, content, postID, commentID string) error {
+	for _, username := range ExtractMentions(content) {
+		var userID string
+		err := db.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&userID)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if userID == actorID {
+			continue
+		}
+		_, err = db.Exec("INSERT OR IGNORE INTO mentions (user_id, post_id, comment_id, created_at) VALUES (?, ?, ?, ?)",
+			userID, postID, commentID, time.Now())
+		if err != nil {
+			return err
+		}
+		if err := createNotification(userID, actorID, NotificationMention, postID, commentID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMentionedPostsByUser retrieves the posts in which the user is mentioned, in the post or in a comment.
+func GetMentionedPostsByUser(userID string) ([]Post, error) {
+	rows, err := db.Query(`
+        SELECT posts.id, posts.content, posts.created_at, posts.likes, posts.dislikes, posts.image_path, posts.title, posts.spoiler_for, posts.locked, posts.archived_at, users.username
+        FROM posts
+        JOIN users ON posts.user_id = users.id
+        WHERE posts.id IN (SELECT post_id FROM mentions WHERE user_id = ?) AND posts.publish_at IS NULL
+        ORDER BY posts.created_at DESC
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanPosts(rows)
+}
+
+// SuggestUsernames returns the usernames that start with the prefix, for autocomplete.
+func SuggestUsernames(prefix string, limit int) ([]string, error) {
+	prefix = strings.TrimPrefix(strings.TrimSpace(prefix), "@")
+	if prefix == "" {
+		return nil, nil
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix)
+	rows, err := db.Query(`
+        SELECT username FROM users
+        WHERE username LIKE ? ESCAPE '\'
+        ORDER BY length(username), username
+        LIMIT ?
+    `, escaped+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames, rows.Err()
+}
+
+var kindReference = ast.NewNodeKind("Reference")
+
+// referenceNode is a mention or hashtag; its child is the text as written. It is a node of its own
+// rather than an ast.Link so that a mention inside the text of a link does not break the link.
+type referenceNode struct {
+	ast.BaseInline
+	Destination []byte
+}
+
+func (n *referenceNode) Kind() ast.NodeKind {
+	return kindReference
+}
+
+func (n *referenceNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Destination": string(n.Destination)}, nil)
+}
+
+// referenceParser turns @username into a link to the user's profile and #tag into a link
+// to the tag's posts. ExtractMentions and ExtractHashtags collect what it finds.
+type referenceParser struct{}
+
+func (p referenceParser) Trigger() []byte {
+	return []byte{'@', '#'}
+}
+
+func (p referenceParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+	previous := block.PrecendingCharacter()
+	if unicode.IsLetter(previous) || unicode.IsNumber(previous) || previous == '_' {
+		return nil
+	}
+
+	var length int
+	var destination string
+	switch line[0] {
+	case '@':
+		if previous == '.' || previous == '@' {
+			return nil
+		}
+		match := mentionStart.FindSubmatch(line)
+		if match == nil {
+			return nil
+		}
+		// A mention at the end of a sentence should not include the full stop
+		username := strings.TrimRight(string(match[1]), ".-")
+		if username == "" {
+			return nil
+		}
+		length = 1 + len(username)
+		destination = "/user/" + url.PathEscape(username)
+	case '#':
+		if previous == '&' || previous == '#' || previous == '/' {
+			return nil
+		}
+		match := hashtagStart.FindSubmatch(line)
+		if match == nil {
+			return nil
+		}
+		name := NormalizeTag(string(match[1]))
+		if name == "" || utf8.RuneCountInString(name) > MaxTagLength {
+			return nil
+		}
+		length = len(match[0])
+		destination = "/tags/" + url.PathEscape(name)
+	default:
+		return nil
+	}
+
+	node := &referenceNode{Destination: []byte(destination)}
+	node.AppendChild(node, ast.NewTextSegment(segment.WithStop(segment.Start+length)))
+	block.Advance(length)
+	return node
+}
+
+// referenceRenderer renders mentions and hashtags as links, or as plain text inside other links.
+type referenceRenderer struct{}
+
+func (r referenceRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindReference, r.render)
+}
+
+func (r referenceRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if insideLink(n) {
+		return ast.WalkContinue, nil
+	}
+	if entering {
+		_, _ = w.WriteString(`<a href="`)
+		_, _ = w.Write(util.EscapeHTML(n.(*referenceNode).Destination))
+		_, _ = w.WriteString(`">`)
+	} else {
+		_, _ = w.WriteString("</a>")
+	}
+	return ast.WalkContinue, nil
+}
+
+// insideLink reports whether a node is part of the text of a link or image.
+func insideLink(n ast.Node) bool {
+	for parent := n.Parent(); parent != nil; parent = parent.Parent() {
+		if parent.Kind() == ast.KindLink || parent.Kind() == ast.KindImage {
+			return true
+		}
+	}
+	return false
+}
+
+// referenceExtension adds mention and hashtag links to a Markdown renderer.
+type referenceExtension struct{}
+
+func (e referenceExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(util.Prioritized(referenceParser{}, 500)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(referenceRenderer{}, 500)))
+}
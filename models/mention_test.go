@@ -0,0 +1,127 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{"no tags here", nil},
+		{"loved it #SciFi #sci-fi #Fantasy", []string{"scifi", "fantasy"}},
+		{"chapter #1 and issue#2", nil},
+		{"see example.com/#anchor", nil},
+		{"#one #two #three #four #five #six", []string{"one", "two", "three", "four", "five"}},
+		{"use `#include <stdio.h>` in #c", []string{"c"}},
+		{"```\n#define MAX 10\n```\n#macros", []string{"macros"}},
+		{"[#spoilers ahead](/posts/1) #review", []string{"review"}},
+	}
+
+	for _, c := range cases {
+		if got := ExtractHashtags(SanitizeInput(c.text)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: expected %v; got %v", c.text, c.want, got)
+		}
+	}
+}
+
+func TestAddHashtags(t *testing.T) {
+	got := AddHashtags([]string{"fantasy"}, SanitizeInput("#Fantasy and #horror"))
+	if want := []string{"fantasy", "horror"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v; got %v", want, got)
+	}
+
+	full := []string{"a", "b", "c", "d", "e"}
+	if got := AddHashtags(full, "#extra"); len(got) != MaxTagsPerPost {
+		t.Errorf("expected at most %d tags; got %v", MaxTagsPerPost, got)
+	}
+}
+
+func TestGetMentionedPostsByUser(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	readerID := registerTestUser(t, "reader")
+	bystanderID := registerTestUser(t, "bystander")
+	postID, err := CreatePost(authorID, "Book club", SanitizeInput("@reader and @author, read #Dune"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherID := createTestPost(t, authorID, "no mentions")
+	for _, comment := range []struct{ postID, content string }{
+		{otherID, "@reader @reader @nobody"},
+		{postID, "again, @reader"},
+	} {
+		if _, err := CreateComment(comment.postID, authorID, comment.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Users find the posts they are mentioned in, in the post or in a comment, once each;
+	// the author mentioning themselves is not stored
+	tests := []struct {
+		name   string
+		userID string
+		want   int
+	}{
+		{"reader", readerID, 2},
+		{"author", authorID, 0},
+		{"bystander", bystanderID, 0},
+	}
+	for _, test := range tests {
+		posts, err := GetMentionedPostsByUser(test.userID)
+		if err != nil || len(posts) != test.want {
+			t.Errorf("%s: expected %d posts; got %v (%v)", test.name, test.want, posts, err)
+		}
+	}
+}
+
+func TestHashtagsBecomeTags(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	content := SanitizeInput("Read #Dune")
+	postID := createTestPost(t, authorID, content)
+	if err := SetPostTags(postID, AddHashtags(nil, content)); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := GetTagsForPost(postID)
+	if err != nil || len(tags) != 1 || tags[0] != "dune" {
+		t.Errorf("expected the hashtag as a tag; got %v (%v)", tags, err)
+	}
+	post, err := GetPostByID(postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(post.Content), `<a href="/tags/dune" rel="nofollow">#Dune</a>`) {
+		t.Errorf("expected a link to the tag; got %q", post.Content)
+	}
+}
+
+func TestSuggestUsernames(t *testing.T) {
+	setupTestDB(t)
+
+	for _, username := range []string{"reader2", "reader", "author"} {
+		registerTestUser(t, username)
+	}
+
+	// Usernames are completed from their start, shortest first
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"@Read", []string{"reader", "reader2"}},
+		{"auth", []string{"author"}},
+		{"eader", nil},
+	}
+	for _, test := range tests {
+		usernames, err := SuggestUsernames(test.prefix, 5)
+		if err != nil || !reflect.DeepEqual(usernames, test.want) {
+			t.Errorf("SuggestUsernames(%q) = %v (%v); want %v", test.prefix, usernames, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrPostLocked    = errors.New("post locked")
+	ErrPostArchived  = errors.New("post archived")
+	ErrNotInCategory = errors.New("post not in category")
+)
+
+// PostPin is a place a post can be pinned in: the main feed, or one of the post's categories.
+type PostPin struct {
+	CategoryID   string // empty for the main feed
+	CategoryName string
+	Pinned       bool
+}
+
+// PinPost pins a post at the top of the main feed, or of one of its categories when categoryID is set.
+func PinPost(postID, categoryID string) error {
+	if categoryID != "" {
+		var inCategory bool
+		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM post_categories WHERE post_id = ? AND category_id = ?)", postID, categoryID).Scan(&inCategory)
+		if err != nil {
+			return err
+		}
+		if !inCategory {
+			return ErrNotInCategory
+		}
+	}
+	_, err := db.Exec("INSERT OR IGNORE INTO pinned_posts (post_id, category_id, pinned_at) VALUES (?, ?, ?)", postID, categoryID, time.Now())
+	return err
+}
+
+// UnpinPost removes a post from the top of the main feed, or of a category.
+func UnpinPost(postID, categoryID string) error {
+	_, err := db.Exec("DELETE FROM pinned_posts WHERE post_id = ? AND category_id = ?", postID, categoryID)
+	return err
+}
+
+// GetPostPins lists where a post can be pinned and whether it is, main feed first.
+func GetPostPins(postID string) ([]PostPin, error) {
+	rows, err := db.Query(`
+        SELECT '', '', EXISTS(SELECT 1 FROM pinned_posts WHERE post_id = ? AND category_id = '')
+        UNION ALL
+        SELECT categories.id, categories.name, pinned_posts.post_id IS NOT NULL
+        FROM post_categories
+        JOIN categories ON categories.id = post_categories.category_id
+        LEFT JOIN pinned_posts ON pinned_posts.post_id = post_categories.post_id AND pinned_posts.category_id = categories.id
+        WHERE post_categories.post_id = ?
+    `, postID, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pins []PostPin
+	for rows.Next() {
+		var pin PostPin
+		if err := rows.Scan(&pin.CategoryID, &pin.CategoryName, &pin.Pinned); err != nil {
+			return nil, err
+		}
+		pins = append(pins, pin)
+	}
+	return pins, rows.Err()
+}
+
+// GetPinnedPosts returns the posts pinned at the top of the main feed, or of a category when
+// categoryID is set, most recently pinned first.
+func GetPinnedPosts(categoryID string) ([]Post, error) {
+	rows, err := db.Query(`
+        SELECT posts.id, posts.content, posts.created_at, posts.likes, posts.dislikes, posts.image_path, posts.title, posts.spoiler_for, posts.locked, posts.archived_at, users.username
+        FROM pinned_posts
+        JOIN posts ON pinned_posts.post_id = posts.id
+        JOIN users ON posts.user_id = users.id
+        WHERE pinned_posts.category_id = ? AND posts.publish_at IS NULL
+        ORDER BY pinned_posts.pinned_at DESC
+    `, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts, err := scanPosts(rows)
+	for i := range posts {
+		posts[i].Pinned = true
+	}
+	return posts, err
+}
+
+// SetPostLocked locks a post so it takes no new comments, or unlocks it.
+func SetPostLocked(postID string, locked bool) error {
+	result, err := db.Exec("UPDATE posts SET locked = ? WHERE id = ?", locked, postID)
+	if err != nil {
+		return err
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UnarchivePost reopens an archived post. It is archived again only after another full period
+// without activity, counted from now.
+func UnarchivePost(postID string, now time.Time) error {
+	result, err := db.Exec("UPDATE posts SET archived_at = NULL, reopened_at = ? WHERE id = ?", now, postID)
+	if err != nil {
+		return err
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CheckPostOpen returns ErrPostArchived for archived posts, which are read-only, and
+// ErrPostLocked for locked ones when a comment is being added. Scheduled posts are not found.
+func CheckPostOpen(postID string, commenting bool) error {
+	var locked bool
+	var archivedAt sql.NullTime
+	err := db.QueryRow("SELECT locked, archived_at FROM posts WHERE id = ? AND publish_at IS NULL", postID).Scan(&locked, &archivedAt)
+	if err != nil {
+		return err
+	}
+	if archivedAt.Valid {
+		return ErrPostArchived
+	}
+	if commenting && locked {
+		return ErrPostLocked
+	}
+	return nil
+}
+
+// ArchiveInactivePosts archives the published posts without a new comment for the inactivity
+// period, counting from the latest comment, the post itself or when it was last unarchived.
+// Pinned posts stay open.
+// It returns how many posts it archived.
+func ArchiveInactivePosts(now time.Time, inactivity time.Duration) (int, error) {
+	result, err := db.Exec(`
+        UPDATE posts SET archived_at = ?
+        WHERE archived_at IS NULL AND publish_at IS NULL
+            AND id NOT IN (SELECT post_id FROM pinned_posts)
+            AND max(julianday(created_at), COALESCE(julianday(reopened_at), 0), COALESCE((SELECT max(julianday(comments.created_at)) FROM comments WHERE comments.post_id = posts.id), 0)) < julianday(?)
+    `, now, now.Add(-inactivity))
+	if err != nil {
+		return 0, err
+	}
+	archived, err := result.RowsAffected()
+	return int(archived), err
+}
+
+// ArchiveAfter returns the inactivity period after which posts are archived, or 0 when they never are.
+func ArchiveAfter() (time.Duration, error) {
+	days, err := GetIntSetting(SettingArchiveAfterDays, 0)
+	if err != nil || days <= 0 {
+		return 0, err
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
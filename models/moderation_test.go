@@ -0,0 +1,198 @@
+package models
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestPinPost(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	categoryID, err := CreateCategory("Announcements", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCategoryID, err := CreateCategory("Reviews", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	postID := createTestPost(t, authorID, "Be kind")
+	if err := AddCategoryToPost(postID, categoryID); err != nil {
+		t.Fatal(err)
+	}
+
+	// A post is pinned in the main feed and in its category, but not in another category
+	tests := []struct {
+		categoryID string
+		wantErr    error
+	}{
+		{"", nil},
+		{categoryID, nil},
+		{otherCategoryID, ErrNotInCategory},
+	}
+	for _, test := range tests {
+		if err := PinPost(postID, test.categoryID); err != test.wantErr {
+			t.Errorf("pinning in %q: expected %v; got %v", test.categoryID, test.wantErr, err)
+		}
+	}
+	for _, id := range []string{"", categoryID} {
+		pinned, err := GetPinnedPosts(id)
+		if err != nil || len(pinned) != 1 || pinned[0].ID != postID || !pinned[0].Pinned {
+			t.Errorf("expected the post pinned in %q; got %+v (%v)", id, pinned, err)
+		}
+	}
+	pins, err := GetPostPins(postID)
+	if err != nil || len(pins) != 2 || pins[0].CategoryID != "" || !pins[0].Pinned || pins[1].CategoryName != "Announcements" || !pins[1].Pinned {
+		t.Errorf("expected the post pinned in the feed and its category; got %+v (%v)", pins, err)
+	}
+
+	if err := UnpinPost(postID, categoryID); err != nil {
+		t.Fatal(err)
+	}
+	if pinned, err := GetPinnedPosts(categoryID); err != nil || len(pinned) != 0 {
+		t.Errorf("expected the post unpinned from its category; got %+v (%v)", pinned, err)
+	}
+}
+
+func TestSetPostLocked(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	postID := createTestPost(t, authorID, "Anyone?")
+	if err := SetPostLocked(postID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetPostLocked("no-such-post", true); err != sql.ErrNoRows {
+		t.Errorf("expected locking a missing post to fail; got %v", err)
+	}
+	if post, err := GetPostByID(postID); err != nil || !post.Locked || post.Archived {
+		t.Errorf("expected the post locked; got %+v (%v)", post, err)
+	}
+
+	// A locked post takes reactions but no comments
+	tests := []struct {
+		commenting bool
+		wantErr    error
+	}{
+		{true, ErrPostLocked},
+		{false, nil},
+	}
+	for _, test := range tests {
+		if err := CheckPostOpen(postID, test.commenting); err != test.wantErr {
+			t.Errorf("commenting %v: expected %v; got %v", test.commenting, test.wantErr, err)
+		}
+	}
+}
+
+func TestArchiveInactivePosts(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	readerID := registerTestUser(t, "reader")
+	pinnedID := createTestPost(t, authorID, "Be kind")
+	if err := PinPost(pinnedID, ""); err != nil {
+		t.Fatal(err)
+	}
+	oldPostID := createTestPost(t, authorID, "Anyone?")
+	discussedID := createTestPost(t, authorID, "Still talking")
+	now := time.Now()
+	if _, err := db.Exec("UPDATE posts SET created_at = ?", now.Add(-3*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateComment(discussedID, readerID, "Not yet"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Posts are archived after the inactivity period, counting from the latest comment;
+	// pinned posts stay open
+	if archived, err := ArchiveInactivePosts(now, 4*time.Hour); err != nil || archived != 0 {
+		t.Errorf("expected no post inactive for four hours yet; got %d (%v)", archived, err)
+	}
+	if archived, err := ArchiveInactivePosts(now, time.Hour); err != nil || archived != 1 {
+		t.Errorf("expected only the old post archived; got %d (%v)", archived, err)
+	}
+	tests := []struct {
+		name    string
+		postID  string
+		wantErr error
+	}{
+		{"inactive", oldPostID, ErrPostArchived},
+		{"recently commented", discussedID, nil},
+		{"pinned", pinnedID, nil},
+	}
+	for _, test := range tests {
+		if err := CheckPostOpen(test.postID, false); err != test.wantErr {
+			t.Errorf("%s: expected %v; got %v", test.name, test.wantErr, err)
+		}
+	}
+	posts, err := GetFilteredPosts(PostFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, post := range posts {
+		if post.Archived != (post.ID == oldPostID) {
+			t.Errorf("expected only the old post archived; got %+v", post)
+		}
+	}
+}
+
+func TestArchiveAfter(t *testing.T) {
+	setupTestDB(t)
+
+	// The archiving period comes from the site settings
+	tests := []struct {
+		days string
+		want time.Duration
+	}{
+		{"", 0},
+		{"30", 30 * 24 * time.Hour},
+		{"0", 0},
+	}
+	for _, test := range tests {
+		if test.days != "" {
+			if err := SetSetting(SettingArchiveAfterDays, test.days); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if period, err := ArchiveAfter(); err != nil || period != test.want {
+			t.Errorf("%q days: expected %v; got %v (%v)", test.days, test.want, period, err)
+		}
+	}
+}
+
+func TestUnarchivePost(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	postID := createTestPost(t, authorID, "Anyone?")
+	now := time.Now()
+	if _, err := ArchiveInactivePosts(now.Add(2*time.Hour), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := UnarchivePost("no-such-post", now); err != sql.ErrNoRows {
+		t.Errorf("expected unarchiving a missing post to fail; got %v", err)
+	}
+
+	// An unarchived post is open again until another full period passes
+	reopenedAt := now.Add(3 * time.Hour)
+	if err := UnarchivePost(postID, reopenedAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckPostOpen(postID, true); err != nil {
+		t.Errorf("expected the post open again; got %v", err)
+	}
+	tests := []struct {
+		now  time.Time
+		want int
+	}{
+		{reopenedAt.Add(30 * time.Minute), 0},
+		{reopenedAt.Add(2 * time.Hour), 1},
+	}
+	for _, test := range tests {
+		if archived, err := ArchiveInactivePosts(test.now, time.Hour); err != nil || archived != test.want {
+			t.Errorf("%v after reopening: expected %d archived; got %d (%v)", test.now.Sub(reopenedAt), test.want, archived, err)
+		}
+	}
+}
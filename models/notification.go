@@ -0,0 +1,196 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Notification types; each one can be turned off in the notification preferences.
+const (
+	NotificationComment     = "comment"      // someone commented on your post
+	NotificationPostLike    = "post_like"    // someone liked your post
+	NotificationCommentLike = "comment_like" // someone liked your comment
+	NotificationMention     = "mention"      // someone mentioned you in a post or comment
+)
+
+// NotificationTypes lists every notification type in the order preferences are shown.
+var NotificationTypes = []string{NotificationComment, NotificationPostLike, NotificationCommentLike, NotificationMention}
+
+// Notification is an event shown to a user on their notifications page.
+type Notification struct {
+	ID                 string
+	Type               string
+	Actor              string // username of the user who caused it
+	PostID             string
+	CommentID          string
+	CreatedAtFormatted string
+	Read               bool
+}
+
+// maxMentionsPerText bounds how many users a single post or comment can notify.
+const maxMentionsPerText = 10
+
+// ExtractMentions returns the distinct usernames mentioned as @username in stored content.
+// Only the mentions rendered as links count, so an @ in code or in the text of a link does
+// not notify anyone.
+func ExtractMentions(stored string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, username := range linkedReferences(stored, "/user/") {
+		if seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+		if len(usernames) == maxMentionsPerText {
+			break
+		}
+	}
+	return usernames
+}
+
+// createNotification stores a notification for userID unless the user caused it themselves,
+// turned the type off, or already has the same unread notification.
+func createNotification(userID, actorID, notificationType, postID, commentID string) error {
+	if userID == actorID {
+		return nil
+	}
+
+	enabled, err := IsNotificationEnabled(userID, notificationType)
+	if err != nil || !enabled {
+		return err
+	}
+
+	var duplicate bool
+	err = db.QueryRow(`
+        SELECT EXISTS(SELECT 1 FROM notifications
+                      WHERE user_id = ? AND actor_id = ? AND type = ? AND post_id = ? AND comment_id = ? AND read_at IS NULL)
+    `, userID, actorID, notificationType, postID, commentID).Scan(&duplicate)
+	if err != nil || duplicate {
+		return err
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("INSERT INTO notifications (id, user_id, actor_id, type, post_id, comment_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		id.String(), userID, actorID, notificationType, postID, commentID, time.Now())
+	return err
+}
+
+// logNotificationError logs a notification that could not be created. The comment, like or post it is
+// about is saved already, so it is not reported as failed: a retry would save it a second time.
+func logNotificationError(err error) {
+	if err != nil {
+		log.Println("Error creating notification:", err)
+	}
+}
+
+// notifyPostAuthor notifies the author of a post about something another user did to it.
+func notifyPostAuthor(actorID, notificationType, postID, commentID string) error {
+	var authorID string
+	err := db.QueryRow("SELECT user_id FROM posts WHERE id = ?", postID).Scan(&authorID)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return createNotification(authorID, actorID, notificationType, postID, commentID)
+}
+
+// notifyCommentAuthor notifies the author of a comment about a like.
+func notifyCommentAuthor(actorID, commentID string) error {
+	var authorID, postID string
+	err := db.QueryRow("SELECT user_id, post_id FROM comments WHERE id = ?", commentID).Scan(&authorID, &postID)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return createNotification(authorID, actorID, NotificationCommentLike, postID, commentID)
+}
+
+// GetNotifications retrieves the latest notifications of a user, newest first.
+func GetNotifications(userID string, limit int) ([]Notification, error) {
+	rows, err := db.Query(`
+        SELECT notifications.id, notifications.type, COALESCE(users.username, ''), notifications.post_id,
+               notifications.comment_id, notifications.created_at, notifications.read_at IS NOT NULL
+        FROM notifications
+        LEFT JOIN users ON notifications.actor_id = users.id
+        WHERE notifications.user_id = ?
+        ORDER BY notifications.created_at DESC
+        LIMIT ?
+    `, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		var createdAt time.Time
+		if err := rows.Scan(&n.ID, &n.Type, &n.Actor, &n.PostID, &n.CommentID, &createdAt, &n.Read); err != nil {
+			return nil, err
+		}
+		n.CreatedAtFormatted = createdAt.Format("02.01.2006 15:04")
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// CountUnreadNotifications returns how many notifications the user has not read yet.
+func CountUnreadNotifications(userID string) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL", userID).Scan(&count)
+	return count, err
+}
+
+// MarkNotificationRead marks one of the user's notifications as read.
+func MarkNotificationRead(userID, notificationID string) error {
+	_, err := db.Exec("UPDATE notifications SET read_at = ? WHERE id = ? AND user_id = ? AND read_at IS NULL",
+		time.Now(), notificationID, userID)
+	return err
+}
+
+// MarkAllNotificationsRead marks every notification of the user as read.
+func MarkAllNotificationsRead(userID string) error {
+	_, err := db.Exec("UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL", time.Now(), userID)
+	return err
+}
+
+// IsNotificationEnabled reports whether the user wants notifications of a type; all types are on by default.
+func IsNotificationEnabled(userID, notificationType string) (bool, error) {
+	var enabled bool
+	err := db.QueryRow("SELECT enabled FROM notification_preferences WHERE user_id = ? AND type = ?", userID, notificationType).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	return enabled, err
+}
+
+// GetNotificationPreferences returns whether each notification type is enabled for the user.
+func GetNotificationPreferences(userID string) (map[string]bool, error) {
+	preferences := make(map[string]bool)
+	for _, notificationType := range NotificationTypes {
+		enabled, err := IsNotificationEnabled(userID, notificationType)
+		if err != nil {
+			return nil, err
+		}
+		preferences[notificationType] = enabled
+	}
+	return preferences, nil
+}
+
+// SetNotificationPreference turns a notification type on or off for the user.
+func SetNotificationPreference(userID, notificationType string, enabled bool) error {
+	_, err := db.Exec(`
+        INSERT INTO notification_preferences (user_id, type, enabled) VALUES (?, ?, ?)
+        ON CONFLICT(user_id, type) DO UPDATE SET enabled = excluded.enabled
+    `, userID, notificationType, enabled)
+	return err
+}
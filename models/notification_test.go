@@ -0,0 +1,153 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractMentions(t *testing.T) {
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{"no mentions here", nil},
+		{"thanks @alice!", []string{"alice"}},
+		{"@bob. and @bob again", []string{"bob"}},
+		{"ask @book.worm or @читатель", []string{"book.worm", "читатель"}},
+		{"email me at reader@example.com", nil},
+		{"@carol: first", []string{"carol"}},
+		{"run `npm i @types/node` then ask @dave", []string{"dave"}},
+		{"```\n@decorator\ndef f(): pass\n```\nthanks @erin", []string{"erin"}},
+		{"Example:\n\n    @indented code", nil},
+		{"<b>@frank</b> & @grace", []string{"frank", "grace"}},
+		{"[@bob's review](/posts/1) by @henry", []string{"henry"}},
+	}
+
+	for _, c := range cases {
+		if got := ExtractMentions(SanitizeInput(c.text)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: expected %v; got %v", c.text, c.want, got)
+		}
+	}
+}
+
+func TestNotifyAuthors(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	readerID := registerTestUser(t, "reader")
+	postID := createTestPost(t, authorID, "A post")
+	ownCommentID, err := CreateComment(postID, authorID, "My own comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Users are not notified about what they do themselves, nor twice about the same unread event
+	tests := []struct {
+		name   string
+		action func() error
+		want   int
+	}{
+		{"own comment", func() error { _, err := CreateComment(postID, authorID, "Another"); return err }, 0},
+		{"own post like", func() error { return LikePost(authorID, postID) }, 0},
+		{"own comment like", func() error { return LikeComment(authorID, ownCommentID) }, 0},
+		{"own mention", func() error { _, err := CreateComment(postID, authorID, "@author"); return err }, 0},
+		{"comment", func() error { _, err := CreateComment(postID, readerID, "Nice"); return err }, 1},
+		{"post like", func() error { return LikePost(readerID, postID) }, 2},
+		{"comment like", func() error { return LikeComment(readerID, ownCommentID) }, 3},
+		{"repeated post like", func() error {
+			if err := LikePost(readerID, postID); err != nil {
+				return err
+			}
+			return LikePost(readerID, postID)
+		}, 3},
+		{"mention", func() error { _, err := CreateComment(postID, readerID, "@author look"); return err }, 5},
+	}
+	for _, test := range tests {
+		if err := test.action(); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if count, err := CountUnreadNotifications(authorID); err != nil || count != test.want {
+			t.Errorf("%s: expected %d unread notifications; got %d (%v)", test.name, test.want, count, err)
+		}
+	}
+	if count, err := CountUnreadNotifications(readerID); err != nil || count != 0 {
+		t.Errorf("expected no notifications for the reader; got %d (%v)", count, err)
+	}
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	readerID := registerTestUser(t, "reader")
+	postID := createTestPost(t, authorID, "A post")
+
+	preferences, err := GetNotificationPreferences(authorID)
+	if err != nil || len(preferences) != len(NotificationTypes) || !preferences[NotificationComment] {
+		t.Fatalf("expected every type on by default; got %v (%v)", preferences, err)
+	}
+	if err := SetNotificationPreference(authorID, NotificationComment, false); err != nil {
+		t.Fatal(err)
+	}
+	if enabled, err := IsNotificationEnabled(authorID, NotificationComment); err != nil || enabled {
+		t.Errorf("expected comment notifications off; got %v (%v)", enabled, err)
+	}
+
+	// Turned off types are skipped; the others still arrive
+	if _, err := CreateComment(postID, readerID, "Nice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := LikePost(readerID, postID); err != nil {
+		t.Fatal(err)
+	}
+	notifications, err := GetNotifications(authorID, 10)
+	if err != nil || len(notifications) != 1 || notifications[0].Type != NotificationPostLike || notifications[0].Actor != "reader" {
+		t.Errorf("expected only the like; got %+v (%v)", notifications, err)
+	}
+}
+
+func TestMarkNotificationsRead(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	readerID := registerTestUser(t, "reader")
+	postID := createTestPost(t, authorID, "A post")
+	for _, content := range []string{"First", "Second", "Third"} {
+		if _, err := CreateComment(postID, readerID, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	notifications, err := GetNotifications(authorID, 10)
+	if err != nil || len(notifications) != 3 {
+		t.Fatalf("expected 3 notifications; got %+v (%v)", notifications, err)
+	}
+
+	// Only the owner marks a notification read; it then stays listed as read
+	tests := []struct {
+		name string
+		mark func() error
+		want int
+	}{
+		{"another user", func() error { return MarkNotificationRead(readerID, notifications[0].ID) }, 3},
+		{"one", func() error { return MarkNotificationRead(authorID, notifications[0].ID) }, 2},
+		{"the same again", func() error { return MarkNotificationRead(authorID, notifications[0].ID) }, 2},
+		{"all", func() error { return MarkAllNotificationsRead(authorID) }, 0},
+	}
+	for _, test := range tests {
+		if err := test.mark(); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if count, err := CountUnreadNotifications(authorID); err != nil || count != test.want {
+			t.Errorf("%s: expected %d unread; got %d (%v)", test.name, test.want, count, err)
+		}
+	}
+	notifications, err = GetNotifications(authorID, 10)
+	if err != nil || len(notifications) != 3 {
+		t.Fatalf("expected the read notifications listed; got %+v (%v)", notifications, err)
+	}
+	for _, n := range notifications {
+		if !n.Read {
+			t.Errorf("expected %s read", n.ID)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package models
+
+import (
+	"bufio"
+	_ "embed"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PolicyError is a password or username rule violation; its message is shown to the user.
+type PolicyError struct {
+	Message string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Message
+}
+
+// PasswordPolicy describes which passwords are accepted at registration, reset and change.
+type PasswordPolicy struct {
+	MinLength int  // minimum number of characters
+	MaxLength int  // maximum number of bytes; bcrypt ignores everything after 72
+	Blocklist bool // reject passwords from the bundled common-password list
+}
+
+var passwordPolicy = PasswordPolicy{MinLength: 8, MaxLength: 72, Blocklist: true}
+
+// bcryptCost is the cost used for new hashes; older hashes are upgraded on the next login.
+var bcryptCost = bcrypt.DefaultCost
+
+// SetPasswordPolicy replaces the password policy.
+func SetPasswordPolicy(policy PasswordPolicy) {
+	passwordPolicy = policy
+}
+
+// GetPasswordPolicy returns the password policy, e.g. to describe it on forms.
+func GetPasswordPolicy() PasswordPolicy {
+	return passwordPolicy
+}
+
+// SetBcryptCost changes the cost used for new password hashes.
+func SetBcryptCost(cost int) {
+	if cost >= bcrypt.MinCost && cost <= bcrypt.MaxCost {
+		bcryptCost = cost
+	}
+}
+
+func hashPassword(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+}
+
+//go:embed data/common_passwords.txt
+var commonPasswordsFile string
+
+var commonPasswords = loadWordList(commonPasswordsFile)
+
+// loadWordList reads one lowercased entry per line, skipping blank lines and # comments.
+func loadWordList(list string) map[string]bool {
+	words := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			words[strings.ToLower(line)] = true
+		}
+	}
+	return words
+}
+
+// ValidatePassword checks a new password against the policy and the account it belongs to.
+func ValidatePassword(password, username, email string) error {
+	policy := passwordPolicy
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		return &PolicyError{Message: "Password must be at least " + strconv.Itoa(policy.MinLength) + " characters long"}
+	}
+	if policy.MaxLength > 0 && len(password) > policy.MaxLength {
+		return &PolicyError{Message: "Password must be at most " + strconv.Itoa(policy.MaxLength) + " bytes long"}
+	}
+
+	lower := strings.ToLower(password)
+	if policy.Blocklist && commonPasswords[lower] {
+		return &PolicyError{Message: "This password is too common, please choose another one"}
+	}
+
+	localPart, _, _ := strings.Cut(strings.ToLower(email), "@")
+	if (username != "" && lower == strings.ToLower(username)) || lower == strings.ToLower(email) || (localPart != "" && lower == localPart) {
+		return &PolicyError{Message: "Password must not be the same as your username or email"}
+	}
+	return nil
+}
+
+// Username rules.
+const (
+	usernameMinLength = 3
+	usernameMaxLength = 20
+)
+
+// reservedUsernames cannot be registered, nor can names that look like them.
+var reservedUsernames = []string{
+	"admin", "administrator", "root", "system", "moderator", "mod", "staff", "support",
+	"help", "forum", "official", "anonymous", "guest", "null", "undefined", "deleted",
+}
+
+// ValidateUsername checks the format of a username and that it cannot be mistaken for a
+// reserved name or an existing user. It does not check for an exact duplicate.
+func ValidateUsername(username string) error {
+	if err := checkUsernameFormat(username); err != nil {
+		return err
+	}
+
+	skeleton := UsernameSkeleton(username)
+	for _, reserved := range reservedUsernames {
+		if skeleton == UsernameSkeleton(reserved) {
+			return &PolicyError{Message: "This username is reserved"}
+		}
+	}
+
+	// Exact duplicates are left to CheckUsernameExists
+	var similar bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username_skeleton = ? AND username != ?)", skeleton, username).Scan(&similar)
+	if err != nil {
+		return err
+	}
+	if similar {
+		return &PolicyError{Message: "This username is too similar to an existing one"}
+	}
+	return nil
+}
+
+// checkUsernameFormat enforces length and allowed characters. Letters may be Latin or
+// Cyrillic but not both, which rules out names like "аdmin" with a Cyrillic "а".
+func checkUsernameFormat(username string) error {
+	length := utf8.RuneCountInString(username)
+	if length < usernameMinLength || length > usernameMaxLength {
+		return &PolicyError{Message: "Username must be between " + strconv.Itoa(usernameMinLength) + " and " + strconv.Itoa(usernameMaxLength) + " characters long"}
+	}
+
+	var latin, cyrillic bool
+	for _, r := range username {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)), r == '_', r == '-', r == '.':
+			latin = latin || unicode.IsLetter(r)
+		case unicode.Is(unicode.Cyrillic, r) && unicode.IsLetter(r):
+			cyrillic = true
+		default:
+			return &PolicyError{Message: "Username may only contain letters, digits, dots, dashes and underscores"}
+		}
+	}
+	if latin && cyrillic {
+		return &PolicyError{Message: "Username must not mix Latin and Cyrillic letters"}
+	}
+
+	first, _ := utf8.DecodeRuneInString(username)
+	last, _ := utf8.DecodeLastRuneInString(username)
+	if !unicode.IsLetter(first) && !unicode.IsDigit(first) || !unicode.IsLetter(last) && !unicode.IsDigit(last) {
+		return &PolicyError{Message: "Username must start and end with a letter or digit"}
+	}
+	return nil
+}
+
+// confusables maps characters to the Latin letter they are easily mistaken for.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'з': '3', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o',
+	'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ь': 'b', 'і': 'l', 'ј': 'j', 'ѕ': 's',
+	'ԁ': 'd', 'һ': 'h', 'ӏ': 'l', 'ԛ': 'q', 'ԝ': 'w',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'l', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p',
+	'τ': 't', 'υ': 'u', 'χ': 'x',
+	// Latin lookalikes; i and l are folded together since a capital I looks like an l
+	'i': 'l', 'ı': 'l', 'ɡ': 'g', '0': 'o', '1': 'l', '5': 's',
+}
+
+// UsernameSkeleton reduces a username to a form in which names that look alike are equal:
+// case, separators and lookalike characters are folded away.
+func UsernameSkeleton(username string) string {
+	var b strings.Builder
+	for _, r := range username {
+		r = unicode.ToLower(r)
+		if r == '_' || r == '-' || r == '.' {
+			continue
+		}
+		if mapped, ok := confusables[r]; ok {
+			r = mapped
+		}
+		b.WriteRune(r)
+	}
+	// "rn" reads as "m"
+	return strings.ReplaceAll(b.String(), "rn", "m")
+}
+
+// BackfillUsernameSkeletons computes the skeleton of users created before skeletons were stored.
+func BackfillUsernameSkeletons() error {
+	rows, err := db.Query("SELECT id, username FROM users WHERE username_skeleton IS NULL")
+	if err != nil {
+		return err
+	}
+	type user struct{ id, username string }
+	var users []user
+	for rows.Next() {
+		var u user
+		if err := rows.Scan(&u.id, &u.username); err != nil {
+			rows.Close()
+			return err
+		}
+		users = append(users, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		if _, err := db.Exec("UPDATE users SET username_skeleton = ? WHERE id = ?", UsernameSkeleton(u.username), u.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package models
+
+import "testing"
+
+func TestValidatePassword(t *testing.T) {
+	cases := []struct {
+		password string
+		valid    bool
+	}{
+		{"", false},
+		{"short", false},
+		{"password123", false}, // on the bundled blocklist
+		{"QWERTYUIOP", false},  // blocklist is case-insensitive
+		{"bookreader", false},  // same as the username
+		{"reader@example.com", false},
+		{"reader", false},
+		{"correct horse battery", true},
+	}
+
+	for _, c := range cases {
+		err := ValidatePassword(c.password, "BookReader", "reader@example.com")
+		if (err == nil) != c.valid {
+			t.Errorf("%q: expected valid=%v; got %v", c.password, c.valid, err)
+		}
+	}
+}
+
+func TestCheckUsernameFormat(t *testing.T) {
+	cases := []struct {
+		username string
+		valid    bool
+	}{
+		{"literatureFan", true},
+		{"book.worm-42", true},
+		{"читатель", true},
+		{"ab", false},
+		{"averyveryverylongusername", false},
+		{"_reader", false},
+		{"reader!", false},
+		{"аdmin", false}, // Cyrillic "а" followed by Latin letters
+		{"αlpha", false}, // Greek letters are not allowed
+	}
+
+	for _, c := range cases {
+		err := checkUsernameFormat(c.username)
+		if (err == nil) != c.valid {
+			t.Errorf("%q: expected valid=%v; got %v", c.username, c.valid, err)
+		}
+	}
+}
+
+func TestUsernameSkeleton(t *testing.T) {
+	alike := [][2]string{
+		{"Paul", "PauI"},
+		{"admin", "аdmin"},
+		{"modern", "modem"},
+		{"book_worm", "Book.Worm"},
+		{"reader0", "readerO"},
+		{"соль", "coлb"},
+	}
+	for _, pair := range alike {
+		if UsernameSkeleton(pair[0]) != UsernameSkeleton(pair[1]) {
+			t.Errorf("expected %q and %q to look alike", pair[0], pair[1])
+		}
+	}
+
+	if UsernameSkeleton("reader") == UsernameSkeleton("leader") {
+		t.Errorf("expected reader and leader to differ")
+	}
+}
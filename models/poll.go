@@ -0,0 +1,344 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Limits on polls.
+const (
+	MinPollOptions        = 2
+	MaxPollOptions        = 10
+	MaxPollQuestionLength = 200
+	MaxPollOptionLength   = 100
+)
+
+var (
+	ErrPollQuestion  = errors.New("poll question missing or too long")
+	ErrPollOptions   = errors.New("wrong number of poll options")
+	ErrPollOption    = errors.New("poll option too long")
+	ErrPollClosed    = errors.New("poll closed")
+	ErrAlreadyVoted  = errors.New("already voted")
+	ErrInvalidChoice = errors.New("invalid poll choice")
+)
+
+// Poll is an optional vote attached to a post.
+type Poll struct {
+	ID                string
+	PostID            string
+	Question          string
+	Multiple          bool // voters may choose several options
+	Anonymous         bool // nobody sees who voted for what
+	ClosesAtFormatted string
+	Closed            bool
+	Options           []PollOption
+	Voters            int  // how many users voted
+	Voted             bool // whether the viewer voted
+	CanVote           bool // whether the viewer is logged in and can still vote in the open poll
+}
+
+// PollOption is one answer of a poll with its results.
+type PollOption struct {
+	ID      string
+	Text    string
+	Votes   int
+	Percent int      // share of the voters who chose it
+	Chosen  bool     // whether the viewer chose it
+	Voters  []string // usernames, for polls that are not anonymous
+}
+
+// ParsePollOptions reads the options of a new poll, one per line, dropping blank lines and repeats.
+func ParsePollOptions(input string) []string {
+	var options []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(input, "\n") {
+		option := strings.TrimSpace(line)
+		if option == "" || seen[strings.ToLower(option)] {
+			continue
+		}
+		seen[strings.ToLower(option)] = true
+		options = append(options, option)
+	}
+	return options
+}
+
+// ValidatePoll checks the question and options of a new poll.
+func ValidatePoll(question string, options []string) error {
+	question = strings.TrimSpace(question)
+	if question == "" || utf8.RuneCountInString(question) > MaxPollQuestionLength {
+		return ErrPollQuestion
+	}
+	if len(options) < MinPollOptions || len(options) > MaxPollOptions {
+		return ErrPollOptions
+	}
+	for _, option := range options {
+		if utf8.RuneCountInString(option) > MaxPollOptionLength {
+			return ErrPollOption
+		}
+	}
+	return nil
+}
+
+// CreatePoll attaches a poll to a post. A zero closesAt keeps the poll open.
+// The question and options are stored as typed; templates escape them.
+func CreatePoll(postID, question string, options []string, multiple, anonymous bool, closesAt time.Time) error {
+	if err := ValidatePoll(question, options); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := createPoll(tx, postID, question, options, multiple, anonymous, closesAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// createPoll inserts a validated poll and its options.
+func createPoll(ex execer, postID, question string, options []string, multiple, anonymous bool, closesAt time.Time) error {
+	pollID, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	var closes interface{}
+	if !closesAt.IsZero() {
+		closes = closesAt
+	}
+	_, err = ex.Exec("INSERT INTO polls (id, post_id, question, multiple, anonymous, closes_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		pollID.String(), postID, strings.TrimSpace(question), multiple, anonymous, closes, time.Now())
+	if err != nil {
+		return err
+	}
+	for position, option := range options {
+		optionID, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		_, err = ex.Exec("INSERT INTO poll_options (id, poll_id, position, text) VALUES (?, ?, ?, ?)",
+			optionID.String(), pollID.String(), position, option)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPoll retrieves the poll of a post with its results, marking the viewer's choices.
+// It returns nil when the post has no poll.
+func GetPoll(postID, viewerID string) (*Poll, error) {
+	polls, err := loadPolls(viewerID, []string{postID})
+	if err != nil {
+		return nil, err
+	}
+	return polls[postID], nil
+}
+
+// LoadPostPolls fills in the polls of the posts, for feeds.
+func LoadPostPolls(viewerID string, posts []Post) error {
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	polls, err := loadPolls(viewerID, ids)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].Poll = polls[posts[i].ID]
+	}
+	return nil
+}
+
+// loadPolls retrieves the polls of the posts with their results, keyed by post ID. It runs the
+// same few queries however many posts there are; posts without a poll are left out.
+func loadPolls(viewerID string, postIDs []string) (map[string]*Poll, error) {
+	polls := make(map[string]*Poll)
+	if len(postIDs) == 0 {
+		return polls, nil
+	}
+	args := make([]interface{}, len(postIDs))
+	for i, id := range postIDs {
+		args[i] = id
+	}
+	rows, err := db.Query("SELECT id, post_id, question, multiple, anonymous, closes_at FROM polls WHERE post_id IN ("+placeholders(len(postIDs))+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[string]*Poll)
+	var pollIDs []interface{}
+	for rows.Next() {
+		var poll Poll
+		var closesAt sql.NullTime
+		if err := rows.Scan(&poll.ID, &poll.PostID, &poll.Question, &poll.Multiple, &poll.Anonymous, &closesAt); err != nil {
+			return nil, err
+		}
+		if closesAt.Valid {
+			poll.ClosesAtFormatted = closesAt.Time.Format("02.01.2006 15:04")
+			poll.Closed = !time.Now().Before(closesAt.Time)
+		}
+		polls[poll.PostID] = &poll
+		byID[poll.ID] = &poll
+		pollIDs = append(pollIDs, poll.ID)
+	}
+	if err := rows.Err(); err != nil || len(pollIDs) == 0 {
+		return polls, err
+	}
+
+	if err := loadPollResults(viewerID, byID, pollIDs); err != nil {
+		return nil, err
+	}
+	if err := loadPollVoters(byID, pollIDs); err != nil {
+		return nil, err
+	}
+	for _, poll := range polls {
+		poll.CanVote = viewerID != "" && !poll.Voted && !poll.Closed
+	}
+	return polls, nil
+}
+
+// loadPollResults counts the voters and the votes for each option of the polls, marking the viewer's choices.
+func loadPollResults(viewerID string, polls map[string]*Poll, pollIDs []interface{}) error {
+	in := placeholders(len(pollIDs))
+	args := append([]interface{}{viewerID}, pollIDs...)
+
+	rows, err := db.Query("SELECT poll_id, COUNT(*), COALESCE(SUM(user_id = ?), 0) FROM poll_ballots WHERE poll_id IN ("+in+") GROUP BY poll_id", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pollID string
+		var voters int
+		var voted bool
+		if err := rows.Scan(&pollID, &voters, &voted); err != nil {
+			return err
+		}
+		polls[pollID].Voters, polls[pollID].Voted = voters, voted
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = db.Query(`
+        SELECT poll_options.poll_id, poll_options.id, poll_options.text, COUNT(poll_votes.user_id), COALESCE(SUM(poll_votes.user_id = ?), 0)
+        FROM poll_options
+        LEFT JOIN poll_votes ON poll_votes.option_id = poll_options.id
+        WHERE poll_options.poll_id IN (`+in+`)
+        GROUP BY poll_options.id
+        ORDER BY poll_options.position
+    `, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pollID string
+		var option PollOption
+		if err := rows.Scan(&pollID, &option.ID, &option.Text, &option.Votes, &option.Chosen); err != nil {
+			return err
+		}
+		poll := polls[pollID]
+		if poll.Voters > 0 {
+			option.Percent = option.Votes * 100 / poll.Voters
+		}
+		poll.Options = append(poll.Options, option)
+	}
+	return rows.Err()
+}
+
+// loadPollVoters fills in who chose each option of the polls that are not anonymous.
+func loadPollVoters(polls map[string]*Poll, pollIDs []interface{}) error {
+	rows, err := db.Query(`
+        SELECT poll_votes.poll_id, poll_votes.option_id, users.username
+        FROM poll_votes
+        JOIN polls ON polls.id = poll_votes.poll_id
+        JOIN users ON poll_votes.user_id = users.id
+        WHERE poll_votes.poll_id IN (`+placeholders(len(pollIDs))+`) AND NOT polls.anonymous
+        ORDER BY users.username
+    `, pollIDs...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	voters := make(map[string][]string)
+	for rows.Next() {
+		var pollID, optionID, username string
+		if err := rows.Scan(&pollID, &optionID, &username); err != nil {
+			return err
+		}
+		voters[optionID] = append(voters[optionID], username)
+	}
+	for _, poll := range polls {
+		if poll.Anonymous {
+			continue
+		}
+		for i := range poll.Options {
+			poll.Options[i].Voters = voters[poll.Options[i].ID]
+		}
+	}
+	return rows.Err()
+}
+
+// Vote records the user's choices in the poll of a post. Each user votes once, which the
+// primary key of poll_ballots enforces; single choice polls take exactly one option.
+func Vote(postID, userID string, optionIDs []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var pollID string
+	var multiple bool
+	var closesAt sql.NullTime
+	err = tx.QueryRow("SELECT id, multiple, closes_at FROM polls WHERE post_id = ?", postID).Scan(&pollID, &multiple, &closesAt)
+	if err != nil {
+		return err
+	}
+	if closesAt.Valid && !time.Now().Before(closesAt.Time) {
+		return ErrPollClosed
+	}
+
+	chosen := make(map[string]bool)
+	for _, optionID := range optionIDs {
+		chosen[optionID] = true
+	}
+	if len(chosen) == 0 || (!multiple && len(chosen) > 1) {
+		return ErrInvalidChoice
+	}
+
+	_, err = tx.Exec("INSERT INTO poll_ballots (poll_id, user_id, created_at) VALUES (?, ?, ?)", pollID, userID, time.Now())
+	if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.Code == sqlite3.ErrConstraint {
+		return ErrAlreadyVoted
+	} else if err != nil {
+		return err
+	}
+	for optionID := range chosen {
+		result, err := tx.Exec(`
+            INSERT INTO poll_votes (poll_id, user_id, option_id)
+            SELECT poll_id, ?, id FROM poll_options WHERE id = ? AND poll_id = ?
+        `, userID, optionID, pollID)
+		if err != nil {
+			return err
+		}
+		if inserted, err := result.RowsAffected(); err != nil {
+			return err
+		} else if inserted == 0 {
+			return ErrInvalidChoice
+		}
+	}
+	return tx.Commit()
+}
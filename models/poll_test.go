@@ -0,0 +1,201 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePollOptions(t *testing.T) {
+	got := ParsePollOptions("Dune\r\n\n  Emma \ndune\nUbik\n")
+	want := []string{"Dune", "Emma", "Ubik"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("ParsePollOptions = %q; want %q", got, want)
+	}
+}
+
+func TestValidatePoll(t *testing.T) {
+	tests := []struct {
+		question string
+		options  []string
+		want     error
+	}{
+		{"Which book?", []string{"Dune", "Emma"}, nil},
+		{"   ", []string{"Dune", "Emma"}, ErrPollQuestion},
+		{strings.Repeat("?", MaxPollQuestionLength+1), []string{"Dune", "Emma"}, ErrPollQuestion},
+		{"Which book?", []string{"Dune"}, ErrPollOptions},
+		{"Which book?", make([]string, MaxPollOptions+1), ErrPollOptions},
+		{"Which book?", []string{"Dune", strings.Repeat("a", MaxPollOptionLength+1)}, ErrPollOption},
+	}
+	for _, test := range tests {
+		if got := ValidatePoll(test.question, test.options); got != test.want {
+			t.Errorf("ValidatePoll(%.20q, %d options) = %v; want %v", test.question, len(test.options), got, test.want)
+		}
+	}
+}
+
+func TestCreatePoll(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	postID := createTestPost(t, authorID, "Vote below")
+	if poll, err := GetPoll(postID, authorID); err != nil || poll != nil {
+		t.Fatalf("expected no poll yet; got %+v (%v)", poll, err)
+	}
+	if err := CreatePoll(postID, "Which book?", []string{"Dune"}, false, false, time.Time{}); err != ErrPollOptions {
+		t.Errorf("expected a poll with one option to be rejected; got %v", err)
+	}
+	if err := CreatePoll(postID, "Which book?", []string{"Dune", "Emma", "Ubik"}, false, false, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	poll, err := GetPoll(postID, authorID)
+	if err != nil || poll == nil || len(poll.Options) != 3 || poll.Options[0].Text != "Dune" {
+		t.Errorf("expected the poll with its options in order; got %+v (%v)", poll, err)
+	}
+}
+
+// createTestPoll adds a poll on a new post and returns the post and the poll's option IDs.
+func createTestPoll(t *testing.T, authorID string, multiple, anonymous bool, closesAt time.Time) (string, []string) {
+	t.Helper()
+	postID := createTestPost(t, authorID, "Vote below")
+	if err := CreatePoll(postID, "Which book?", []string{"Dune", "Emma", "Ubik"}, multiple, anonymous, closesAt); err != nil {
+		t.Fatal(err)
+	}
+	poll, err := GetPoll(postID, authorID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var optionIDs []string
+	for _, option := range poll.Options {
+		optionIDs = append(optionIDs, option.ID)
+	}
+	return postID, optionIDs
+}
+
+func TestVote(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	aliceID := registerTestUser(t, "alice")
+	singleID, single := createTestPoll(t, authorID, false, false, time.Time{})
+	multipleID, multiple := createTestPoll(t, authorID, true, true, time.Time{})
+	closedID, closed := createTestPoll(t, authorID, false, false, time.Now().Add(-time.Minute))
+
+	tests := []struct {
+		name      string
+		postID    string
+		optionIDs []string
+		wantErr   error
+	}{
+		{"two choices in a single choice poll", singleID, single[:2], ErrInvalidChoice},
+		{"unknown option", singleID, []string{"no-such-option"}, ErrInvalidChoice},
+		{"single choice", singleID, single[:1], nil},
+		{"second vote", singleID, single[1:2], ErrAlreadyVoted},
+		{"multiple choice", multipleID, multiple[:2], nil},
+		{"closed poll", closedID, closed[:1], ErrPollClosed},
+	}
+	for _, test := range tests {
+		if err := Vote(test.postID, aliceID, test.optionIDs); err != test.wantErr {
+			t.Errorf("%s: expected %v; got %v", test.name, test.wantErr, err)
+		}
+	}
+}
+
+func TestPollResults(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	aliceID := registerTestUser(t, "alice")
+	bobID := registerTestUser(t, "bob")
+	postID, options := createTestPoll(t, authorID, false, false, time.Time{})
+	if err := Vote(postID, aliceID, options[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := Vote(postID, bobID, options[1:2]); err != nil {
+		t.Fatal(err)
+	}
+
+	// A public poll counts each voter once, marks the viewer's choice and shows who voted
+	poll, err := GetPoll(postID, aliceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if poll.Voters != 2 || !poll.Voted || poll.Options[0].Votes != 1 || poll.Options[0].Percent != 50 || !poll.Options[0].Chosen || poll.Options[1].Chosen {
+		t.Errorf("expected one vote each and alice's choice marked; got %+v", poll)
+	}
+	if voters := poll.Options[1].Voters; len(voters) != 1 || voters[0] != "bob" {
+		t.Errorf("expected bob listed as a voter for Emma; got %v", voters)
+	}
+}
+
+func TestAnonymousPollResults(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	aliceID := registerTestUser(t, "alice")
+	bobID := registerTestUser(t, "bob")
+	postID, options := createTestPoll(t, authorID, true, true, time.Time{})
+	if err := Vote(postID, aliceID, options[:2]); err != nil {
+		t.Fatal(err)
+	}
+
+	// An anonymous multiple choice poll counts each option and hides the voters
+	poll, err := GetPoll(postID, bobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if poll.Voters != 1 || poll.Voted || poll.Options[0].Percent != 100 || poll.Options[1].Percent != 100 || poll.Options[0].Voters != nil {
+		t.Errorf("expected both options chosen by one anonymous voter; got %+v", poll)
+	}
+}
+
+func TestClosedPoll(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	postID, _ := createTestPoll(t, authorID, false, false, time.Now().Add(-time.Minute))
+	if poll, err := GetPoll(postID, authorID); err != nil || !poll.Closed {
+		t.Errorf("expected the poll closed; got %+v (%v)", poll, err)
+	}
+}
+
+func TestLoadPostPolls(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	aliceID := registerTestUser(t, "alice")
+	publicID, public := createTestPoll(t, authorID, false, false, time.Time{})
+	anonymousID, anonymous := createTestPoll(t, authorID, true, true, time.Time{})
+	plainID := createTestPost(t, authorID, "No poll")
+	if err := Vote(publicID, aliceID, public[1:2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := Vote(anonymousID, aliceID, anonymous); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each post gets its own poll, with the same results GetPoll returns
+	posts := []Post{{ID: publicID}, {ID: plainID}, {ID: anonymousID}}
+	if err := LoadPostPolls(aliceID, posts); err != nil {
+		t.Fatal(err)
+	}
+	if posts[1].Poll != nil {
+		t.Errorf("expected no poll on the plain post; got %+v", posts[1].Poll)
+	}
+	for _, post := range []Post{posts[0], posts[2]} {
+		want, err := GetPoll(post.ID, aliceID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(post.Poll, want) {
+			t.Errorf("post %s: expected %+v; got %+v", post.ID, want, post.Poll)
+		}
+	}
+	if poll := posts[0].Poll; poll.Voters != 1 || !poll.Options[1].Chosen || len(poll.Options[1].Voters) != 1 {
+		t.Errorf("expected alice's public vote; got %+v", poll)
+	}
+	if poll := posts[2].Poll; poll.Voters != 1 || poll.Options[2].Percent != 100 || poll.Options[2].Voters != nil {
+		t.Errorf("expected alice's anonymous votes; got %+v", poll)
+	}
+}
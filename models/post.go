@@ -3,8 +3,10 @@ package models
 import (
 	"database/sql"
 	"html/template"
+	"net/url"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gofrs/uuid"
 )
@@ -12,9 +14,18 @@ import (
 // Post represents a post made by a user, including its content, timestamps, likes, and categories.
 type Post struct {
 	ID                 string
+	Title              string // empty for posts written before posts had titles
 	Content            template.HTML
+	Excerpt            string // the start of the content as plain text, for feeds
+	Truncated          bool   // whether the excerpt leaves out part of the content
+	SpoilerFor         string // the book the post spoils, if any; feeds then hide the excerpt and blur the image
 	CreatedAt          time.Time
 	CreatedAtFormatted string
+	Scheduled          bool   // not published yet; only the author sees the post until then
+	PublishAtFormatted string // when a scheduled post will be published
+	Pinned             bool   // shown above the feed it is pinned in; set on the pinned posts only
+	Locked             bool   // takes no new comments
+	Archived           bool   // read-only after a period without activity
 	Likes              int
 	Dislikes           int
 	Author             string
@@ -22,36 +33,223 @@ type Post struct {
 	UserHasLiked       bool
 	UserHasDisliked    bool
 	Categories         []string
+	Tags               []string
 	ImagePath          string
-}
-
-type Category struct {
-	ID   string
-	Name string
+	Reactions          []ReactionCount // emoji reactions, filled by LoadPostReactions
+	AuthorReputation   int             // filled by LoadPostAuthorReputations
+	Bookmarked         bool            // whether the viewer saved it in any list, filled by LoadPostBookmarks
+	Poll               *Poll           // nil without a poll, filled by LoadPostPolls
+	url                string
 }
 
 var db *sql.DB
 
+// execer runs statements on the database or within a transaction.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
 // SetDB initializes the database connection for the package.
 func SetDB(database *sql.DB) {
 	db = database
+	forgetReputations()
+}
+
+// Limits on the title of a post.
+const (
+	MaxPostTitleLength = 120
+	maxPostSlugLength  = 60
+)
+
+// MaxSpoilerForLength is the maximum length of the book named in a post's spoiler warning.
+const MaxSpoilerForLength = 100
+
+// ExcerptLength is the number of characters of a post shown in feeds.
+const ExcerptLength = 280
+
+// IsValidTitle reports whether a post title is non-empty and not too long.
+func IsValidTitle(title string) bool {
+	title = strings.TrimSpace(title)
+	return title != "" && utf8.RuneCountInString(title) <= MaxPostTitleLength
+}
+
+// URL returns the canonical address of the post's page.
+func (p Post) URL() string {
+	return p.url
+}
+
+// PostURL returns /posts/<id>/<slug>, where the slug comes from the title, or from the start of the
+// content for posts without one. The slug is only for readers; the ID alone finds the post.
+func PostURL(postID, title, content string) string {
+	if title == "" {
+		title = excerpt(content, maxPostSlugLength)
+	}
+	slug := slugWords(title)
+	if utf8.RuneCountInString(slug) > maxPostSlugLength {
+		slug = string([]rune(slug)[:maxPostSlugLength])
+		// Cut at a word boundary when there is one
+		if i := strings.LastIndexByte(slug, '-'); i > 0 {
+			slug = slug[:i]
+		}
+	}
+	path := "/posts/" + url.PathEscape(postID)
+	if slug != "" {
+		path += "/" + url.PathEscape(slug)
+	}
+	return path
+}
+
+// setPublishAt marks the post as scheduled when it has a publishing time.
+func (p *Post) setPublishAt(publishAt sql.NullTime) {
+	p.Scheduled = publishAt.Valid
+	if publishAt.Valid {
+		p.PublishAtFormatted = publishAt.Time.Format("02.01.2006 15:04")
+	}
 }
 
-// CreatePost inserts a new post into the database with a unique ID, user ID, and content.
-func CreatePost(userID, content string, imagePath string) (string, error) {
+// prepare fills in the fields derived from the stored content, then renders the content as HTML.
+func (p *Post) prepare() {
+	text := plainText(string(p.Content))
+	p.Excerpt = truncateText(text, ExcerptLength)
+	p.Truncated = utf8.RuneCountInString(text) > ExcerptLength
+	p.url = PostURL(p.ID, p.Title, string(p.Content))
+	p.Content = RenderContent(string(p.Content))
+}
+
+// CreatePost inserts a new post into the database with a unique ID, user ID, title and content.
+func CreatePost(userID, title, content string, imagePath string) (string, error) {
+	return CreateScheduledPost(userID, title, content, imagePath, time.Time{})
+}
+
+// CreateScheduledPost inserts a new post that PublishScheduledPosts publishes at publishAt.
+// A zero publishAt publishes the post right away.
+func CreateScheduledPost(userID, title, content, imagePath string, publishAt time.Time) (string, error) {
+	return CreateFullPost(userID, NewPost{Title: title, Content: content, ImagePath: imagePath, PublishAt: publishAt})
+}
+
+// NewPost is a post with everything attached to it when it is created.
+type NewPost struct {
+	Title       string
+	Content     string // stored content, see SanitizeInput
+	ImagePath   string
+	CategoryIDs []string
+	Tags        []string
+	SpoilerFor  string    // the book the post has spoilers for, if any
+	Poll        *NewPoll  // nil without a poll
+	PublishAt   time.Time // zero publishes the post right away
+}
+
+// NewPoll is the poll of a new post. A zero ClosesAt keeps the poll open.
+type NewPoll struct {
+	Question  string
+	Options   []string
+	Multiple  bool
+	Anonymous bool
+	ClosesAt  time.Time
+}
+
+// CreateFullPost inserts a post with its categories, tags, spoiler warning and poll in one
+// transaction, so the post never shows without them. Mentioned users are notified once the
+// post is published.
+func CreateFullPost(userID string, post NewPost) (string, error) {
+	if post.Poll != nil {
+		if err := ValidatePoll(post.Poll.Question, post.Poll.Options); err != nil {
+			return "", err
+		}
+	}
 	postID, err := uuid.NewV4()
 	if err != nil {
 		return "", err
 	}
 
-	_, err = db.Exec("INSERT INTO posts (id, user_id, content, created_at, image_path) VALUES (?, ?, ?, ?, ?)",
-		postID.String(), userID, content, time.Now(), imagePath)
-	return postID.String(), err
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var scheduled interface{}
+	if !post.PublishAt.IsZero() {
+		scheduled = post.PublishAt
+	}
+	_, err = tx.Exec("INSERT INTO posts (id, user_id, title, content, created_at, image_path, spoiler_for, publish_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		postID.String(), userID, strings.TrimSpace(post.Title), post.Content, time.Now(), post.ImagePath, strings.TrimSpace(post.SpoilerFor), scheduled)
+	if err != nil {
+		return "", err
+	}
+	for _, categoryID := range post.CategoryIDs {
+		if err := addCategoryToPost(tx, postID.String(), categoryID); err != nil {
+			return "", err
+		}
+	}
+	if err := setPostTags(tx, postID.String(), post.Tags); err != nil {
+		return "", err
+	}
+	if poll := post.Poll; poll != nil {
+		if err := createPoll(tx, postID.String(), poll.Question, poll.Options, poll.Multiple, poll.Anonymous, poll.ClosesAt); err != nil {
+			return "", err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	if scheduled == nil {
+		logNotificationError(recordMentions(userID, post.Content, postID.String(), ""))
+	}
+	return postID.String(), nil
+}
+
+// PublishScheduledPosts publishes the scheduled posts whose time has come, dated when they were
+// due, and notifies the users they mention. It returns how many posts it published.
+func PublishScheduledPosts(now time.Time) (int, error) {
+	rows, err := db.Query("SELECT id, user_id, content FROM posts WHERE publish_at IS NOT NULL AND julianday(publish_at) <= julianday(?)", now)
+	if err != nil {
+		return 0, err
+	}
+	type duePost struct{ id, userID, content string }
+	var due []duePost
+	for rows.Next() {
+		var post duePost
+		if err := rows.Scan(&post.id, &post.userID, &post.content); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, post)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, post := range due {
+		_, err := db.Exec("UPDATE posts SET created_at = publish_at, publish_at = NULL WHERE id = ?", post.id)
+		if err != nil {
+			return 0, err
+		}
+		logNotificationError(recordMentions(post.userID, post.content, post.id, ""))
+	}
+	return len(due), nil
+}
+
+// IsValidSpoilerFor reports whether book fits in a spoiler warning. An empty book means no warning.
+func IsValidSpoilerFor(book string) bool {
+	return utf8.RuneCountInString(strings.TrimSpace(book)) <= MaxSpoilerForLength
+}
+
+// SetPostSpoiler marks the post as containing spoilers for a book, or clears the mark when book is empty.
+func SetPostSpoiler(postID, book string) error {
+	_, err := db.Exec("UPDATE posts SET spoiler_for = ? WHERE id = ?", strings.TrimSpace(book), postID)
+	return err
 }
 
 // AddCategoryToPost links a category to a post in the database.
 func AddCategoryToPost(postID, categoryID string) error {
-	_, err := db.Exec(`
+	return addCategoryToPost(db, postID, categoryID)
+}
+
+func addCategoryToPost(ex execer, postID, categoryID string) error {
+	_, err := ex.Exec(`
         INSERT INTO post_categories (post_id, category_id) VALUES (?, ?)
     `, postID, categoryID)
 	return err
@@ -82,151 +280,75 @@ func GetCategoriesForPost(postID string) ([]string, error) {
 	return categories, nil
 }
 
+// LikePost toggles the user's like of a post; a dislike is turned into a like.
 func LikePost(userID, postID string) error {
-	var interactionID string
-	var isLike bool
-
-	err := db.QueryRow("SELECT id, is_like FROM post_likes WHERE user_id = ? AND post_id = ?", userID, postID).Scan(&interactionID, &isLike)
-	if err == sql.ErrNoRows {
-		likeID, _ := uuid.NewV4()
-		_, err = db.Exec("INSERT INTO post_likes (id, user_id, post_id, is_like) VALUES (?, ?, ?, TRUE)", likeID.String(), userID, postID)
-		return err
-	} else if err != nil {
-		return err
-	}
-
-	if isLike {
-		_, err = db.Exec("DELETE FROM post_likes WHERE user_id = ? AND post_id = ?", userID, postID)
+	reacted, err := toggleReaction(postReactions, userID, postID, true)
+	if err != nil || !reacted {
 		return err
 	}
-
-	_, err = db.Exec("UPDATE post_likes SET is_like = TRUE WHERE id = ?", interactionID)
-	return err
+	logNotificationError(notifyPostAuthor(userID, NotificationPostLike, postID, ""))
+	return nil
 }
 
+// DislikePost toggles the user's dislike of a post; a like is turned into a dislike.
 func DislikePost(userID, postID string) error {
-	var interactionID string
-	var isLike bool
-
-	err := db.QueryRow("SELECT id, is_like FROM post_likes WHERE user_id = ? AND post_id = ?", userID, postID).Scan(&interactionID, &isLike)
-	if err == sql.ErrNoRows {
-		dislikeID, _ := uuid.NewV4()
-		_, err = db.Exec("INSERT INTO post_likes (id, user_id, post_id, is_like) VALUES (?, ?, ?, FALSE)", dislikeID.String(), userID, postID)
-		return err
-	} else if err != nil {
-		return err
-	}
-
-	if !isLike {
-		_, err = db.Exec("DELETE FROM post_likes WHERE user_id = ? AND post_id = ?", userID, postID)
-		return err
-	}
-
-	_, err = db.Exec("UPDATE post_likes SET is_like = FALSE WHERE id = ?", interactionID)
+	_, err := toggleReaction(postReactions, userID, postID, false)
 	return err
 }
 
-func UpdatePostLikesDislikes(postID string) error {
-	var likeCount, dislikeCount int
-
-	err := db.QueryRow("SELECT COUNT(*) FROM post_likes WHERE post_id = ? AND is_like = TRUE", postID).Scan(&likeCount)
-	if err != nil {
-		return err
-	}
-
-	err = db.QueryRow("SELECT COUNT(*) FROM post_likes WHERE post_id = ? AND is_like = FALSE", postID).Scan(&dislikeCount)
-	if err != nil {
-		return err
-	}
-
-	_, err = db.Exec("UPDATE posts SET likes = ?, dislikes = ? WHERE id = ?", likeCount, dislikeCount, postID)
-	return err
-}
-
-func GetFilteredPosts(loggedIn bool, userID, categoryID string) ([]Post, error) {
-	var rows *sql.Rows
-	var err error
-
-	if categoryID != "" {
-		rows, err = db.Query(`
-            SELECT posts.id, posts.content, posts.created_at, posts.likes, posts.dislikes, posts.image_path, users.username
-            FROM posts
-            JOIN users ON posts.user_id = users.id
-            JOIN post_categories ON posts.id = post_categories.post_id
-            WHERE post_categories.category_id = ?
-            ORDER BY posts.created_at DESC
-        `, categoryID)
-	} else {
-		rows, err = db.Query(`
-            SELECT posts.id, posts.content, posts.created_at, posts.likes, posts.dislikes, posts.image_path, users.username
-            FROM posts
-            JOIN users ON posts.user_id = users.id
-            ORDER BY posts.created_at DESC
-        `)
-	}
-
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
+// scanPosts reads rows of (id, content, created_at, likes, dislikes, image_path, username)
+// into posts with their categories.
+func scanPosts(rows *sql.Rows) ([]Post, error) {
 	var posts []Post
 	for rows.Next() {
 		var post Post
 		var createdAt time.Time
 		var imagePath sql.NullString
+		var archivedAt sql.NullTime
 
-		err = rows.Scan(&post.ID, &post.Content, &createdAt, &post.Likes, &post.Dislikes, &imagePath, &post.Author)
+		err := rows.Scan(&post.ID, &post.Content, &createdAt, &post.Likes, &post.Dislikes, &imagePath, &post.Title, &post.SpoilerFor, &post.Locked, &archivedAt, &post.Author)
 		if err != nil {
 			return nil, err
 		}
-
 		post.ImagePath = imagePath.String
+		post.Archived = archivedAt.Valid
 		post.CreatedAtFormatted = createdAt.Format("02.01.2006 15:04")
-		post.Content = template.HTML(strings.ReplaceAll(string(post.Content), "\n", "<br>"))
-		categories, err := GetCategoriesForPost(post.ID)
-		if err != nil {
-			return nil, err
-		}
-		post.Categories = categories
-
+		post.prepare()
 		posts = append(posts, post)
 	}
-
-	return posts, nil
-}
-
-func GetAllCategories() ([]Category, error) {
-	rows, err := db.Query("SELECT id, name FROM categories")
-	if err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var categories []Category
-	for rows.Next() {
-		var category Category
-		err = rows.Scan(&category.ID, &category.Name)
+	// Categories are loaded after the rows are read so only one connection is in use at a time
+	rows.Close()
+	for i := range posts {
+		categories, err := GetCategoriesForPost(posts[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		posts[i].Categories = categories
+		posts[i].Tags, err = GetTagsForPost(posts[i].ID)
 		if err != nil {
 			return nil, err
 		}
-		categories = append(categories, category)
 	}
 
-	return categories, nil
+	return posts, nil
 }
 
 func GetPostByID(postID string) (Post, error) {
 	var post Post
 	var createdAt time.Time
 	var imagePath sql.NullString
+	var publishAt, archivedAt sql.NullTime
 
 	err := db.QueryRow(`
-        SELECT posts.id, posts.content, posts.created_at, posts.likes, posts.dislikes, posts.image_path, users.username
+        SELECT posts.id, posts.content, posts.created_at, posts.likes, posts.dislikes, posts.image_path, posts.title, posts.spoiler_for, posts.locked, posts.archived_at, users.username, posts.publish_at
         FROM posts
         JOIN users ON posts.user_id = users.id
         WHERE posts.id = ?`, postID).Scan(
-		&post.ID, &post.Content, &createdAt, &post.Likes, &post.Dislikes, &imagePath, &post.Author,
+		&post.ID, &post.Content, &createdAt, &post.Likes, &post.Dislikes, &imagePath, &post.Title, &post.SpoilerFor, &post.Locked, &archivedAt, &post.Author, &publishAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -235,25 +357,33 @@ func GetPostByID(postID string) (Post, error) {
 		return post, err
 	}
 	post.ImagePath = imagePath.String
+	post.Archived = archivedAt.Valid
+	post.setPublishAt(publishAt)
+	post.prepare()
 
 	categories, err := GetCategoriesForPost(post.ID)
 	if err != nil {
 		return post, err
 	}
 	post.Categories = categories
+	post.Tags, err = GetTagsForPost(post.ID)
+	if err != nil {
+		return post, err
+	}
 
 	post.CreatedAtFormatted = createdAt.Format("02.01.2006 15:04")
 
 	return post, nil
 }
 
+// GetPostsByUser returns the posts of a user, including the ones they scheduled, newest first.
 func GetPostsByUser(userID string) ([]Post, error) {
 	rows, err := db.Query(`
-        SELECT posts.id, posts.content, posts.created_at, posts.likes, posts.dislikes, posts.image_path, users.username
+        SELECT posts.id, posts.content, posts.created_at, posts.likes, posts.dislikes, posts.image_path, posts.title, posts.spoiler_for, posts.locked, posts.archived_at, users.username, posts.publish_at
         FROM posts
         JOIN users ON posts.user_id = users.id
         WHERE posts.user_id = ?
-        ORDER BY posts.created_at DESC
+        ORDER BY posts.publish_at IS NULL, posts.created_at DESC
     `, userID)
 	if err != nil {
 		return nil, err
@@ -265,18 +395,26 @@ func GetPostsByUser(userID string) ([]Post, error) {
 		var post Post
 		var createdAt time.Time
 		var imagePath sql.NullString
+		var publishAt, archivedAt sql.NullTime
 
-		err = rows.Scan(&post.ID, &post.Content, &createdAt, &post.Likes, &post.Dislikes, &imagePath, &post.Author)
+		err = rows.Scan(&post.ID, &post.Content, &createdAt, &post.Likes, &post.Dislikes, &imagePath, &post.Title, &post.SpoilerFor, &post.Locked, &archivedAt, &post.Author, &publishAt)
 		if err != nil {
 			return nil, err
 		}
 		post.ImagePath = imagePath.String
+		post.Archived = archivedAt.Valid
+		post.setPublishAt(publishAt)
+		post.prepare()
 
 		categories, err := GetCategoriesForPost(post.ID)
 		if err != nil {
 			return nil, err
 		}
 		post.Categories = categories
+		post.Tags, err = GetTagsForPost(post.ID)
+		if err != nil {
+			return nil, err
+		}
 
 		post.CreatedAtFormatted = createdAt.Format("02.01.2006 15:04")
 		posts = append(posts, post)
@@ -285,41 +423,44 @@ func GetPostsByUser(userID string) ([]Post, error) {
 	return posts, nil
 }
 
+// GetLikedPostsByUser returns the posts the user liked, newest first.
 func GetLikedPostsByUser(userID string) ([]Post, error) {
+	return getReactedPostsByUser(userID, true)
+}
+
+// GetDislikedPostsByUser returns the posts the user disliked, newest first.
+func GetDislikedPostsByUser(userID string) ([]Post, error) {
+	return getReactedPostsByUser(userID, false)
+}
+
+func getReactedPostsByUser(userID string, isLike bool) ([]Post, error) {
 	rows, err := db.Query(`
-        SELECT posts.id, posts.content, posts.created_at, posts.likes, posts.dislikes, posts.image_path, users.username
+        SELECT posts.id, posts.content, posts.created_at, posts.likes, posts.dislikes, posts.image_path, posts.title, posts.spoiler_for, posts.locked, posts.archived_at, users.username
         FROM posts
         JOIN users ON posts.user_id = users.id
         JOIN post_likes ON posts.id = post_likes.post_id
-        WHERE post_likes.user_id = ?
+        WHERE post_likes.user_id = ? AND post_likes.is_like = ?
         ORDER BY posts.created_at DESC
-    `, userID)
+    `, userID, isLike)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+	return scanPosts(rows)
+}
 
-	var posts []Post
-	for rows.Next() {
-		var post Post
-		var createdAt time.Time
-		var imagePath sql.NullString
-
-		err = rows.Scan(&post.ID, &post.Content, &createdAt, &post.Likes, &post.Dislikes, &imagePath, &post.Author)
-		if err != nil {
-			return nil, err
-		}
-		post.ImagePath = imagePath.String
-
-		categories, err := GetCategoriesForPost(post.ID)
-		if err != nil {
-			return nil, err
-		}
-		post.Categories = categories
-
-		post.CreatedAtFormatted = createdAt.Format("02.01.2006 15:04")
-		posts = append(posts, post)
+// GetCommentedPostsByUser returns the posts the user commented on, newest first.
+func GetCommentedPostsByUser(userID string) ([]Post, error) {
+	rows, err := db.Query(`
+        SELECT posts.id, posts.content, posts.created_at, posts.likes, posts.dislikes, posts.image_path, posts.title, posts.spoiler_for, posts.locked, posts.archived_at, users.username
+        FROM posts
+        JOIN users ON posts.user_id = users.id
+        WHERE posts.id IN (SELECT post_id FROM comments WHERE user_id = ?)
+        ORDER BY posts.created_at DESC
+    `, userID)
+	if err != nil {
+		return nil, err
 	}
-
-	return posts, nil
+	defer rows.Close()
+	return scanPosts(rows)
 }
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPostURL(t *testing.T) {
+	tests := []struct {
+		title   string
+		content string
+		want    string
+	}{
+		{"Hello, World!", "ignored", "/posts/id/hello-world"},
+		{"Ender's Game & Co", "", "/posts/id/ender-s-game-co"},
+		{"", "First words &amp; more", "/posts/id/first-words-more"},
+		{"Война и мир", "", "/posts/id/%D0%B2%D0%BE%D0%B9%D0%BD%D0%B0-%D0%B8-%D0%BC%D0%B8%D1%80"},
+		{"", "!!!", "/posts/id"},
+		{strings.Repeat("abcdefghij ", 10), "", "/posts/id/abcdefghij-abcdefghij-abcdefghij-abcdefghij-abcdefghij"},
+	}
+	for _, test := range tests {
+		if got := PostURL("id", test.title, test.content); got != test.want {
+			t.Errorf("PostURL(%q, %q) = %q; want %q", test.title, test.content, got, test.want)
+		}
+	}
+}
+
+func TestCreatePostTitle(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+
+	// Titles are stored trimmed but otherwise as typed, not HTML-escaped, and the slug follows them
+	tests := []struct {
+		title     string
+		wantTitle string
+		wantSlug  string
+	}{
+		{"  The Name of the Wind: a review ", "The Name of the Wind: a review", "the-name-of-the-wind-a-review"},
+		{"Ender's Game & <Speaker>", "Ender's Game & <Speaker>", "ender-s-game-speaker"},
+	}
+	for _, test := range tests {
+		postID, err := CreatePost(authorID, test.title, "A classic", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		post, err := GetPostByID(postID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if post.Title != test.wantTitle {
+			t.Errorf("%q: expected the title %q; got %q", test.title, test.wantTitle, post.Title)
+		}
+		if want := "/posts/" + postID + "/" + test.wantSlug; post.URL() != want {
+			t.Errorf("%q: got URL %q; want %q", test.title, post.URL(), want)
+		}
+	}
+}
+
+func TestPostExcerpt(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	postID := createTestPost(t, authorID, strings.Repeat("word ", ExcerptLength))
+
+	// Long content is cut to an excerpt, the same on the post and in lists
+	post, err := GetPostByID(postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !post.Truncated || len([]rune(post.Excerpt)) > ExcerptLength+1 || !strings.HasSuffix(post.Excerpt, "word…") {
+		t.Errorf("expected a truncated excerpt; got %d characters, truncated %v", len([]rune(post.Excerpt)), post.Truncated)
+	}
+	posts, err := GetPostsByUser(authorID)
+	if err != nil || len(posts) != 1 || posts[0].Excerpt != post.Excerpt {
+		t.Errorf("expected the same excerpt in lists; got %v (%v)", posts, err)
+	}
+}
+
+func TestCreateFullPost(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	fantasyID, _, grimdarkID := createCategoryTree(t)
+
+	// The post comes with everything attached to it
+	post := NewPost{
+		Title:       "Book club",
+		Content:     "Who finished it?",
+		CategoryIDs: []string{fantasyID, grimdarkID},
+		Tags:        []string{"Reading"},
+		SpoilerFor:  " The Blade Itself ",
+		Poll:        &NewPoll{Question: "Did you like it?", Options: []string{"Yes", "No"}},
+	}
+	postID, err := CreateFullPost(authorID, post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := GetPostByID(postID)
+	if err != nil || saved.SpoilerFor != "The Blade Itself" {
+		t.Errorf("expected the trimmed spoiler warning; got %q (%v)", saved.SpoilerFor, err)
+	}
+	if categories, err := GetCategoriesForPost(postID); err != nil || len(categories) != 2 {
+		t.Errorf("expected two categories; got %v (%v)", categories, err)
+	}
+	if tags, err := GetTagsForPost(postID); err != nil || len(tags) != 1 {
+		t.Errorf("expected one tag; got %v (%v)", tags, err)
+	}
+	if poll, err := GetPoll(postID, authorID); err != nil || poll == nil {
+		t.Errorf("expected a poll; got %v (%v)", poll, err)
+	}
+
+	// A failure partway leaves no post behind
+	post.CategoryIDs = []string{fantasyID, fantasyID}
+	if _, err := CreateFullPost(authorID, post); err == nil {
+		t.Fatal("expected an error for a repeated category")
+	}
+	var posts, polls int
+	if err := db.QueryRow("SELECT (SELECT COUNT(*) FROM posts), (SELECT COUNT(*) FROM polls)").Scan(&posts, &polls); err != nil {
+		t.Fatal(err)
+	}
+	if posts != 1 || polls != 1 {
+		t.Errorf("expected only the first post and its poll; got %d posts and %d polls", posts, polls)
+	}
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// MaxBioLength is the maximum number of characters in a profile bio.
+const MaxBioLength = 500
+
+// Profile is the public information shown on a user's page.
+type Profile struct {
+	UserID            string
+	Username          string
+	Bio               string
+	AvatarPath        string
+	JoinedAtFormatted string // empty for accounts created before join dates were recorded
+	PostCount         int
+	CommentCount      int
+	Reputation        int
+}
+
+// GetProfileByUsername retrieves the profile and activity counts of a user.
+func GetProfileByUsername(username string) (Profile, error) {
+	var profile Profile
+	var bio, avatarPath sql.NullString
+	var joinedAt sql.NullTime
+
+	err := db.QueryRow("SELECT id, username, bio, avatar_path, created_at FROM users WHERE username = ?", username).
+		Scan(&profile.UserID, &profile.Username, &bio, &avatarPath, &joinedAt)
+	if err != nil {
+		return profile, err
+	}
+	profile.Bio = bio.String
+	profile.AvatarPath = avatarPath.String
+	if joinedAt.Valid {
+		profile.JoinedAtFormatted = joinedAt.Time.Format("02.01.2006")
+	}
+
+	err = db.QueryRow("SELECT COUNT(*) FROM posts WHERE user_id = ? AND publish_at IS NULL", profile.UserID).Scan(&profile.PostCount)
+	if err != nil {
+		return profile, err
+	}
+	err = db.QueryRow("SELECT COUNT(*) FROM comments WHERE user_id = ?", profile.UserID).Scan(&profile.CommentCount)
+	if err != nil {
+		return profile, err
+	}
+
+	profile.Reputation, err = GetReputation(profile.UserID)
+	return profile, err
+}
+
+// GetAvatarPath retrieves the uploaded avatar of a user, if any.
+func GetAvatarPath(userID string) (string, error) {
+	var avatarPath sql.NullString
+	err := db.QueryRow("SELECT avatar_path FROM users WHERE id = ?", userID).Scan(&avatarPath)
+	return avatarPath.String, err
+}
+
+// UpdateProfile stores the editable profile fields of a user.
+func UpdateProfile(userID, bio, avatarPath string) error {
+	_, err := db.Exec("UPDATE users SET bio = ?, avatar_path = ? WHERE id = ?", bio, avatarPath, userID)
+	return err
+}
+
+// RevealsSpoilers reports whether the user chose to see spoilers without clicking them open.
+func RevealsSpoilers(userID string) (bool, error) {
+	var reveal bool
+	err := db.QueryRow("SELECT reveal_spoilers FROM users WHERE id = ?", userID).Scan(&reveal)
+	return reveal, err
+}
+
+// SetRevealSpoilers stores whether the user sees spoilers without clicking them open.
+func SetRevealSpoilers(userID string, reveal bool) error {
+	_, err := db.Exec("UPDATE users SET reveal_spoilers = ? WHERE id = ?", reveal, userID)
+	return err
+}
+
+// GetRecentPostsByUser retrieves the latest posts of a user.
+func GetRecentPostsByUser(userID string, limit int) ([]Post, error) {
+	rows, err := db.Query(`
+        SELECT posts.id, posts.content, posts.created_at, posts.likes, posts.dislikes, posts.image_path, posts.title, posts.spoiler_for, posts.locked, posts.archived_at, users.username
+        FROM posts
+        JOIN users ON posts.user_id = users.id
+        WHERE posts.user_id = ? AND posts.publish_at IS NULL
+        ORDER BY posts.created_at DESC
+        LIMIT ?
+    `, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPosts(rows)
+}
+
+// GetRecentCommentsByUser retrieves the latest comments of a user with the post they belong to.
+func GetRecentCommentsByUser(userID string, limit int) ([]Comment, error) {
+	rows, err := db.Query(`
+        SELECT comments.id, comments.post_id, comments.content, comments.created_at, users.username, comments.likes, comments.dislikes
+        FROM comments
+        JOIN users ON comments.user_id = users.id
+        WHERE comments.user_id = ?
+        ORDER BY comments.created_at DESC
+        LIMIT ?
+    `, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		var comment Comment
+		var createdAt time.Time
+		err := rows.Scan(&comment.ID, &comment.PostID, &comment.Content, &createdAt, &comment.Author, &comment.Likes, &comment.Dislikes)
+		if err != nil {
+			return nil, err
+		}
+		comment.CreatedAtFormatted = createdAt.Format("02.01.2006 15:04")
+		comment.Content = RenderContent(string(comment.Content))
+		comments = append(comments, comment)
+	}
+
+	return comments, rows.Err()
+}
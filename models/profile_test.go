@@ -0,0 +1,78 @@
+package models
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestGetProfileByUsername(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	readerID := registerTestUser(t, "reader")
+	postID := createTestPost(t, authorID, "Published")
+	if _, err := CreateScheduledPost(authorID, "Later", "Scheduled", "", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	for _, userID := range []string{authorID, readerID, readerID} {
+		if _, err := CreateComment(postID, userID, "A comment"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := LikePost(readerID, postID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Counts leave out scheduled posts; reputation comes from other users' reactions
+	tests := []struct {
+		username       string
+		wantPosts      int
+		wantComments   int
+		wantReputation bool
+	}{
+		{"author", 1, 1, true},
+		{"reader", 0, 2, false},
+	}
+	for _, test := range tests {
+		profile, err := GetProfileByUsername(test.username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if profile.PostCount != test.wantPosts || profile.CommentCount != test.wantComments || (profile.Reputation > 0) != test.wantReputation {
+			t.Errorf("%s: expected %d posts, %d comments, reputation %v; got %+v", test.username, test.wantPosts, test.wantComments, test.wantReputation, profile)
+		}
+		if profile.JoinedAtFormatted != time.Now().Format("02.01.2006") {
+			t.Errorf("%s: expected joined today; got %q", test.username, profile.JoinedAtFormatted)
+		}
+	}
+	if _, err := GetProfileByUsername("nobody"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for an unknown user; got %v", err)
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	setupTestDB(t)
+
+	userID := registerTestUser(t, "reader")
+
+	tests := []struct {
+		bio        string
+		avatarPath string
+	}{
+		{"Reads <b>everything</b>", "uploads/1_me.png"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if err := UpdateProfile(userID, test.bio, test.avatarPath); err != nil {
+			t.Fatal(err)
+		}
+		profile, err := GetProfileByUsername("reader")
+		if err != nil || profile.Bio != test.bio || profile.AvatarPath != test.avatarPath {
+			t.Errorf("expected bio %q and avatar %q; got %+v (%v)", test.bio, test.avatarPath, profile, err)
+		}
+		if avatarPath, err := GetAvatarPath(userID); err != nil || avatarPath != test.avatarPath {
+			t.Errorf("expected avatar %q; got %q (%v)", test.avatarPath, avatarPath, err)
+		}
+	}
+}
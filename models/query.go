@@ -0,0 +1,33 @@
+package models
+
+import "strings"
+
+// queryBuilder collects the conditions of a WHERE clause. Conditions are fixed SQL written in
+// this package; every value they compare against is passed as an argument and bound by the driver.
+type queryBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+// where adds a condition that must hold, with the arguments for its placeholders.
+func (b *queryBuilder) where(condition string, args ...interface{}) {
+	b.conditions = append(b.conditions, "("+condition+")")
+	b.args = append(b.args, args...)
+}
+
+// whereAny adds the conditions of another builder, of which at least one must hold.
+func (b *queryBuilder) whereAny(any queryBuilder) {
+	if len(any.conditions) == 0 {
+		return
+	}
+	b.where(strings.Join(any.conditions, " OR "), any.args...)
+}
+
+// build appends the WHERE clause, if any, and the rest of the query to base.
+func (b *queryBuilder) build(base, rest string) (string, []interface{}) {
+	query := base
+	if len(b.conditions) > 0 {
+		query += "\n        WHERE " + strings.Join(b.conditions, " AND ")
+	}
+	return query + "\n        " + rest, b.args
+}
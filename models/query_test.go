@@ -0,0 +1,31 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQueryBuilder(t *testing.T) {
+	var b queryBuilder
+	query, args := b.build("SELECT id FROM posts", "ORDER BY id")
+	if strings.Contains(query, "WHERE") || len(args) != 0 {
+		t.Errorf("expected no WHERE clause; got %q %v", query, args)
+	}
+
+	b.where("likes >= ?", 3)
+	var any queryBuilder
+	any.where("author = ?", "a' OR 1=1 --")
+	any.where("author = ?", "b")
+	b.whereAny(any)
+	b.whereAny(queryBuilder{})
+	query, args = b.build("SELECT id FROM posts", "ORDER BY id")
+
+	want := "SELECT id FROM posts\n        WHERE (likes >= ?) AND ((author = ?) OR (author = ?))\n        ORDER BY id"
+	if query != want {
+		t.Errorf("got query %q; want %q", query, want)
+	}
+	if !reflect.DeepEqual(args, []interface{}{3, "a' OR 1=1 --", "b"}) {
+		t.Errorf("unexpected args %v", args)
+	}
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// reactionTable names the table holding likes and dislikes of one kind of content.
+type reactionTable struct {
+	name    string // table name
+	target  string // column referencing the post or comment
+	content string // table of the posts or comments
+}
+
+var (
+	postReactions    = reactionTable{name: "post_likes", target: "post_id", content: "posts"}
+	commentReactions = reactionTable{name: "comment_likes", target: "comment_id", content: "comments"}
+)
+
+// reactionContentTables names the table of the content an emoji reaction targets.
+var reactionContentTables = map[string]string{
+	ReactionTargetPost:    "posts",
+	ReactionTargetComment: "comments",
+}
+
+// toggleReaction applies a like (isLike) or dislike in one transaction: a new reaction is added,
+// the same reaction again removes it, and the opposite one replaces it. The like and dislike
+// counters are updated by triggers within the same transaction. It reports whether the user
+// holds the reaction afterwards.
+func toggleReaction(table reactionTable, userID, targetID string, isLike bool) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var current bool
+	err = tx.QueryRow("SELECT is_like FROM "+table.name+" WHERE user_id = ? AND "+table.target+" = ?", userID, targetID).Scan(&current)
+	switch {
+	case err == sql.ErrNoRows:
+		id, err := uuid.NewV4()
+		if err != nil {
+			return false, err
+		}
+		_, err = tx.Exec("INSERT INTO "+table.name+" (id, user_id, "+table.target+", is_like, created_at) VALUES (?, ?, ?, ?, ?)",
+			id.String(), userID, targetID, isLike, time.Now())
+		if err != nil {
+			return false, err
+		}
+	case err != nil:
+		return false, err
+	case current == isLike:
+		_, err = tx.Exec("DELETE FROM "+table.name+" WHERE user_id = ? AND "+table.target+" = ?", userID, targetID)
+		if err != nil {
+			return false, err
+		}
+		if err := tx.Commit(); err != nil {
+			return false, err
+		}
+		forgetAuthorReputation(table.content, targetID)
+		return false, nil
+	default:
+		_, err = tx.Exec("UPDATE "+table.name+" SET is_like = ?, created_at = ? WHERE user_id = ? AND "+table.target+" = ?",
+			isLike, time.Now(), userID, targetID)
+		if err != nil {
+			return false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	forgetAuthorReputation(table.content, targetID)
+	return true, nil
+}
+
+// GetPostReaction reports whether the user currently likes or dislikes a post.
+func GetPostReaction(userID, postID string) (liked, disliked bool, err error) {
+	var isLike bool
+	err = db.QueryRow("SELECT is_like FROM post_likes WHERE user_id = ? AND post_id = ?", userID, postID).Scan(&isLike)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, err
+	}
+	return isLike, !isLike, nil
+}
+
+// GetCommentReaction reports whether the user currently likes or dislikes a comment.
+func GetCommentReaction(userID, commentID string) (liked, disliked bool, err error) {
+	var isLike bool
+	err = db.QueryRow("SELECT is_like FROM comment_likes WHERE user_id = ? AND comment_id = ?", userID, commentID).Scan(&isLike)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, err
+	}
+	return isLike, !isLike, nil
+}
+
+// setViewerPostReactions fills UserHasLiked and UserHasDisliked of the posts for the given user.
+func setViewerPostReactions(userID string, posts []Post) error {
+	if userID == "" || len(posts) == 0 {
+		return nil
+	}
+	args := []interface{}{userID}
+	for _, post := range posts {
+		args = append(args, post.ID)
+	}
+	reactions, err := queryReactions("SELECT post_id, is_like FROM post_likes WHERE user_id = ? AND post_id IN ("+placeholders(len(posts))+")", args)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		isLike, ok := reactions[posts[i].ID]
+		posts[i].UserHasLiked = ok && isLike
+		posts[i].UserHasDisliked = ok && !isLike
+	}
+	return nil
+}
+
+// setViewerCommentReactions fills UserHasLiked and UserHasDisliked of the comments for the given user.
+func setViewerCommentReactions(userID string, comments []Comment) error {
+	if userID == "" || len(comments) == 0 {
+		return nil
+	}
+	args := []interface{}{userID}
+	for _, comment := range comments {
+		args = append(args, comment.ID)
+	}
+	reactions, err := queryReactions("SELECT comment_id, is_like FROM comment_likes WHERE user_id = ? AND comment_id IN ("+placeholders(len(comments))+")", args)
+	if err != nil {
+		return err
+	}
+	for i := range comments {
+		isLike, ok := reactions[comments[i].ID]
+		comments[i].UserHasLiked = ok && isLike
+		comments[i].UserHasDisliked = ok && !isLike
+	}
+	return nil
+}
+
+// queryReactions maps target IDs to is_like for a query selecting (target_id, is_like).
+func queryReactions(query string, args []interface{}) (map[string]bool, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reactions := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		var isLike bool
+		if err := rows.Scan(&id, &isLike); err != nil {
+			return nil, err
+		}
+		reactions[id] = isLike
+	}
+	return reactions, rows.Err()
+}
+
+// placeholders returns n comma-separated SQL placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentReactionsKeepCountsConsistent(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	postID, err := CreatePost(authorID, "", "A post to react to", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commentID, err := CreateComment(postID, authorID, "A comment to react to")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const users = 20
+	const workersPerUser = 3
+	var userIDs []string
+	for i := 0; i < users; i++ {
+		userIDs = append(userIDs, registerTestUser(t, fmt.Sprintf("user%d", i)))
+	}
+
+	// Every user toggles the post like from several goroutines at once. An odd number
+	// of toggles leaves the post liked, so the final count is known in advance.
+	// The comment gets random likes and dislikes at the same time.
+	var wg sync.WaitGroup
+	errs := make(chan error, users*workersPerUser)
+	wantLikes := 0
+	for i, userID := range userIDs {
+		toggles := 10 + i%2
+		if toggles%2 == 1 {
+			wantLikes++
+		}
+		for w := 0; w < workersPerUser; w++ {
+			n := toggles / workersPerUser
+			if w < toggles%workersPerUser {
+				n++
+			}
+			wg.Add(1)
+			go func(userID string, n int, seed int64) {
+				defer wg.Done()
+				random := rand.New(rand.NewSource(seed))
+				for j := 0; j < n; j++ {
+					if err := LikePost(userID, postID); err != nil {
+						errs <- err
+						return
+					}
+					react := LikeComment
+					if random.Intn(2) == 0 {
+						react = DislikeComment
+					}
+					if err := react(userID, commentID); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}(userID, n, time.Now().UnixNano()+int64(i*workersPerUser+w))
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("reaction failed: %v", err)
+	}
+
+	post, err := GetPostByID(postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Likes != wantLikes || post.Dislikes != 0 {
+		t.Errorf("post: expected %d likes and 0 dislikes; got %d and %d", wantLikes, post.Likes, post.Dislikes)
+	}
+
+	// The comment counters must match the reaction rows, whatever the final state is
+	comment, err := GetCommentByID(commentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var likes, dislikes int
+	for _, userID := range userIDs {
+		liked, disliked, err := GetCommentReaction(userID, commentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if liked {
+			likes++
+		}
+		if disliked {
+			dislikes++
+		}
+	}
+	if comment.Likes != likes || comment.Dislikes != dislikes {
+		t.Errorf("comment: counters say %d/%d but rows say %d/%d", comment.Likes, comment.Dislikes, likes, dislikes)
+	}
+}
@@ -0,0 +1,363 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reputation weight keys for likes and dislikes; emoji reactions are weighted by their own key.
+const (
+	WeightPostLike       = "post_like"
+	WeightPostDislike    = "post_dislike"
+	WeightCommentLike    = "comment_like"
+	WeightCommentDislike = "comment_dislike"
+)
+
+// Privileges unlocked by reputation.
+const (
+	PrivilegeUploadImages = "upload_images"
+	PrivilegePostLinks    = "post_links"
+)
+
+// PrivilegeLabels names the privileges in the order they are listed on profiles.
+var PrivilegeLabels = []struct{ Key, Label string }{
+	{PrivilegeUploadImages, "Upload images"},
+	{PrivilegePostLinks, "Post links"},
+}
+
+// ReputationPolicy controls how reputation is computed and what it unlocks.
+type ReputationPolicy struct {
+	// Weights gives the points for each kind of reaction received from another user
+	Weights map[string]float64
+	// HalfLife is the age at which a reaction counts half; zero turns decay off
+	HalfLife time.Duration
+	// Thresholds is the reputation needed for each privilege
+	Thresholds map[string]int
+}
+
+var reputationPolicy = ReputationPolicy{
+	Weights:  defaultReputationWeights(),
+	HalfLife: 365 * 24 * time.Hour,
+	Thresholds: map[string]int{
+		PrivilegeUploadImages: 10,
+		PrivilegePostLinks:    25,
+	},
+}
+
+// defaultReputationWeights gives likes and dislikes their points and each emoji reaction the
+// weight it has in EmojiReactionTypes.
+func defaultReputationWeights() map[string]float64 {
+	weights := map[string]float64{
+		WeightPostLike:       10,
+		WeightPostDislike:    -2,
+		WeightCommentLike:    5,
+		WeightCommentDislike: -1,
+	}
+	for _, reactionType := range EmojiReactionTypes {
+		weights[reactionType.Key] = reactionType.Weight
+	}
+	return weights
+}
+
+// SetReputationPolicy replaces the reputation weights, decay and thresholds.
+func SetReputationPolicy(policy ReputationPolicy) {
+	reputationPolicy = policy
+	forgetReputations()
+}
+
+// GetReputationPolicy returns a copy of the current reputation policy.
+func GetReputationPolicy() ReputationPolicy {
+	policy := reputationPolicy
+	policy.Weights = make(map[string]float64)
+	for key, weight := range reputationPolicy.Weights {
+		policy.Weights[key] = weight
+	}
+	policy.Thresholds = make(map[string]int)
+	for key, threshold := range reputationPolicy.Thresholds {
+		policy.Thresholds[key] = threshold
+	}
+	return policy
+}
+
+// ParseReputationNumbers parses a list like "post_like=10,post_dislike=-2" into numbers by key.
+func ParseReputationNumbers(value string) (map[string]float64, error) {
+	numbers := make(map[string]float64)
+	for _, pair := range strings.Split(value, ",") {
+		key, number, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("expected key=number, got %q", pair)
+		}
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number for %s: %v", key, err)
+		}
+		numbers[strings.TrimSpace(key)] = parsed
+	}
+	return numbers, nil
+}
+
+// decayedWeight returns the points of a reaction of the given kind received at a time.
+func decayedWeight(policy ReputationPolicy, kind string, at, now time.Time) float64 {
+	weight := policy.Weights[kind]
+	if policy.HalfLife <= 0 || weight == 0 {
+		return weight
+	}
+	age := now.Sub(at)
+	if age < 0 {
+		age = 0
+	}
+	return weight * math.Pow(0.5, float64(age)/float64(policy.HalfLife))
+}
+
+// reputationQueries select (author username, reaction kind, reaction time, content time)
+// for every reaction another user gave to the posts and comments of the listed authors.
+// Reactions from before their time was recorded fall back to the time of the content.
+var reputationQueries = []string{`
+        SELECT users.username, CASE WHEN post_likes.is_like THEN 'post_like' ELSE 'post_dislike' END,
+               post_likes.created_at, posts.created_at
+        FROM post_likes
+        JOIN posts ON post_likes.post_id = posts.id
+        JOIN users ON posts.user_id = users.id
+        WHERE post_likes.user_id != posts.user_id AND users.username IN (%s)`, `
+        SELECT users.username, CASE WHEN comment_likes.is_like THEN 'comment_like' ELSE 'comment_dislike' END,
+               comment_likes.created_at, comments.created_at
+        FROM comment_likes
+        JOIN comments ON comment_likes.comment_id = comments.id
+        JOIN users ON comments.user_id = users.id
+        WHERE comment_likes.user_id != comments.user_id AND users.username IN (%s)`, `
+        SELECT users.username, reactions.type, reactions.created_at, posts.created_at
+        FROM reactions
+        JOIN posts ON reactions.target_type = 'post' AND reactions.target_id = posts.id
+        JOIN users ON posts.user_id = users.id
+        WHERE reactions.user_id != posts.user_id AND users.username IN (%s)`, `
+        SELECT users.username, reactions.type, reactions.created_at, comments.created_at
+        FROM reactions
+        JOIN comments ON reactions.target_type = 'comment' AND reactions.target_id = comments.id
+        JOIN users ON comments.user_id = users.id
+        WHERE reactions.user_id != comments.user_id AND users.username IN (%s)`,
+}
+
+// reputationCacheTTL is how long a computed reputation is reused. A reaction to a user's content
+// drops their entry at once, so this only bounds how late the decay shows.
+const reputationCacheTTL = 10 * time.Minute
+
+type cachedReputation struct {
+	reputation int
+	computedAt time.Time
+}
+
+// reputationCache holds recently computed reputations by username. The generation changes
+// whenever entries are dropped, so a computation that raced with a reaction is not stored.
+var reputationCache = struct {
+	sync.Mutex
+	entries    map[string]cachedReputation
+	generation int
+}{entries: make(map[string]cachedReputation)}
+
+// forgetReputations drops every cached reputation.
+func forgetReputations() {
+	reputationCache.Lock()
+	defer reputationCache.Unlock()
+	reputationCache.entries = make(map[string]cachedReputation)
+	reputationCache.generation++
+}
+
+// forgetAuthorReputation drops the cached reputation of the author of a post or comment, after a
+// reaction to it changed. contentTable is "posts" or "comments".
+func forgetAuthorReputation(contentTable, contentID string) {
+	var username string
+	err := db.QueryRow("SELECT users.username FROM "+contentTable+" JOIN users ON "+contentTable+".user_id = users.id WHERE "+contentTable+".id = ?",
+		contentID).Scan(&username)
+	if err != nil {
+		log.Println("Error finding the author to update their reputation:", err)
+		forgetReputations()
+		return
+	}
+
+	reputationCache.Lock()
+	defer reputationCache.Unlock()
+	delete(reputationCache.entries, username)
+	reputationCache.generation++
+}
+
+// GetReputations returns the reputation of each listed user, keyed by username. Recent results
+// come from the cache; the others are computed from the reactions to the users' content.
+func GetReputations(usernames []string) (map[string]int, error) {
+	reputations := make(map[string]int)
+	now := time.Now()
+
+	reputationCache.Lock()
+	generation := reputationCache.generation
+	var missing []string
+	for _, username := range usernames {
+		cached, ok := reputationCache.entries[username]
+		if ok && now.Sub(cached.computedAt) < reputationCacheTTL {
+			reputations[username] = cached.reputation
+		} else {
+			missing = append(missing, username)
+		}
+	}
+	reputationCache.Unlock()
+	if len(missing) == 0 {
+		return reputations, nil
+	}
+
+	computed, err := computeReputations(missing, now)
+	if err != nil {
+		return nil, err
+	}
+
+	reputationCache.Lock()
+	defer reputationCache.Unlock()
+	for username, reputation := range computed {
+		reputations[username] = reputation
+		if reputationCache.generation == generation {
+			reputationCache.entries[username] = cachedReputation{reputation: reputation, computedAt: now}
+		}
+	}
+	return reputations, nil
+}
+
+// computeReputations adds up the decayed weights of the reactions to the content of each listed user.
+func computeReputations(usernames []string, now time.Time) (map[string]int, error) {
+	reputations := make(map[string]int)
+
+	args := make([]interface{}, len(usernames))
+	for i, username := range usernames {
+		args[i] = username
+	}
+	policy := reputationPolicy
+	scores := make(map[string]float64)
+
+	for _, query := range reputationQueries {
+		rows, err := db.Query(fmt.Sprintf(query, placeholders(len(usernames))), args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var username, kind string
+			var reactedAt, contentAt sql.NullTime
+			if err := rows.Scan(&username, &kind, &reactedAt, &contentAt); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			at := reactedAt.Time
+			if !reactedAt.Valid {
+				at = contentAt.Time
+			}
+			scores[username] += decayedWeight(policy, kind, at, now)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, username := range usernames {
+		reputations[username] = int(math.Round(scores[username]))
+	}
+	return reputations, nil
+}
+
+// GetReputation computes the reputation of a user from the reactions to their posts and comments.
+func GetReputation(userID string) (int, error) {
+	username, err := GetUsernameByID(userID)
+	if err != nil {
+		return 0, err
+	}
+	reputations, err := GetReputations([]string{username})
+	return reputations[username], err
+}
+
+// LoadPostAuthorReputations fills the AuthorReputation of the posts.
+func LoadPostAuthorReputations(posts []Post) error {
+	var usernames []string
+	for _, post := range posts {
+		usernames = append(usernames, post.Author)
+	}
+	reputations, err := GetReputations(distinct(usernames))
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].AuthorReputation = reputations[posts[i].Author]
+	}
+	return nil
+}
+
+// LoadCommentAuthorReputations fills the AuthorReputation of the comments.
+func LoadCommentAuthorReputations(comments []Comment) error {
+	var usernames []string
+	for _, comment := range comments {
+		usernames = append(usernames, comment.Author)
+	}
+	reputations, err := GetReputations(distinct(usernames))
+	if err != nil {
+		return err
+	}
+	for i := range comments {
+		comments[i].AuthorReputation = reputations[comments[i].Author]
+	}
+	return nil
+}
+
+func distinct(values []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// PrivilegeThreshold returns the reputation needed for a privilege.
+func PrivilegeThreshold(privilege string) int {
+	return reputationPolicy.Thresholds[privilege]
+}
+
+// HasPrivilege reports whether the user's reputation unlocks a privilege.
+// Moderators and admins have every privilege.
+func HasPrivilege(userID, privilege string) (bool, error) {
+	role, err := GetUserRole(userID)
+	if err != nil {
+		return false, err
+	}
+	if role == RoleModerator || role == RoleAdmin {
+		return true, nil
+	}
+	reputation, err := GetReputation(userID)
+	if err != nil {
+		return false, err
+	}
+	return reputation >= PrivilegeThreshold(privilege), nil
+}
+
+// linkRegex matches web addresses in user content.
+var linkRegex = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S`)
+
+// ContainsLink reports whether stored content links off-site: a web address in the text, or a
+// rendered link to anything but a path on this site, like [x](https://...) or an email address.
+func ContainsLink(stored string) bool {
+	if linkRegex.MatchString(stored) {
+		return true
+	}
+	for _, href := range linkHrefs(stored) {
+		// linkTarget only lets paths through when they stay on this site
+		onSite := strings.HasPrefix(href, "#") || (strings.HasPrefix(href, "/") && linkTarget.MatchString(href))
+		if !onSite {
+			return true
+		}
+	}
+	return false
+}
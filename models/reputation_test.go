@@ -0,0 +1,199 @@
+package models
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDecayedWeight(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	policy := ReputationPolicy{
+		Weights:  map[string]float64{WeightPostLike: 10, WeightPostDislike: -2},
+		HalfLife: 30 * 24 * time.Hour,
+	}
+
+	tests := []struct {
+		kind string
+		age  time.Duration
+		want float64
+	}{
+		{WeightPostLike, 0, 10},
+		{WeightPostLike, 30 * 24 * time.Hour, 5},
+		{WeightPostLike, 60 * 24 * time.Hour, 2.5},
+		{WeightPostDislike, 30 * 24 * time.Hour, -1},
+		{WeightPostLike, -time.Hour, 10}, // clock skew does not increase the weight
+		{"unknown", 0, 0},
+	}
+	for _, tt := range tests {
+		got := decayedWeight(policy, tt.kind, now.Add(-tt.age), now)
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s after %v: expected %v; got %v", tt.kind, tt.age, tt.want, got)
+		}
+	}
+
+	// Without a half-life reactions never decay
+	policy.HalfLife = 0
+	if got := decayedWeight(policy, WeightPostLike, now.Add(-10*365*24*time.Hour), now); got != 10 {
+		t.Errorf("expected no decay; got %v", got)
+	}
+}
+
+func TestParseReputationNumbers(t *testing.T) {
+	numbers, err := ParseReputationNumbers("post_like=12, post_dislike=-3,love=0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if numbers[WeightPostLike] != 12 || numbers[WeightPostDislike] != -3 || numbers["love"] != 0.5 {
+		t.Errorf("unexpected numbers: %v", numbers)
+	}
+
+	for _, value := range []string{"post_like", "post_like=ten"} {
+		if _, err := ParseReputationNumbers(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
+
+func TestContainsLink(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"Read it at https://example.com/book", true},
+		{"HTTP://EXAMPLE.COM", true},
+		{"see www.example.com", true},
+		{"I loved this book", false},
+		{"the http protocol", false},
+		{"email me at reader@example.com", true},
+		{"[mail me](mailto:reader@example.com)", true},
+		{"[x](//evil.example/buy)", true},
+		{"[x](HTTPS:evil.example)", true},
+		{"thanks @alice, see #scifi", false},
+		{"[chapter 2](#chapter-2)", false},
+	}
+	for _, tt := range tests {
+		if got := ContainsLink(SanitizeInput(tt.text)); got != tt.want {
+			t.Errorf("%q: expected %v; got %v", tt.text, tt.want, got)
+		}
+	}
+}
+
+func TestGetReputation(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	fanID := registerTestUser(t, "fan")
+	criticID := registerTestUser(t, "critic")
+	postID := createTestPost(t, authorID, "A post")
+	commentID, err := CreateComment(postID, authorID, "A comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := GetReputationPolicy()
+	t.Cleanup(func() { SetReputationPolicy(original) })
+	policy := GetReputationPolicy()
+	policy.HalfLife = 0
+	policy.Thresholds[PrivilegeUploadImages] = 10
+	SetReputationPolicy(policy)
+
+	// A like on the post, a dislike on the comment and a love reaction; the author's own like does not count
+	steps := []func() error{
+		func() error { return LikePost(fanID, postID) },
+		func() error { return DislikeComment(criticID, commentID) },
+		func() error {
+			_, _, err := ToggleEmojiReaction(fanID, ReactionTargetComment, commentID, "love")
+			return err
+		},
+		func() error { return LikePost(authorID, postID) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := int(policy.Weights[WeightPostLike] + policy.Weights[WeightCommentDislike] + policy.Weights["love"])
+	reputation, err := GetReputation(authorID)
+	if err != nil || reputation != want {
+		t.Errorf("expected reputation %d; got %d (%v)", want, reputation, err)
+	}
+	reputations, err := GetReputations([]string{"author", "fan"})
+	if err != nil || reputations["author"] != want || reputations["fan"] != 0 {
+		t.Errorf("unexpected reputations: %v (%v)", reputations, err)
+	}
+
+	// Privileges follow the threshold
+	tests := []struct {
+		name   string
+		userID string
+		want   bool
+	}{
+		{"author", authorID, want >= 10},
+		{"fan", fanID, false},
+	}
+	for _, test := range tests {
+		allowed, err := HasPrivilege(test.userID, PrivilegeUploadImages)
+		if err != nil || allowed != test.want {
+			t.Errorf("%s: expected upload privilege %v; got %v (%v)", test.name, test.want, allowed, err)
+		}
+	}
+}
+
+func TestDefaultReputationWeights(t *testing.T) {
+	// Every emoji reaction is weighted as its catalog entry says, and nothing else is weighted
+	weights := defaultReputationWeights()
+	for _, reactionType := range EmojiReactionTypes {
+		if weight, ok := weights[reactionType.Key]; !ok || weight != reactionType.Weight {
+			t.Errorf("%s: expected weight %v; got %v (present: %v)", reactionType.Key, reactionType.Weight, weight, ok)
+		}
+	}
+	if want := len(EmojiReactionTypes) + 4; len(weights) != want {
+		t.Errorf("expected %d weights; got %v", want, weights)
+	}
+}
+
+func TestReputationCache(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	fanID := registerTestUser(t, "fan")
+	criticID := registerTestUser(t, "critic")
+	postID := createTestPost(t, authorID, "A post")
+	commentID, err := CreateComment(postID, authorID, "A comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := GetReputationPolicy()
+	t.Cleanup(func() { SetReputationPolicy(original) })
+	policy := GetReputationPolicy()
+	policy.HalfLife = 0
+	SetReputationPolicy(policy)
+	like, dislike, love := int(policy.Weights[WeightPostLike]), int(policy.Weights[WeightPostDislike]), int(policy.Weights["love"])
+
+	// Reputation is reused until a reaction to the author's content changes it; a like removed
+	// behind the cache's back only shows once another reaction comes in
+	tests := []struct {
+		name  string
+		apply func() error
+		want  int
+	}{
+		{"liked", func() error { return LikePost(fanID, postID) }, like},
+		{"like deleted directly", func() error { _, err := db.Exec("DELETE FROM post_likes"); return err }, like},
+		{"disliked", func() error { return DislikePost(criticID, postID) }, dislike},
+		{"comment loved", func() error {
+			_, _, err := ToggleEmojiReaction(fanID, ReactionTargetComment, commentID, "love")
+			return err
+		}, dislike + love},
+	}
+	for _, test := range tests {
+		if err := test.apply(); err != nil {
+			t.Fatal(err)
+		}
+		if reputation, err := GetReputation(authorID); err != nil || reputation != test.want {
+			t.Errorf("%s: expected reputation %d; got %d (%v)", test.name, test.want, reputation, err)
+		}
+	}
+}
@@ -0,0 +1,598 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/gofrs/uuid"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// OpenDB opens the SQLite database at path. Concurrent writers wait for the lock instead of
+// failing, and transactions take the write lock up front so read-then-write transactions
+// cannot deadlock each other.
+func OpenDB(path string) (*sql.DB, error) {
+	return sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_txlock=immediate")
+}
+
+// CreateTables defines the SQL schema for the forum database and creates tables if they don't exist.
+func CreateTables(db *sql.DB) {
+	createUsersTable := `
+    CREATE TABLE IF NOT EXISTS users (
+        id TEXT PRIMARY KEY,
+        email TEXT UNIQUE,
+        username TEXT UNIQUE,
+        password TEXT
+    );`
+
+	createPostsTable := `
+    CREATE TABLE IF NOT EXISTS posts (
+        id TEXT PRIMARY KEY,
+        user_id TEXT,
+        title TEXT DEFAULT '',
+        spoiler_for TEXT DEFAULT '',
+        publish_at DATETIME,
+        locked BOOLEAN DEFAULT FALSE,
+        archived_at DATETIME,
+        reopened_at DATETIME,
+        content TEXT,
+        created_at DATETIME,
+        likes INTEGER DEFAULT 0,
+        dislikes INTEGER DEFAULT 0,
+		image_path TEXT,
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    );`
+
+	createPostLikesTable := `
+    CREATE TABLE IF NOT EXISTS post_likes (
+        id TEXT PRIMARY KEY,
+        user_id TEXT,
+        post_id TEXT,
+        is_like BOOLEAN,
+        FOREIGN KEY (user_id) REFERENCES users(id),
+        FOREIGN KEY (post_id) REFERENCES posts(id),
+        UNIQUE (user_id, post_id)
+    );`
+
+	createCommentsTable := `
+    CREATE TABLE IF NOT EXISTS comments (
+        id TEXT PRIMARY KEY,
+        post_id TEXT,
+        user_id TEXT,
+        content TEXT,
+        created_at DATETIME,
+        likes INTEGER DEFAULT 0,
+        dislikes INTEGER DEFAULT 0,
+        FOREIGN KEY (post_id) REFERENCES posts(id),
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    );`
+
+	createCommentLikesTable := `
+    CREATE TABLE IF NOT EXISTS comment_likes (
+        id TEXT PRIMARY KEY,
+        user_id TEXT,
+        comment_id TEXT,
+        is_like BOOLEAN,
+        FOREIGN KEY (user_id) REFERENCES users(id),
+        FOREIGN KEY (comment_id) REFERENCES comments(id),
+        UNIQUE (user_id, comment_id)
+    );`
+
+	createUserTokensTable := `
+    CREATE TABLE IF NOT EXISTS user_tokens (
+        id TEXT PRIMARY KEY,
+        user_id TEXT,
+        purpose TEXT,
+        expires_at DATETIME,
+        used_at DATETIME,
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    );`
+
+	// Failed logins are counted per account and client address, so failures from one
+	// address cannot lock the owner out from another; the row with an empty client_ip
+	// counts the failures of the account from every address
+	createLoginFailuresTable := `
+    CREATE TABLE IF NOT EXISTS login_failures (
+        user_id TEXT,
+        client_ip TEXT,
+        failed_logins INTEGER DEFAULT 0,
+        last_failed_login DATETIME,
+        locked_until DATETIME,
+        PRIMARY KEY (user_id, client_ip),
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    );`
+
+	createRecoveryCodesTable := `
+    CREATE TABLE IF NOT EXISTS recovery_codes (
+        id TEXT PRIMARY KEY,
+        user_id TEXT,
+        code_hash TEXT,
+        used_at DATETIME,
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    );`
+
+	createSettingsTable := `
+    CREATE TABLE IF NOT EXISTS settings (
+        key TEXT PRIMARY KEY,
+        value TEXT
+    );`
+
+	createUserIdentitiesTable := `
+    CREATE TABLE IF NOT EXISTS user_identities (
+        id TEXT PRIMARY KEY,
+        user_id TEXT,
+        provider TEXT,
+        subject TEXT,
+        email TEXT,
+        created_at DATETIME,
+        FOREIGN KEY (user_id) REFERENCES users(id),
+        UNIQUE (provider, subject)
+    );`
+
+	createUserFollowsTable := `
+    CREATE TABLE IF NOT EXISTS user_follows (
+        follower_id TEXT,
+        followed_id TEXT,
+        created_at DATETIME,
+        PRIMARY KEY (follower_id, followed_id),
+        FOREIGN KEY (follower_id) REFERENCES users(id),
+        FOREIGN KEY (followed_id) REFERENCES users(id)
+    );`
+
+	createCategoryFollowsTable := `
+    CREATE TABLE IF NOT EXISTS category_follows (
+        user_id TEXT,
+        category_id TEXT,
+        created_at DATETIME,
+        PRIMARY KEY (user_id, category_id),
+        FOREIGN KEY (user_id) REFERENCES users(id),
+        FOREIGN KEY (category_id) REFERENCES categories(id)
+    );`
+
+	createNotificationsTable := `
+    CREATE TABLE IF NOT EXISTS notifications (
+        id TEXT PRIMARY KEY,
+        user_id TEXT,
+        actor_id TEXT,
+        type TEXT,
+        post_id TEXT DEFAULT '',
+        comment_id TEXT DEFAULT '',
+        created_at DATETIME,
+        read_at DATETIME,
+        FOREIGN KEY (user_id) REFERENCES users(id),
+        FOREIGN KEY (actor_id) REFERENCES users(id)
+    );
+    CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications (user_id, read_at);`
+
+	createNotificationPreferencesTable := `
+    CREATE TABLE IF NOT EXISTS notification_preferences (
+        user_id TEXT,
+        type TEXT,
+        enabled BOOLEAN,
+        PRIMARY KEY (user_id, type),
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    );`
+
+	// The like and dislike counters of posts and comments are kept in step with the
+	// reaction rows by triggers, in the same transaction as the change itself.
+	createReactionCountTriggers := `
+    CREATE TRIGGER IF NOT EXISTS post_likes_count_insert AFTER INSERT ON post_likes BEGIN
+        UPDATE posts SET likes = likes + (NEW.is_like = 1), dislikes = dislikes + (NEW.is_like = 0) WHERE id = NEW.post_id;
+    END;
+    CREATE TRIGGER IF NOT EXISTS post_likes_count_delete AFTER DELETE ON post_likes BEGIN
+        UPDATE posts SET likes = likes - (OLD.is_like = 1), dislikes = dislikes - (OLD.is_like = 0) WHERE id = OLD.post_id;
+    END;
+    CREATE TRIGGER IF NOT EXISTS post_likes_count_update AFTER UPDATE OF is_like ON post_likes BEGIN
+        UPDATE posts SET likes = likes - (OLD.is_like = 1) + (NEW.is_like = 1),
+                         dislikes = dislikes - (OLD.is_like = 0) + (NEW.is_like = 0)
+        WHERE id = NEW.post_id;
+    END;
+    CREATE TRIGGER IF NOT EXISTS comment_likes_count_insert AFTER INSERT ON comment_likes BEGIN
+        UPDATE comments SET likes = likes + (NEW.is_like = 1), dislikes = dislikes + (NEW.is_like = 0) WHERE id = NEW.comment_id;
+    END;
+    CREATE TRIGGER IF NOT EXISTS comment_likes_count_delete AFTER DELETE ON comment_likes BEGIN
+        UPDATE comments SET likes = likes - (OLD.is_like = 1), dislikes = dislikes - (OLD.is_like = 0) WHERE id = OLD.comment_id;
+    END;
+    CREATE TRIGGER IF NOT EXISTS comment_likes_count_update AFTER UPDATE OF is_like ON comment_likes BEGIN
+        UPDATE comments SET likes = likes - (OLD.is_like = 1) + (NEW.is_like = 1),
+                            dislikes = dislikes - (OLD.is_like = 0) + (NEW.is_like = 0)
+        WHERE id = NEW.comment_id;
+    END;`
+
+	// Counters written before the triggers existed may have drifted; recount them when the triggers are added
+	syncReactionCounts := `
+    UPDATE posts SET
+        likes = (SELECT COUNT(*) FROM post_likes WHERE post_likes.post_id = posts.id AND is_like = 1),
+        dislikes = (SELECT COUNT(*) FROM post_likes WHERE post_likes.post_id = posts.id AND is_like = 0);
+    UPDATE comments SET
+        likes = (SELECT COUNT(*) FROM comment_likes WHERE comment_likes.comment_id = comments.id AND is_like = 1),
+        dislikes = (SELECT COUNT(*) FROM comment_likes WHERE comment_likes.comment_id = comments.id AND is_like = 0);`
+
+	// Emoji reactions on posts and comments; like and dislike stay in post_likes and comment_likes
+	createReactionsTable := `
+    CREATE TABLE IF NOT EXISTS reactions (
+        id TEXT PRIMARY KEY,
+        user_id TEXT,
+        target_type TEXT,
+        target_id TEXT,
+        type TEXT,
+        created_at DATETIME,
+        FOREIGN KEY (user_id) REFERENCES users(id),
+        UNIQUE (user_id, target_type, target_id, type)
+    );
+    CREATE INDEX IF NOT EXISTS idx_reactions_target ON reactions (target_type, target_id);`
+
+	// Named reading lists; bookmarks outside any list have an empty collection_id
+	createCollectionsTable := `
+    CREATE TABLE IF NOT EXISTS collections (
+        id TEXT PRIMARY KEY,
+        user_id TEXT,
+        name TEXT,
+        is_public BOOLEAN DEFAULT FALSE,
+        created_at DATETIME,
+        FOREIGN KEY (user_id) REFERENCES users(id),
+        UNIQUE (user_id, name)
+    );`
+
+	createBookmarksTable := `
+    CREATE TABLE IF NOT EXISTS bookmarks (
+        id TEXT PRIMARY KEY,
+        user_id TEXT,
+        collection_id TEXT DEFAULT '',
+        target_type TEXT,
+        target_id TEXT,
+        created_at DATETIME,
+        FOREIGN KEY (user_id) REFERENCES users(id),
+        UNIQUE (user_id, collection_id, target_type, target_id)
+    );
+    CREATE INDEX IF NOT EXISTS idx_bookmarks_target ON bookmarks (target_type, target_id);`
+
+	createCategoriesTable := `
+    CREATE TABLE IF NOT EXISTS categories (
+        id TEXT PRIMARY KEY,
+        name TEXT UNIQUE,
+        slug TEXT,
+        description TEXT DEFAULT '',
+        parent_id TEXT DEFAULT '',
+        position INTEGER DEFAULT 0,
+        archived BOOLEAN DEFAULT FALSE
+    );`
+
+	// Free-form tags; skeleton folds case and lookalike characters so "SciFi" and "sci-fi" are one tag
+	createTagsTable := `
+    CREATE TABLE IF NOT EXISTS tags (
+        id TEXT PRIMARY KEY,
+        name TEXT,
+        skeleton TEXT UNIQUE
+    );`
+
+	createPostTagsTable := `
+    CREATE TABLE IF NOT EXISTS post_tags (
+        post_id TEXT,
+        tag_id TEXT,
+        PRIMARY KEY (post_id, tag_id),
+        FOREIGN KEY (post_id) REFERENCES posts(id),
+        FOREIGN KEY (tag_id) REFERENCES tags(id)
+    );
+    CREATE INDEX IF NOT EXISTS idx_post_tags_tag ON post_tags (tag_id);`
+
+	createDraftsTable := `
+    CREATE TABLE IF NOT EXISTS drafts (
+        id TEXT PRIMARY KEY,
+        user_id TEXT,
+        title TEXT DEFAULT '',
+        content TEXT DEFAULT '',
+        tags TEXT DEFAULT '',
+        categories TEXT DEFAULT '',
+        spoiler_for TEXT DEFAULT '',
+        updated_at DATETIME,
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    );
+    CREATE INDEX IF NOT EXISTS idx_drafts_user ON drafts (user_id, updated_at);`
+
+	createPinnedPostsTable := `
+    CREATE TABLE IF NOT EXISTS pinned_posts (
+        post_id TEXT,
+        category_id TEXT DEFAULT '', -- empty when pinned at the top of the main feed
+        pinned_at DATETIME,
+        PRIMARY KEY (post_id, category_id),
+        FOREIGN KEY (post_id) REFERENCES posts(id)
+    );`
+
+	createPollsTable := `
+    CREATE TABLE IF NOT EXISTS polls (
+        id TEXT PRIMARY KEY,
+        post_id TEXT UNIQUE,
+        question TEXT,
+        multiple BOOLEAN DEFAULT FALSE,
+        anonymous BOOLEAN DEFAULT FALSE,
+        closes_at DATETIME,
+        created_at DATETIME,
+        FOREIGN KEY (post_id) REFERENCES posts(id)
+    );
+    CREATE TABLE IF NOT EXISTS poll_options (
+        id TEXT PRIMARY KEY,
+        poll_id TEXT,
+        position INTEGER,
+        text TEXT,
+        FOREIGN KEY (poll_id) REFERENCES polls(id)
+    );
+    CREATE INDEX IF NOT EXISTS idx_poll_options_poll ON poll_options (poll_id, position);
+    -- One ballot per user and poll; the votes of a ballot are its chosen options
+    CREATE TABLE IF NOT EXISTS poll_ballots (
+        poll_id TEXT,
+        user_id TEXT,
+        created_at DATETIME,
+        PRIMARY KEY (poll_id, user_id),
+        FOREIGN KEY (poll_id) REFERENCES polls(id),
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    );
+    CREATE TABLE IF NOT EXISTS poll_votes (
+        poll_id TEXT,
+        user_id TEXT,
+        option_id TEXT,
+        PRIMARY KEY (poll_id, user_id, option_id),
+        FOREIGN KEY (poll_id, user_id) REFERENCES poll_ballots(poll_id, user_id),
+        FOREIGN KEY (option_id) REFERENCES poll_options(id)
+    );
+    CREATE INDEX IF NOT EXISTS idx_poll_votes_option ON poll_votes (option_id);`
+
+	createMentionsTable := `
+    CREATE TABLE IF NOT EXISTS mentions (
+        user_id TEXT,
+        post_id TEXT,
+        comment_id TEXT DEFAULT '',
+        created_at DATETIME,
+        PRIMARY KEY (user_id, post_id, comment_id),
+        FOREIGN KEY (user_id) REFERENCES users(id),
+        FOREIGN KEY (post_id) REFERENCES posts(id)
+    );`
+
+	createPostCategoriesTable := `
+	CREATE TABLE IF NOT EXISTS post_categories (
+		post_id TEXT,
+		category_id TEXT,
+		PRIMARY KEY (post_id, category_id),
+		FOREIGN KEY (post_id) REFERENCES posts(id),
+		FOREIGN KEY (category_id) REFERENCES categories(id)
+	);`
+	// Execute the table creation commands
+	_, err := db.Exec(createUsersTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createUserTokensTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createLoginFailuresTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createRecoveryCodesTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createSettingsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createUserIdentitiesTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createCategoriesTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+	seedCategories(db)
+
+	_, err = db.Exec(createNotificationsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createNotificationPreferencesTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createUserFollowsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createCategoryFollowsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createPostCategoriesTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createTagsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createPostTagsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createMentionsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createDraftsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createPollsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createPinnedPostsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createPostsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createPostLikesTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createCommentsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createCommentLikesTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var hasTriggers bool
+	err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'trigger' AND name = 'post_likes_count_insert')").Scan(&hasTriggers)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createReactionCountTriggers)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !hasTriggers {
+		_, err = db.Exec(syncReactionCounts)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	_, err = db.Exec(createReactionsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createCollectionsTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(createBookmarksTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	migrateColumns(db)
+
+	// Older categories get their slug from BackfillCategorySlugs; NULLs do not clash
+	_, err = db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_slug ON categories (slug)")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// seedData(db)
+}
+
+// migrateColumns adds columns introduced after the initial schema to existing databases.
+func migrateColumns(db *sql.DB) {
+	columns := []struct {
+		table      string
+		name       string
+		definition string
+	}{
+		{"users", "session_token", "TEXT"},
+		// Accounts created before verification existed are treated as verified;
+		// RegisterUser inserts new accounts as unverified.
+		{"users", "email_verified", "BOOLEAN DEFAULT TRUE"},
+		{"users", "role", "TEXT DEFAULT 'user'"},
+		{"users", "totp_secret", "TEXT"},
+		{"users", "totp_enabled", "BOOLEAN DEFAULT FALSE"},
+		{"users", "totp_last_step", "INTEGER DEFAULT 0"},
+		// Filled in by BackfillUsernameSkeletons for existing users
+		{"users", "username_skeleton", "TEXT"},
+		// Join dates are only known for accounts created from here on
+		{"users", "created_at", "DATETIME"},
+		{"users", "bio", "TEXT"},
+		{"users", "avatar_path", "TEXT"},
+		// Reputation decay uses the reaction time, falling back to the content time for older rows
+		{"post_likes", "created_at", "DATETIME"},
+		{"comment_likes", "created_at", "DATETIME"},
+		{"categories", "slug", "TEXT"},
+		{"categories", "description", "TEXT DEFAULT ''"},
+		{"categories", "position", "INTEGER DEFAULT 0"},
+		{"categories", "archived", "BOOLEAN DEFAULT FALSE"},
+		{"categories", "parent_id", "TEXT DEFAULT ''"},
+		// Older posts have no title; their URLs take the slug from the content
+		{"posts", "title", "TEXT DEFAULT ''"},
+		{"posts", "spoiler_for", "TEXT DEFAULT ''"},
+		{"users", "reveal_spoilers", "BOOLEAN DEFAULT FALSE"},
+		// Set while a post is scheduled, cleared when it is published
+		{"posts", "publish_at", "DATETIME"},
+		{"posts", "locked", "BOOLEAN DEFAULT FALSE"},
+		// Set by ArchiveInactivePosts
+		{"posts", "archived_at", "DATETIME"},
+		// Set by UnarchivePost; inactivity is counted from it as from a new comment
+		{"posts", "reopened_at", "DATETIME"},
+	}
+
+	for _, column := range columns {
+		err := addColumnIfMissing(db, column.table, column.name, column.definition)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// addColumnIfMissing runs ALTER TABLE ADD COLUMN unless the table already has the column.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM pragma_table_info(?) WHERE name = ?)", table, column).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
+}
+
+// seedCategories inserts the default categories into a new database. Admins manage them from then on,
+// so renamed or merged categories are not brought back.
+func seedCategories(db *sql.DB) {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM categories").Scan(&count); err != nil {
+		log.Fatal(err)
+	}
+	if count > 0 {
+		return
+	}
+
+	categories := []string{"Autobiography", "Comedy", "Science Fiction", "Fantasy", "Mystery", "Other"}
+
+	for i, category := range categories {
+		categoryID, _ := uuid.NewV4()
+		_, err := db.Exec("INSERT OR IGNORE INTO categories (id, name, slug, position) VALUES (?, ?, ?, ?)",
+			categoryID.String(), category, Slugify(category), i+1)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
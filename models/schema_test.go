@@ -0,0 +1,86 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// setupTestDB creates the full schema in a temporary database and points the models at it.
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	testDB, err := OpenDB(filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { testDB.Close() })
+	CreateTables(testDB)
+	SetDB(testDB)
+	SetBcryptCost(bcrypt.MinCost)
+}
+
+// registerTestUser creates a user and returns their ID.
+func registerTestUser(t *testing.T, username string) string {
+	t.Helper()
+	sessionToken, err := RegisterUser(username+"@example.com", username, "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, _, err := GetIDBySessionToken(sessionToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return userID
+}
+
+// createTestPost creates an untitled post and returns its ID.
+func createTestPost(t *testing.T, userID, content string) string {
+	t.Helper()
+	postID, err := CreatePost(userID, "", content, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return postID
+}
+
+func TestCreateTablesRecountsOnlyWhenAddingTriggers(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	postID := createTestPost(t, authorID, "A post")
+	if err := LikePost(authorID, postID); err != nil {
+		t.Fatal(err)
+	}
+	likes := func() int {
+		t.Helper()
+		var likes int
+		if err := db.QueryRow("SELECT likes FROM posts WHERE id = ?", postID).Scan(&likes); err != nil {
+			t.Fatal(err)
+		}
+		return likes
+	}
+
+	tests := []struct {
+		name  string
+		setup string
+		want  int
+	}{
+		{"triggers in place", "", 5},
+		{"triggers missing", "DROP TRIGGER post_likes_count_insert", 1},
+	}
+	for _, test := range tests {
+		if _, err := db.Exec("UPDATE posts SET likes = 5 WHERE id = ?", postID); err != nil {
+			t.Fatal(err)
+		}
+		if test.setup != "" {
+			if _, err := db.Exec(test.setup); err != nil {
+				t.Fatal(err)
+			}
+		}
+		CreateTables(db)
+		if got := likes(); got != test.want {
+			t.Errorf("%s: expected %d likes after CreateTables; got %d", test.name, test.want, got)
+		}
+	}
+}
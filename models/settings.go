@@ -0,0 +1,55 @@
+package models
+
+import (
+	"database/sql"
+	"strconv"
+)
+
+// Site setting keys editable from the admin page.
+const (
+	SettingRequire2FAPrivileged = "require_2fa_privileged"
+	SettingEnabledReactions     = "enabled_reactions"  // comma-separated emoji reaction keys
+	SettingArchiveAfterDays     = "archive_after_days" // 0 keeps posts open forever
+)
+
+// GetSetting returns the stored value of a site setting, or fallback when it was never set.
+func GetSetting(key, fallback string) (string, error) {
+	var value string
+	err := db.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return fallback, nil
+	}
+	return value, err
+}
+
+// GetBoolSetting returns a site setting parsed as a boolean.
+func GetBoolSetting(key string, fallback bool) (bool, error) {
+	value, err := GetSetting(key, strconv.FormatBool(fallback))
+	if err != nil {
+		return fallback, err
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback, nil
+	}
+	return parsed, nil
+}
+
+// GetIntSetting returns a site setting parsed as an integer.
+func GetIntSetting(key string, fallback int) (int, error) {
+	value, err := GetSetting(key, strconv.Itoa(fallback))
+	if err != nil {
+		return fallback, err
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback, nil
+	}
+	return parsed, nil
+}
+
+// SetSetting stores a site setting, replacing any previous value.
+func SetSetting(key, value string) error {
+	_, err := db.Exec("INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value", key, value)
+	return err
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Spoiler blocks hide part of a post or comment until the reader opens them:
+//
+//	:::spoiler The ending of Dune
+//	Paul ...
+//	:::
+//
+// The text after :::spoiler is an optional label. A block without a closing ::: runs to the end.
+// Spoilers do not nest; the first ::: closes every open spoiler.
+
+var kindSpoiler = ast.NewNodeKind("Spoiler")
+
+// spoilerNode is a spoiler block; its children are the hidden blocks.
+type spoilerNode struct {
+	ast.BaseBlock
+	Label []byte
+}
+
+func (n *spoilerNode) Kind() ast.NodeKind {
+	return kindSpoiler
+}
+
+func (n *spoilerNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Label": string(n.Label)}, nil)
+}
+
+var spoilerOpening = []byte(":::spoiler")
+
+type spoilerParser struct{}
+
+func (p spoilerParser) Trigger() []byte {
+	return []byte{':'}
+}
+
+func (p spoilerParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], spoilerOpening) {
+		return nil, parser.NoChildren
+	}
+	rest := line[pos+len(spoilerOpening):]
+	// ":::spoilers" is not an opening
+	if len(rest) > 0 && !util.IsSpace(rest[0]) {
+		return nil, parser.NoChildren
+	}
+	node := &spoilerNode{Label: util.TrimRightSpace(util.TrimLeftSpace(rest))}
+	skipLine(reader, line, segment)
+	return node, parser.HasChildren
+}
+
+func (p spoilerParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	line, segment := reader.PeekLine()
+	if bytes.Equal(util.TrimRightSpace(util.TrimLeftSpace(line)), []byte(":::")) {
+		skipLine(reader, line, segment)
+		return parser.Close
+	}
+	return parser.Continue | parser.HasChildren
+}
+
+// skipLine advances the reader to the end of the current line, leaving the line break.
+func skipLine(reader text.Reader, line []byte, segment text.Segment) {
+	newline := 0
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		newline = 1
+	}
+	reader.Advance(segment.Len() - newline + segment.Padding)
+}
+
+func (p spoilerParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (p spoilerParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (p spoilerParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// spoilerRenderer renders spoilers as closed <details> elements, or, when hide is set,
+// as a placeholder without the hidden text, for excerpts.
+type spoilerRenderer struct {
+	hide bool
+}
+
+func (r spoilerRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindSpoiler, r.render)
+}
+
+func (r spoilerRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if r.hide {
+		if entering {
+			_, _ = w.WriteString("<p>[spoiler]</p>\n")
+		}
+		return ast.WalkSkipChildren, nil
+	}
+	if !entering {
+		_, _ = w.WriteString("</details>\n")
+		return ast.WalkContinue, nil
+	}
+	_, _ = w.WriteString(`<details class="spoiler"><summary>Spoiler`)
+	if label := n.(*spoilerNode).Label; len(label) > 0 {
+		_, _ = w.WriteString(": ")
+		_, _ = w.Write(util.EscapeHTML(label))
+	}
+	_, _ = w.WriteString("</summary>\n")
+	return ast.WalkContinue, nil
+}
+
+// spoilerExtension adds spoiler blocks to a Markdown renderer.
+type spoilerExtension struct {
+	hide bool
+}
+
+func (e spoilerExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithBlockParsers(util.Prioritized(spoilerParser{}, 150)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(spoilerRenderer{hide: e.hide}, 150)))
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSpoilerRendering(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	content := SanitizeInput("Did you see the ending?\n:::spoiler Chapter 40\nThe dragon wins\n:::")
+	postID := createTestPost(t, authorID, content)
+
+	// Spoiler blocks render closed and stay out of the excerpt
+	post, err := GetPostByID(postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(post.Content), `<details class="spoiler"><summary>Spoiler: Chapter 40</summary>`) {
+		t.Errorf("expected a closed spoiler; got %q", post.Content)
+	}
+	if strings.Contains(post.Excerpt, "dragon") {
+		t.Errorf("the excerpt gives the spoiler away: %q", post.Excerpt)
+	}
+}
+
+func TestSetPostSpoiler(t *testing.T) {
+	setupTestDB(t)
+
+	authorID := registerTestUser(t, "author")
+	postID := createTestPost(t, authorID, "The ending")
+	if post, err := GetPostByID(postID); err != nil || post.SpoilerFor != "" {
+		t.Errorf("expected no spoiler warning; got %q (%v)", post.SpoilerFor, err)
+	}
+
+	// The spoiler warning is stored trimmed and shows on lists
+	if err := SetPostSpoiler(postID, "  Dragonflight "); err != nil {
+		t.Fatal(err)
+	}
+	posts, err := GetPostsByUser(authorID)
+	if err != nil || len(posts) != 1 || posts[0].SpoilerFor != "Dragonflight" {
+		t.Errorf("expected the spoiler warning in lists; got %v (%v)", posts, err)
+	}
+	if IsValidSpoilerFor(strings.Repeat("a", MaxSpoilerForLength+1)) {
+		t.Error("expected an overlong book to be rejected")
+	}
+}
+
+func TestRevealSpoilers(t *testing.T) {
+	setupTestDB(t)
+
+	readerID := registerTestUser(t, "reader")
+
+	// Spoilers stay closed until the reader chooses otherwise
+	if reveal, err := RevealsSpoilers(readerID); err != nil || reveal {
+		t.Errorf("expected spoilers closed by default; got %v (%v)", reveal, err)
+	}
+	for _, want := range []bool{true, false} {
+		if err := SetRevealSpoilers(readerID, want); err != nil {
+			t.Fatal(err)
+		}
+		if reveal, err := RevealsSpoilers(readerID); err != nil || reveal != want {
+			t.Errorf("expected reveal %v; got %v (%v)", want, reveal, err)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+)
+
+// Limits on the tags of a post.
+const (
+	MaxTagsPerPost = 5
+	MaxTagLength   = 30
+)
+
+var (
+	ErrTooManyTags = errors.New("too many tags")
+	ErrTagTooLong  = errors.New("tag too long")
+)
+
+// Tag is a free-form label users add to their posts.
+type Tag struct {
+	Name      string
+	PostCount int
+	Weight    int // 1 to 5, the size of the tag in the tag cloud
+}
+
+// NormalizeTag turns user input into a tag name: lowercase words joined by dashes, without a leading #.
+func NormalizeTag(raw string) string {
+	return slugWords(raw)
+}
+
+// TagSkeleton reduces a tag to the form in which tags that look alike are equal, so "sci-fi",
+// "SciFi" and a "scifi" typed with Cyrillic letters are the same tag.
+func TagSkeleton(name string) string {
+	return UsernameSkeleton(NormalizeTag(name))
+}
+
+// ParseTags splits a comma-separated list of tags, normalizes them and drops duplicates.
+func ParseTags(input string) ([]string, error) {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, raw := range strings.Split(input, ",") {
+		name := NormalizeTag(raw)
+		if name == "" || seen[TagSkeleton(name)] {
+			continue
+		}
+		if utf8.RuneCountInString(name) > MaxTagLength {
+			return nil, ErrTagTooLong
+		}
+		seen[TagSkeleton(name)] = true
+		tags = append(tags, name)
+	}
+	if len(tags) > MaxTagsPerPost {
+		return nil, ErrTooManyTags
+	}
+	return tags, nil
+}
+
+// SetPostTags adds the tags to a post. Tags that look like an existing tag are stored as that tag.
+func SetPostTags(postID string, names []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setPostTags(tx, postID, names); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func setPostTags(ex execer, postID string, names []string) error {
+	for _, name := range names {
+		newID, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		_, err = ex.Exec("INSERT OR IGNORE INTO tags (id, name, skeleton) VALUES (?, ?, ?)", newID.String(), name, TagSkeleton(name))
+		if err != nil {
+			return err
+		}
+		_, err = ex.Exec("INSERT OR IGNORE INTO post_tags (post_id, tag_id) SELECT ?, id FROM tags WHERE skeleton = ?", postID, TagSkeleton(name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTagsForPost retrieves the names of the tags of a post.
+func GetTagsForPost(postID string) ([]string, error) {
+	rows, err := db.Query(`
+        SELECT tags.name
+        FROM tags
+        JOIN post_tags ON tags.id = post_tags.tag_id
+        WHERE post_tags.post_id = ?
+        ORDER BY tags.name
+    `, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// GetTag retrieves a tag by name or by any name that looks like it.
+func GetTag(name string) (Tag, error) {
+	var tag Tag
+	err := db.QueryRow(`
+        SELECT tags.name, (
+            SELECT COUNT(*) FROM post_tags JOIN posts ON posts.id = post_tags.post_id
+            WHERE post_tags.tag_id = tags.id AND posts.publish_at IS NULL)
+        FROM tags WHERE tags.skeleton = ?
+    `, TagSkeleton(name)).Scan(&tag.Name, &tag.PostCount)
+	return tag, err
+}
+
+// GetPostsByTag returns one page of the posts with a tag, newest first, and whether there are more.
+func GetPostsByTag(name string, page, perPage int) ([]Post, bool, error) {
+	rows, err := db.Query(`
+        SELECT posts.id, posts.content, posts.created_at, posts.likes, posts.dislikes, posts.image_path, posts.title, posts.spoiler_for, posts.locked, posts.archived_at, users.username
+        FROM posts
+        JOIN users ON posts.user_id = users.id
+        JOIN post_tags ON posts.id = post_tags.post_id
+        JOIN tags ON post_tags.tag_id = tags.id
+        WHERE tags.skeleton = ? AND posts.publish_at IS NULL
+        ORDER BY posts.created_at DESC
+        LIMIT ? OFFSET ?
+    `, TagSkeleton(name), perPage+1, (page-1)*perPage)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	posts, err := scanPosts(rows)
+	if err != nil {
+		return nil, false, err
+	}
+	hasMore := len(posts) > perPage
+	if hasMore {
+		posts = posts[:perPage]
+	}
+	return posts, hasMore, nil
+}
+
+// SuggestTags returns the most used tags that start like the prefix, for autocomplete.
+func SuggestTags(prefix string, limit int) ([]string, error) {
+	skeleton := TagSkeleton(prefix)
+	if skeleton == "" {
+		return nil, nil
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(skeleton)
+	rows, err := db.Query(`
+        SELECT tags.name
+        FROM tags
+        LEFT JOIN post_tags ON post_tags.tag_id = tags.id
+        WHERE tags.skeleton LIKE ? ESCAPE '\'
+        GROUP BY tags.id
+        ORDER BY COUNT(post_tags.post_id) DESC, tags.name
+        LIMIT ?
+    `, escaped+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// GetTagCloud returns the most used tags in alphabetical order, weighted by how often they are used.
+func GetTagCloud(limit int) ([]Tag, error) {
+	rows, err := db.Query(`
+        SELECT tags.name, COUNT(*) AS uses
+        FROM tags
+        JOIN post_tags ON post_tags.tag_id = tags.id
+        JOIN posts ON posts.id = post_tags.post_id
+        WHERE posts.publish_at IS NULL
+        GROUP BY tags.id
+        ORDER BY uses DESC, tags.name
+        LIMIT ?
+    `, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []Tag
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.Name, &tag.PostCount); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Weights grow with the logarithm of the use count, so one popular tag does not flatten the others
+	if len(tags) > 0 {
+		most := math.Log(float64(tags[0].PostCount) + 1)
+		least := math.Log(float64(tags[len(tags)-1].PostCount) + 1)
+		for i := range tags {
+			weight := 1
+			if most > least {
+				weight += int(math.Round(4 * (math.Log(float64(tags[i].PostCount)+1) - least) / (most - least)))
+			}
+			tags[i].Weight = weight
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"Fantasy", "fantasy"},
+		{"#Sci Fi", "sci-fi"},
+		{"  young--adult!  ", "young-adult"},
+		{"Классика", "классика"},
+		{"###", ""},
+	}
+	for _, test := range tests {
+		if got := NormalizeTag(test.raw); got != test.want {
+			t.Errorf("NormalizeTag(%q) = %q; want %q", test.raw, got, test.want)
+		}
+	}
+}
+
+func TestTagSkeleton(t *testing.T) {
+	// Latin "scifi", then with a Cyrillic "с" and "і"
+	want := TagSkeleton("scifi")
+	for _, name := range []string{"SciFi", "sci-fi", "#sci fi", "sсіfi"} {
+		if got := TagSkeleton(name); got != want {
+			t.Errorf("TagSkeleton(%q) = %q; want %q", name, got, want)
+		}
+	}
+	if TagSkeleton("fantasy") == want {
+		t.Error("expected different tags to have different skeletons")
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []string
+		wantErr error
+	}{
+		{" #Sci Fi, scifi ,, Audiobooks", []string{"sci-fi", "audiobooks"}, nil},
+		{"a,b,c,d,e,f", nil, ErrTooManyTags},
+		{strings.Repeat("x", MaxTagLength+1), nil, ErrTagTooLong},
+	}
+	for _, test := range tests {
+		got, err := ParseTags(test.input)
+		if err != test.wantErr || strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("ParseTags(%q) = %v, %v; want %v, %v", test.input, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+// createTaggedPosts tags one post sci-fi and audiobooks, and another a look-alike of sci-fi.
+func createTaggedPosts(t *testing.T) (firstID, secondID string) {
+	t.Helper()
+	authorID := registerTestUser(t, "author")
+	firstID = createTestPost(t, authorID, "First")
+	secondID = createTestPost(t, authorID, "Second")
+	if err := SetPostTags(firstID, []string{"sci-fi", "audiobooks"}); err != nil {
+		t.Fatal(err)
+	}
+	// "sсifi" with a Cyrillic "с"
+	if err := SetPostTags(secondID, []string{"sсifi"}); err != nil {
+		t.Fatal(err)
+	}
+	return firstID, secondID
+}
+
+func TestSetPostTags(t *testing.T) {
+	setupTestDB(t)
+
+	_, secondID := createTaggedPosts(t)
+
+	// Tags that look alike are stored as one
+	post, err := GetPostByID(secondID)
+	if err != nil || len(post.Tags) != 1 || post.Tags[0] != "sci-fi" {
+		t.Errorf("expected the existing sci-fi tag; got %v (%v)", post.Tags, err)
+	}
+	tag, err := GetTag("SciFi")
+	if err != nil || tag.Name != "sci-fi" || tag.PostCount != 2 {
+		t.Errorf("unexpected tag %+v (%v)", tag, err)
+	}
+	posts, hasMore, err := GetPostsByTag("sci-fi", 1, 1)
+	if err != nil || len(posts) != 1 || !hasMore {
+		t.Errorf("expected one page of one post; got %d posts, more %v (%v)", len(posts), hasMore, err)
+	}
+}
+
+func TestSuggestTags(t *testing.T) {
+	setupTestDB(t)
+
+	createTaggedPosts(t)
+
+	// Suggestions match the start of tags, most used first
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"SC", []string{"sci-fi"}},
+		{"", nil},
+		{"%", nil},
+	}
+	for _, test := range tests {
+		names, err := SuggestTags(test.prefix, 5)
+		if err != nil || strings.Join(names, ",") != strings.Join(test.want, ",") {
+			t.Errorf("SuggestTags(%q) = %v (%v); want %v", test.prefix, names, err, test.want)
+		}
+	}
+}
+
+func TestGetTagCloud(t *testing.T) {
+	setupTestDB(t)
+
+	createTaggedPosts(t)
+
+	// The cloud is alphabetical and weighs popular tags more
+	cloud, err := GetTagCloud(10)
+	if err != nil || len(cloud) != 2 {
+		t.Fatalf("unexpected cloud %v (%v)", cloud, err)
+	}
+	if cloud[0].Name != "audiobooks" || cloud[0].Weight != 1 || cloud[1].Name != "sci-fi" || cloud[1].Weight != 5 {
+		t.Errorf("unexpected cloud %+v", cloud)
+	}
+}
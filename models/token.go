@@ -0,0 +1,119 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Token purposes; a token issued for one purpose is never accepted for another.
+const (
+	TokenEmailVerification = "email_verification"
+	TokenPasswordReset     = "password_reset"
+	TokenLoginChallenge    = "login_challenge"
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+var tokenSecret []byte
+
+// SetTokenSecret sets the key used to sign tokens. Without it a random key is generated,
+// which means tokens stop working after a restart.
+func SetTokenSecret(secret []byte) {
+	tokenSecret = secret
+}
+
+func getTokenSecret() []byte {
+	if tokenSecret == nil {
+		tokenSecret = make([]byte, 32)
+		if _, err := rand.Read(tokenSecret); err != nil {
+			panic(err)
+		}
+	}
+	return tokenSecret
+}
+
+// signToken returns the HMAC of everything a token is bound to.
+func signToken(tokenID, userID, purpose string, expiresAt time.Time) string {
+	mac := hmac.New(sha256.New, getTokenSecret())
+	fmt.Fprintf(mac, "%s|%s|%s|%d", tokenID, userID, purpose, expiresAt.Unix())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CreateToken issues a signed single-use token for the user that expires after ttl.
+func CreateToken(userID, purpose string, ttl time.Duration) (string, error) {
+	tokenID, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+
+	_, err = db.Exec("INSERT INTO user_tokens (id, user_id, purpose, expires_at) VALUES (?, ?, ?, ?)",
+		tokenID.String(), userID, purpose, expiresAt)
+	if err != nil {
+		return "", err
+	}
+
+	return tokenID.String() + "." + signToken(tokenID.String(), userID, purpose, expiresAt), nil
+}
+
+// CheckToken validates a token for the given purpose and returns its user ID without using it up.
+func CheckToken(token, purpose string) (string, error) {
+	tokenID, signature, found := strings.Cut(token, ".")
+	if !found {
+		return "", ErrInvalidToken
+	}
+
+	var userID, storedPurpose string
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err := db.QueryRow("SELECT user_id, purpose, expires_at, used_at FROM user_tokens WHERE id = ?", tokenID).
+		Scan(&userID, &storedPurpose, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidToken
+	} else if err != nil {
+		return "", err
+	}
+
+	expected := signToken(tokenID, userID, storedPurpose, expiresAt)
+	if !hmac.Equal([]byte(signature), []byte(expected)) || storedPurpose != purpose ||
+		usedAt.Valid || time.Now().After(expiresAt) {
+		return "", ErrInvalidToken
+	}
+	return userID, nil
+}
+
+// ConsumeToken validates a token for the given purpose, marks it used and returns its user ID.
+func ConsumeToken(token, purpose string) (string, error) {
+	userID, err := CheckToken(token, purpose)
+	if err != nil {
+		return "", err
+	}
+	tokenID, _, _ := strings.Cut(token, ".")
+
+	// The used_at check makes concurrent redemptions of the same token fail.
+	result, err := db.Exec("UPDATE user_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL", time.Now(), tokenID)
+	if err != nil {
+		return "", err
+	}
+	if n, err := result.RowsAffected(); err != nil || n != 1 {
+		return "", ErrInvalidToken
+	}
+
+	return userID, nil
+}
+
+// RevokeTokens marks every unused token of the given purpose for the user as used.
+func RevokeTokens(userID, purpose string) error {
+	_, err := db.Exec("UPDATE user_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL",
+		time.Now(), userID, purpose)
+	return err
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckToken(t *testing.T) {
+	setupTestDB(t)
+
+	userID := registerTestUser(t, "reader")
+	token, err := CreateToken(userID, TokenPasswordReset, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := CreateToken(userID, TokenPasswordReset, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenID, signature, _ := strings.Cut(token, ".")
+	tampered := signature[:len(signature)-1] + "0"
+	if tampered == signature {
+		tampered = signature[:len(signature)-1] + "1"
+	}
+
+	// A token is only accepted whole, for its own purpose and before it expires
+	tests := []struct {
+		name    string
+		token   string
+		purpose string
+		wantErr error
+	}{
+		{"valid", token, TokenPasswordReset, nil},
+		{"other purpose", token, TokenEmailVerification, ErrInvalidToken},
+		{"expired", expired, TokenPasswordReset, ErrInvalidToken},
+		{"tampered signature", tokenID + "." + tampered, TokenPasswordReset, ErrInvalidToken},
+		{"no signature", tokenID, TokenPasswordReset, ErrInvalidToken},
+		{"unknown", "no-such-token." + signature, TokenPasswordReset, ErrInvalidToken},
+	}
+	for _, test := range tests {
+		got, err := CheckToken(test.token, test.purpose)
+		if err != test.wantErr || (err == nil && got != userID) {
+			t.Errorf("%s: expected %v; got %q (%v)", test.name, test.wantErr, got, err)
+		}
+	}
+}
+
+func TestConsumeToken(t *testing.T) {
+	setupTestDB(t)
+
+	userID := registerTestUser(t, "reader")
+	token, err := CreateToken(userID, TokenEmailVerification, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Checking leaves a token usable, consuming it works once
+	if _, err := CheckToken(token, TokenEmailVerification); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		wantErr error
+	}{
+		{"first use", nil},
+		{"second use", ErrInvalidToken},
+	}
+	for _, test := range tests {
+		if got, err := ConsumeToken(token, TokenEmailVerification); err != test.wantErr || (err == nil && got != userID) {
+			t.Errorf("%s: expected %v; got %q (%v)", test.name, test.wantErr, got, err)
+		}
+	}
+	if _, err := CheckToken(token, TokenEmailVerification); err != ErrInvalidToken {
+		t.Errorf("expected a used token to be invalid; got %v", err)
+	}
+}
+
+func TestRevokeTokens(t *testing.T) {
+	setupTestDB(t)
+
+	userID := registerTestUser(t, "reader")
+	reset, err := CreateToken(userID, TokenPasswordReset, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verification, err := CreateToken(userID, TokenEmailVerification, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Revoking only touches tokens of the given purpose
+	if err := RevokeTokens(userID, TokenPasswordReset); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckToken(reset, TokenPasswordReset); err != ErrInvalidToken {
+		t.Errorf("expected the reset token revoked; got %v", err)
+	}
+	if _, err := CheckToken(verification, TokenEmailVerification); err != nil {
+		t.Errorf("expected the verification token still valid; got %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// TOTP parameters from RFC 6238 as understood by common authenticator apps.
+const (
+	totpPeriod        = 30 // seconds per time step
+	totpDigits        = 6
+	totpSkew          = 1 // accepted steps before and after the current one
+	recoveryCodeCount = 10
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a random base32 secret suitable for authenticator apps.
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base32NoPadding.EncodeToString(secret), nil
+}
+
+// TOTPCode computes the code for the given secret at time step counter (RFC 4226 HOTP).
+func TOTPCode(secret string, counter int64) (string, error) {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%uint32(math.Pow10(totpDigits))), nil
+}
+
+// matchTOTP returns the time step the code belongs to, or -1 when it matches none in the accepted window.
+func matchTOTP(secret, code string, now time.Time) int64 {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := TOTPCode(secret, step)
+		if err == nil && hmac.Equal([]byte(expected), []byte(code)) {
+			return step
+		}
+	}
+	return -1
+}
+
+// TOTPProvisioningURI builds the otpauth:// URI that authenticator apps import from a QR code.
+func TOTPProvisioningURI(issuer, account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// TwoFactorStatus describes a user's 2FA enrolment.
+type TwoFactorStatus struct {
+	Enabled       bool
+	PendingSecret string // secret shown during enrolment until the first code is confirmed
+	RecoveryLeft  int
+}
+
+// GetTwoFactorStatus returns the 2FA enrolment state of a user.
+func GetTwoFactorStatus(userID string) (TwoFactorStatus, error) {
+	var status TwoFactorStatus
+	var secret sql.NullString
+
+	err := db.QueryRow("SELECT COALESCE(totp_enabled, FALSE), totp_secret FROM users WHERE id = ?", userID).Scan(&status.Enabled, &secret)
+	if err != nil {
+		return status, err
+	}
+	if !status.Enabled {
+		status.PendingSecret = secret.String
+	}
+
+	err = db.QueryRow("SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&status.RecoveryLeft)
+	return status, err
+}
+
+// IsTwoFactorEnabled reports whether logging in as the user requires a second factor.
+func IsTwoFactorEnabled(userID string) (bool, error) {
+	var enabled bool
+	err := db.QueryRow("SELECT COALESCE(totp_enabled, FALSE) FROM users WHERE id = ?", userID).Scan(&enabled)
+	return enabled, err
+}
+
+// StartTwoFactorEnrolment stores a new pending secret for a user who has not enabled 2FA yet.
+func StartTwoFactorEnrolment(userID string) (string, error) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.Exec("UPDATE users SET totp_secret = ?, totp_last_step = 0 WHERE id = ? AND COALESCE(totp_enabled, FALSE) = FALSE", secret, userID)
+	return secret, err
+}
+
+// EnableTwoFactor turns on 2FA once the user proves their app produces valid codes for the
+// pending secret. It returns freshly generated recovery codes to show to the user once.
+func EnableTwoFactor(userID, code string) ([]string, error) {
+	status, err := GetTwoFactorStatus(userID)
+	if err != nil {
+		return nil, err
+	}
+	if status.Enabled || status.PendingSecret == "" {
+		return nil, ErrInvalidToken
+	}
+
+	step := matchTOTP(status.PendingSecret, code, time.Now())
+	if step < 0 {
+		return nil, ErrInvalidToken
+	}
+
+	_, err = db.Exec("UPDATE users SET totp_enabled = TRUE, totp_last_step = ? WHERE id = ?", step, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return RegenerateRecoveryCodes(userID)
+}
+
+// DisableTwoFactor removes the user's secret and recovery codes.
+func DisableTwoFactor(userID string) error {
+	_, err := db.Exec("UPDATE users SET totp_enabled = FALSE, totp_secret = NULL, totp_last_step = 0 WHERE id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID)
+	return err
+}
+
+// VerifySecondFactor accepts either a current TOTP code or an unused recovery code.
+// A TOTP code can only be used once, and a recovery code is spent when it matches.
+func VerifySecondFactor(userID, code string) (bool, error) {
+	var secret string
+	err := db.QueryRow("SELECT COALESCE(totp_secret, '') FROM users WHERE id = ? AND totp_enabled = TRUE", userID).Scan(&secret)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if step := matchTOTP(secret, code, time.Now()); step >= 0 {
+		// Updating only to a later step rejects replays of a code that was already used.
+		result, err := db.Exec("UPDATE users SET totp_last_step = ? WHERE id = ? AND COALESCE(totp_last_step, 0) < ?", step, userID, step)
+		if err != nil {
+			return false, err
+		}
+		n, err := result.RowsAffected()
+		return n == 1, err
+	}
+
+	result, err := db.Exec("UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		time.Now(), userID, hashRecoveryCode(code))
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes with new ones and returns them in plain text.
+func RegenerateRecoveryCodes(userID string) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		encoded := strings.ToLower(base32NoPadding.EncodeToString(raw))
+		code := encoded[:4] + "-" + encoded[4:]
+
+		id, err := uuid.NewV4()
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec("INSERT INTO recovery_codes (id, user_id, code_hash) VALUES (?, ?, ?)", id.String(), userID, hashRecoveryCode(code))
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, tx.Commit()
+}
+
+// hashRecoveryCode normalizes a recovery code and hashes it for storage. The codes are random,
+// so a fast hash is enough to keep them useless to anyone reading the database.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsTwoFactorRequired reports whether the site requires the user to enable 2FA because of their role.
+func IsTwoFactorRequired(userID string) (bool, error) {
+	role, err := GetUserRole(userID)
+	if err != nil || !IsPrivilegedRole(role) {
+		return false, err
+	}
+	return GetBoolSetting(SettingRequire2FAPrivileged, false)
+}
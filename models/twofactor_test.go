@@ -0,0 +1,58 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 test key "12345678901234567890" from RFC 6238, base32 encoded.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// Expected values are the last 6 digits of the RFC 6238 appendix B test vectors
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, v := range vectors {
+		code, err := TOTPCode(rfc6238Secret, v.unix/totpPeriod)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if code != v.code {
+			t.Errorf("at %d: expected %s; got %s", v.unix, v.code, code)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	// Case 1: current and adjacent steps are accepted to allow for clock drift
+	for _, step := range []int64{current - 1, current, current + 1} {
+		code, _ := TOTPCode(rfc6238Secret, step)
+		if got := matchTOTP(rfc6238Secret, code, now); got != step {
+			t.Errorf("expected step %d; got %d", step, got)
+		}
+	}
+
+	// Case 2: codes outside the window are rejected
+	code, _ := TOTPCode(rfc6238Secret, current-2)
+	if got := matchTOTP(rfc6238Secret, code, now); got != -1 {
+		t.Errorf("expected old code to be rejected; got step %d", got)
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	if hashRecoveryCode("abcd-efgh") != hashRecoveryCode(" ABCD EFGH ") {
+		t.Errorf("expected recovery codes to be normalized before hashing")
+	}
+}
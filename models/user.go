@@ -3,6 +3,7 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"golang.org/x/crypto/bcrypt"
@@ -24,7 +25,7 @@ func CheckUsernameExists(username string) (bool, error) {
 
 // RegisterUser creates a new user with the given email, username, and hashed password.
 func RegisterUser(email, username, password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(password)
 	if err != nil {
 		return "", err
 	}
@@ -38,29 +39,114 @@ func RegisterUser(email, username, password string) (string, error) {
 		return "", err
 	}
 
-	_, err = db.Exec("INSERT INTO users (id, email, username, password, session_token) VALUES (?, ?, ?, ?, ?)",
-		userID.String(), email, username, hashedPassword, sessionToken.String())
+	_, err = db.Exec("INSERT INTO users (id, email, username, username_skeleton, password, session_token, email_verified, created_at) VALUES (?, ?, ?, ?, ?, ?, FALSE, ?)",
+		userID.String(), email, username, UsernameSkeleton(username), hashedPassword, sessionToken.String(), time.Now())
 	return sessionToken.String(), err
 }
 
-// AuthenticateUser checks the user's email and password, returning their ID if valid.
-func AuthenticateUser(email, password string) (string, error) {
+// Login throttling settings applied by VerifyCredentials after repeated failures.
+const (
+	throttleAfterFailures  = 3                // failures from one address before each attempt must wait
+	maxFailedLogins        = 5                // failures from one address before the account is locked for it
+	maxAccountFailedLogins = 20               // failures from all addresses before the account is locked for all
+	lockoutDuration        = 15 * time.Minute // how long a locked account stays locked
+	failureMemory          = 24 * time.Hour   // how long a failure counts towards a lock
+)
+
+// allAddresses is the client_ip of the login_failures row that counts the failures of an account
+// from every address.
+const allAddresses = ""
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrLoginThrottled     = errors.New("too many failed login attempts, try again shortly")
+	ErrAccountLocked      = errors.New("account temporarily locked after repeated failed logins")
+)
+
+// AuthenticateUser checks the user's email and password, returning a new session token if valid.
+func AuthenticateUser(email, password, clientIP string) (string, error) {
+	userID, err := VerifyCredentials(email, password, clientIP)
+	if err != nil {
+		return "", err
+	}
+	return CreateSession(userID)
+}
+
+// VerifyCredentials checks the user's email and password, returning their ID if valid.
+// Repeated failures from the client address first slow down further attempts and then lock
+// the account for that address for a while, so one address cannot lock the owner out. Many
+// failures from several addresses lock the account for every address.
+// Hashes made with a lower bcrypt cost than the current one are upgraded on success.
+func VerifyCredentials(email, password, clientIP string) (string, error) {
 	var userID, hashedPassword string
+	var failedLogins int
+	var lastFailed, lockedUntil, accountLockedUntil sql.NullTime
 
-	err := db.QueryRow("SELECT id, password FROM users WHERE email = ?", email).Scan(&userID, &hashedPassword)
+	err := db.QueryRow(`
+        SELECT users.id, users.password, COALESCE(address.failed_logins, 0),
+               address.last_failed_login, address.locked_until, account.locked_until
+        FROM users
+        LEFT JOIN login_failures AS address ON address.user_id = users.id AND address.client_ip = ?
+        LEFT JOIN login_failures AS account ON account.user_id = users.id AND account.client_ip = ?
+        WHERE users.email = ?
+    `, clientIP, allAddresses, email).Scan(&userID, &hashedPassword, &failedLogins, &lastFailed, &lockedUntil, &accountLockedUntil)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", errors.New("invalid credentials")
+			return "", ErrInvalidCredentials
 		}
 		return "", err
 	}
 
+	now := time.Now()
+	if lockedUntil.Valid && now.Before(lockedUntil.Time) || accountLockedUntil.Valid && now.Before(accountLockedUntil.Time) {
+		return "", ErrAccountLocked
+	}
+	if lastFailed.Valid && now.Before(lastFailed.Time.Add(loginBackoff(failedLogins))) {
+		return "", ErrLoginThrottled
+	}
+
 	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 	if err != nil {
-		return "", errors.New("invalid credentials")
+		if err := recordFailedLogin(userID, clientIP, now); err != nil {
+			return "", err
+		}
+		return "", ErrInvalidCredentials
+	}
+
+	_, err = db.Exec("DELETE FROM login_failures WHERE user_id = ? AND client_ip = ?", userID, clientIP)
+	if err != nil {
+		return "", err
+	}
+
+	if cost, err := bcrypt.Cost([]byte(hashedPassword)); err == nil && cost < bcryptCost {
+		if rehashed, err := hashPassword(password); err == nil {
+			_, err = db.Exec("UPDATE users SET password = ? WHERE id = ? AND password = ?", rehashed, userID, []byte(hashedPassword))
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return userID, nil
+}
+
+// CheckPassword reports whether password is the current password of the user.
+func CheckPassword(userID, password string) (bool, error) {
+	var hashedPassword sql.NullString
+	err := db.QueryRow("SELECT password FROM users WHERE id = ?", userID).Scan(&hashedPassword)
+	if err != nil {
+		return false, err
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hashedPassword.String), []byte(password)) == nil, nil
+}
+
+// CreateSession issues a new session token for the user, replacing any previous session.
+func CreateSession(userID string) (string, error) {
+	sessionToken, err := uuid.NewV4()
+	if err != nil {
+		return "", err
 	}
 
-	sessionToken, _ := uuid.NewV4()
 	_, err = db.Exec("UPDATE users SET session_token = ? WHERE id = ?", sessionToken.String(), userID)
 	if err != nil {
 		return "", err
@@ -69,6 +155,62 @@ func AuthenticateUser(email, password string) (string, error) {
 	return sessionToken.String(), nil
 }
 
+// loginBackoff returns how long to wait after the last failure before another attempt is allowed.
+func loginBackoff(failedLogins int) time.Duration {
+	if failedLogins < throttleAfterFailures {
+		return 0
+	}
+	return time.Duration(1<<uint(failedLogins-throttleAfterFailures)) * time.Second
+}
+
+// recordFailedLogin counts a failed attempt for the client address and for the account, and locks
+// the account for the address or for all addresses once their limit is reached. Failures older
+// than failureMemory start the count again.
+func recordFailedLogin(userID, clientIP string, now time.Time) error {
+	limits := []struct {
+		clientIP  string
+		maxFailed int
+	}{
+		{clientIP, maxFailedLogins},
+		{allAddresses, maxAccountFailedLogins},
+	}
+	for _, limit := range limits {
+		// Counting in the upsert keeps concurrent failures from overwriting each other
+		_, err := db.Exec(`
+            INSERT INTO login_failures (user_id, client_ip, failed_logins, last_failed_login) VALUES (?, ?, 1, ?)
+            ON CONFLICT (user_id, client_ip) DO UPDATE SET
+                failed_logins = CASE WHEN julianday(last_failed_login) < julianday(?) THEN 1 ELSE failed_logins + 1 END,
+                last_failed_login = excluded.last_failed_login
+        `, userID, limit.clientIP, now, now.Add(-failureMemory))
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`
+            UPDATE login_failures SET failed_logins = 0, last_failed_login = NULL, locked_until = ?
+            WHERE user_id = ? AND client_ip = ? AND failed_logins >= ?
+        `, now.Add(lockoutDuration), userID, limit.clientIP, limit.maxFailed)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PruneLoginFailures deletes the failed logins that no longer count and the locks that have expired.
+func PruneLoginFailures(now time.Time) (int, error) {
+	result, err := db.Exec(`
+        DELETE FROM login_failures
+        WHERE COALESCE(julianday(last_failed_login), 0) < julianday(?)
+          AND COALESCE(julianday(locked_until), 0) < julianday(?)
+    `, now.Add(-failureMemory), now)
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := result.RowsAffected()
+	return int(pruned), err
+}
+
 // GetUsernameByID retrieves a username based on the user ID.
 func GetIDBySessionToken(sessionToken string) (string, string, error) {
 	var username string
@@ -79,3 +221,89 @@ func GetIDBySessionToken(sessionToken string) (string, string, error) {
 	}
 	return userID, username, nil
 }
+
+// GetUserByEmail retrieves the ID and username of the user registered with an email.
+func GetUserByEmail(email string) (string, string, error) {
+	var userID, username string
+	err := db.QueryRow("SELECT id, username FROM users WHERE email = ?", email).Scan(&userID, &username)
+	return userID, username, err
+}
+
+// GetUsernameByID retrieves the username of a user.
+func GetUsernameByID(userID string) (string, error) {
+	var username string
+	err := db.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
+	return username, err
+}
+
+// GetEmailByID retrieves the email address of a user.
+func GetEmailByID(userID string) (string, error) {
+	var email string
+	err := db.QueryRow("SELECT email FROM users WHERE id = ?", userID).Scan(&email)
+	return email, err
+}
+
+// IsEmailVerified reports whether the user has confirmed their email address.
+func IsEmailVerified(userID string) (bool, error) {
+	var verified bool
+	err := db.QueryRow("SELECT COALESCE(email_verified, TRUE) FROM users WHERE id = ?", userID).Scan(&verified)
+	return verified, err
+}
+
+// MarkEmailVerified records that the user has confirmed their email address.
+func MarkEmailVerified(userID string) error {
+	_, err := db.Exec("UPDATE users SET email_verified = TRUE WHERE id = ?", userID)
+	return err
+}
+
+// ResetPassword stores a new password hash and signs the user out everywhere.
+func ResetPassword(userID, password string) error {
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("UPDATE users SET password = ?, session_token = NULL WHERE id = ?", hashedPassword, userID)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM login_failures WHERE user_id = ?", userID)
+	return err
+}
+
+// User roles; moderators and admins are privileged.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// IsPrivilegedRole reports whether a role grants moderation or administration rights.
+func IsPrivilegedRole(role string) bool {
+	return role == RoleModerator || role == RoleAdmin
+}
+
+// GetUserRole retrieves the role of a user.
+func GetUserRole(userID string) (string, error) {
+	var role string
+	err := db.QueryRow("SELECT COALESCE(role, 'user') FROM users WHERE id = ?", userID).Scan(&role)
+	return role, err
+}
+
+// SetUserRole changes the role of the user with the given username.
+func SetUserRole(username, role string) error {
+	if role != RoleUser && role != RoleModerator && role != RoleAdmin {
+		return errors.New("unknown role")
+	}
+
+	result, err := db.Exec("UPDATE users SET role = ? WHERE username = ?", role, username)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
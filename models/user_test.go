@@ -0,0 +1,146 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVerifyCredentialsLockout(t *testing.T) {
+	setupTestDB(t)
+
+	userID := registerTestUser(t, "reader")
+	email, password := "reader@example.com", "correct horse battery"
+
+	// Failures from one address throttle and then lock it out; the owner can still log in from another
+	tests := []struct {
+		name     string
+		clientIP string
+		password string
+		wait     bool // let the backoff pass before this attempt
+		wantErr  error
+	}{
+		{"first failure", "192.0.2.1", "wrong", false, ErrInvalidCredentials},
+		{"second failure", "192.0.2.1", "wrong", false, ErrInvalidCredentials},
+		{"third failure", "192.0.2.1", "wrong", false, ErrInvalidCredentials},
+		{"too soon", "192.0.2.1", password, false, ErrLoginThrottled},
+		{"fourth failure", "192.0.2.1", "wrong", true, ErrInvalidCredentials},
+		{"fifth failure", "192.0.2.1", "wrong", true, ErrInvalidCredentials},
+		{"locked", "192.0.2.1", password, true, ErrAccountLocked},
+		{"other address", "198.51.100.7", password, false, nil},
+		{"other address fails", "198.51.100.7", "wrong", false, ErrInvalidCredentials},
+		{"still locked", "192.0.2.1", password, true, ErrAccountLocked},
+	}
+	for _, test := range tests {
+		if test.wait {
+			if _, err := db.Exec("UPDATE login_failures SET last_failed_login = ?", time.Now().Add(-time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := VerifyCredentials(email, test.password, test.clientIP)
+		if err != test.wantErr || (err == nil && got != userID) {
+			t.Errorf("%s: expected %v; got %q (%v)", test.name, test.wantErr, got, err)
+		}
+	}
+
+	// A successful login clears the failures of its address, a password reset clears all of them
+	var failures int
+	if err := db.QueryRow("SELECT COUNT(*) FROM login_failures WHERE client_ip = ?", "198.51.100.7").Scan(&failures); err != nil || failures != 1 {
+		t.Errorf("expected the failure after the login recorded; got %d (%v)", failures, err)
+	}
+	if err := ResetPassword(userID, password); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyCredentials(email, password, "192.0.2.1"); err != nil {
+		t.Errorf("expected the lock lifted by the password reset; got %v", err)
+	}
+}
+
+func TestLoginBackoff(t *testing.T) {
+	tests := []struct {
+		failedLogins int
+		want         time.Duration
+	}{
+		{0, 0},
+		{throttleAfterFailures - 1, 0},
+		{throttleAfterFailures, time.Second},
+		{throttleAfterFailures + 1, 2 * time.Second},
+	}
+	for _, test := range tests {
+		if got := loginBackoff(test.failedLogins); got != test.want {
+			t.Errorf("%d failures: expected %v; got %v", test.failedLogins, test.want, got)
+		}
+	}
+}
+
+func TestVerifyCredentialsAccountLockout(t *testing.T) {
+	setupTestDB(t)
+
+	registerTestUser(t, "reader")
+	email, password := "reader@example.com", "correct horse battery"
+
+	// Failures spread over many addresses, even at the same time, all count towards the account limit
+	var wg sync.WaitGroup
+	for i := 0; i < maxAccountFailedLogins-1; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := VerifyCredentials(email, "wrong", fmt.Sprintf("192.0.2.%d", i)); err != ErrInvalidCredentials {
+				t.Errorf("attempt %d: expected ErrInvalidCredentials; got %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	var failures int
+	if err := db.QueryRow("SELECT failed_logins FROM login_failures WHERE client_ip = ?", allAddresses).Scan(&failures); err != nil || failures != maxAccountFailedLogins-1 {
+		t.Fatalf("expected %d failures for the account; got %d (%v)", maxAccountFailedLogins-1, failures, err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  error
+	}{
+		{"last failure", "wrong", ErrInvalidCredentials},
+		{"locked everywhere", password, ErrAccountLocked},
+	}
+	for _, test := range tests {
+		if _, err := VerifyCredentials(email, test.password, "203.0.113.9"); err != test.wantErr {
+			t.Errorf("%s: expected %v; got %v", test.name, test.wantErr, err)
+		}
+	}
+}
+
+func TestPruneLoginFailures(t *testing.T) {
+	setupTestDB(t)
+
+	userID := registerTestUser(t, "reader")
+	now := time.Now()
+	rows := []struct {
+		clientIP    string
+		lastFailed  interface{}
+		lockedUntil interface{}
+	}{
+		{"192.0.2.1", now.Add(-failureMemory - time.Hour), nil},  // forgotten
+		{"192.0.2.2", nil, now.Add(-time.Minute)},                // lock expired
+		{"192.0.2.3", now.Add(-time.Hour), nil},                  // still counts
+		{"192.0.2.4", nil, now.Add(time.Minute)},                 // still locked
+		{allAddresses, now.Add(-failureMemory - time.Hour), nil}, // forgotten
+	}
+	for _, row := range rows {
+		_, err := db.Exec("INSERT INTO login_failures (user_id, client_ip, failed_logins, last_failed_login, locked_until) VALUES (?, ?, 1, ?, ?)",
+			userID, row.clientIP, row.lastFailed, row.lockedUntil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if pruned, err := PruneLoginFailures(now); err != nil || pruned != 3 {
+		t.Errorf("expected 3 rows pruned; got %d (%v)", pruned, err)
+	}
+	var left int
+	if err := db.QueryRow("SELECT COUNT(*) FROM login_failures WHERE client_ip IN ('192.0.2.3', '192.0.2.4')").Scan(&left); err != nil || left != 2 {
+		t.Errorf("expected the current failure and lock kept; got %d (%v)", left, err)
+	}
+}
@@ -0,0 +1,172 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockProvider is a minimal OpenID Connect provider issuing RS256 ID tokens.
+type mockProvider struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string // PKCE challenge received on the authorization request
+	nonce     string // nonce received on the authorization request
+	claims    map[string]interface{}
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" || codeChallenge(r.FormValue("code_verifier")) != m.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.sign(t, m.claims)})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+
+	m.claims = map[string]interface{}{
+		"iss":                m.server.URL,
+		"sub":                "user-42",
+		"aud":                "forum",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"email":              "reader@example.com",
+		"email_verified":     true,
+		"preferred_username": "reader",
+	}
+	return m
+}
+
+func (m *mockProvider) sign(t *testing.T, claims map[string]interface{}) string {
+	claims["nonce"] = m.nonce
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test-key", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// authorize plays the part of the user signing in: it records what the authorization URL asked for.
+func (m *mockProvider) authorize(t *testing.T, authURL string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != "forum" {
+		t.Fatalf("unexpected authorization request: %s", authURL)
+	}
+	m.challenge = query.Get("code_challenge")
+	m.nonce = query.Get("nonce")
+}
+
+func TestProviderExchange(t *testing.T) {
+	mock := newMockProvider(t)
+	provider := NewProvider(Config{Name: "mock", Issuer: mock.server.URL, ClientID: "forum", ClientSecret: "secret"}, "http://localhost:8080/oauth/callback")
+	ctx := context.Background()
+
+	authURL, err := provider.AuthURL(ctx, "state", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(authURL, mock.server.URL+"/authorize?") {
+		t.Errorf("unexpected authorization URL %s", authURL)
+	}
+	mock.authorize(t, authURL)
+
+	// Case 1: valid code, verifier and nonce
+	claims, err := provider.Exchange(ctx, "good-code", "verifier-1", "nonce-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.Subject != "user-42" || claims.Email != "reader@example.com" || !claims.EmailVerified || claims.PreferredUsername != "reader" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	// Case 2: wrong PKCE verifier
+	if _, err := provider.Exchange(ctx, "good-code", "other-verifier", "nonce-1"); err == nil {
+		t.Errorf("expected an error for a wrong code verifier")
+	}
+
+	// Case 3: nonce from another sign in attempt
+	if _, err := provider.Exchange(ctx, "good-code", "verifier-1", "nonce-2"); err == nil {
+		t.Errorf("expected an error for a nonce mismatch")
+	}
+
+	// Case 4: token issued for another client
+	mock.claims["aud"] = "someone-else"
+	if _, err := provider.Exchange(ctx, "good-code", "verifier-1", "nonce-1"); err == nil {
+		t.Errorf("expected an error for a foreign audience")
+	}
+	mock.claims["aud"] = "forum"
+
+	// Case 5: expired token
+	mock.claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	if _, err := provider.Exchange(ctx, "good-code", "verifier-1", "nonce-1"); err == nil {
+		t.Errorf("expected an error for an expired token")
+	}
+}
+
+func TestVerifyIDTokenRejectsForgedSignature(t *testing.T) {
+	mock := newMockProvider(t)
+	provider := NewProvider(Config{Name: "mock", Issuer: mock.server.URL, ClientID: "forum"}, "http://localhost:8080/oauth/callback")
+	ctx := context.Background()
+
+	m, err := provider.discover(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A token signed by a different key must not verify against the provider's JWKS
+	forger := newMockProvider(t)
+	forger.nonce = "n"
+	token := forger.sign(t, mock.claims)
+
+	if _, err := provider.verifyIDToken(ctx, m, token, "n"); err == nil {
+		t.Errorf("expected an error for a token signed with an unknown key")
+	}
+}
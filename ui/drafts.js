@@ -0,0 +1,61 @@
+// Autosaves the create post form as a draft a moment after the author stops typing,
+// and tells the server the browser's time zone for scheduled posts.
+(function () {
+    var form = document.querySelector("form[data-autosave]");
+    if (!form) {
+        return;
+    }
+    var status = form.querySelector(".draft-status");
+    var pending, saving = false, dirty = false;
+
+    form.elements["publish_offset"].value = new Date().getTimezoneOffset();
+
+    function save() {
+        if (saving) {
+            // Save again once the running save has returned the draft ID
+            dirty = true;
+            return;
+        }
+        saving = true;
+        var data = new FormData(form);
+        data.delete("image");
+        fetch("/drafts/save", {
+            method: "POST",
+            headers: { "Accept": "application/json" },
+            body: data,
+            credentials: "same-origin"
+        }).then(function (response) {
+            return response.json().then(function (body) { return { ok: response.ok, body: body }; });
+        }).then(function (result) {
+            if (result.ok) {
+                form.elements["draft_id"].value = result.body.id;
+                if (result.body.saved_at) {
+                    status.textContent = "Draft saved at " + result.body.saved_at;
+                }
+            } else {
+                status.textContent = result.body.error || "The draft could not be saved";
+            }
+        }).catch(function () {
+            status.textContent = "The draft could not be saved";
+        }).then(function () {
+            saving = false;
+            if (dirty) {
+                dirty = false;
+                save();
+            }
+        });
+    }
+
+    function schedule() {
+        clearTimeout(pending);
+        pending = setTimeout(save, 2000);
+    }
+
+    form.addEventListener("input", schedule);
+    form.addEventListener("change", schedule);
+    form.addEventListener("submit", function () {
+        clearTimeout(pending);
+        // The time zone may have changed since the page was loaded
+        form.elements["publish_offset"].value = new Date().getTimezoneOffset();
+    });
+})();
@@ -0,0 +1,84 @@
+// Live updates of the post page: new comments, like/dislike counts and poll results arrive over server-sent events.
+(function () {
+    var main = document.querySelector("main[data-post-id]");
+    if (!main || !window.EventSource) {
+        return;
+    }
+    var postID = main.getAttribute("data-post-id");
+    var comments = document.getElementById("comments");
+    var template = document.getElementById("comment-template");
+
+    function setCounts(container, likes, dislikes) {
+        container.querySelectorAll(".likes-count").forEach(function (el) { el.textContent = likes; });
+        container.querySelectorAll(".dislikes-count").forEach(function (el) { el.textContent = dislikes; });
+    }
+
+    function findComment(id) {
+        var sections = comments.querySelectorAll(".comment-section");
+        for (var i = 0; i < sections.length; i++) {
+            if (sections[i].getAttribute("data-comment-id") === id) {
+                return sections[i];
+            }
+        }
+        return null;
+    }
+
+    var source = new EventSource("/post/events?id=" + encodeURIComponent(postID));
+
+    source.addEventListener("comment", function (e) {
+        var comment = JSON.parse(e.data);
+        // The author's own comment is already on the page after the redirect
+        if (findComment(comment.id)) {
+            return;
+        }
+        var section = template.content.firstElementChild.cloneNode(true);
+        section.setAttribute("data-comment-id", comment.id);
+        // The content is sanitized by the server, exactly as it is rendered on the page
+        section.querySelector(".comment-content").innerHTML = comment.content;
+        if (window.openSpoilers) {
+            window.openSpoilers(section);
+        }
+        section.querySelector(".comment-author").textContent = comment.author;
+        section.querySelector(".reputation").textContent = comment.author_reputation;
+        section.querySelector("a.author").href = "/user/" + encodeURIComponent(comment.author);
+        section.querySelectorAll("input[name=comment_id], input[name=target_id]").forEach(function (input) { input.value = comment.id; });
+        section.querySelector(".who-reacted").href = "/reactions?comment_id=" + encodeURIComponent(comment.id);
+        comments.appendChild(section);
+    });
+
+    source.addEventListener("reactions", function (e) {
+        var counts = JSON.parse(e.data);
+        if (counts.comment_id) {
+            var section = findComment(counts.comment_id);
+            if (section) {
+                setCounts(section, counts.likes, counts.dislikes);
+            }
+            return;
+        }
+        setCounts(main.querySelector(".post"), counts.likes, counts.dislikes);
+    });
+
+    source.addEventListener("emoji_reaction", function (e) {
+        var reaction = JSON.parse(e.data);
+        var container = reaction.comment_id ? findComment(reaction.comment_id) : main.querySelector(".post");
+        if (!container) {
+            return;
+        }
+        container.querySelectorAll(".reaction-button").forEach(function (button) {
+            if (button.getAttribute("data-reaction") !== reaction.type) {
+                return;
+            }
+            button.querySelector(".reaction-count").textContent = reaction.count;
+            // Read-only counts of reactions nobody has added are hidden
+            if (button.tagName === "SPAN") {
+                button.hidden = reaction.count === 0;
+            }
+        });
+    });
+
+    source.addEventListener("poll", function (e) {
+        if (window.updatePoll) {
+            window.updatePoll(JSON.parse(e.data));
+        }
+    });
+})();
@@ -0,0 +1,91 @@
+// Completes @usernames and #tags in textareas with a data-mentions attribute.
+// Suggestions appear under the textarea; arrows pick one, Enter or Tab inserts it, Escape closes the list.
+(function () {
+    var word = /(?:^|[^\p{L}\p{N}_.@&#/])([@#])([\p{L}\p{N}_.\-]*)$/u;
+    var sources = { "@": "/user_suggestions?q=", "#": "/tag_suggestions?q=" };
+
+    document.querySelectorAll("textarea[data-mentions]").forEach(function (textarea) {
+        var list = document.createElement("ul");
+        list.className = "mention-suggestions";
+        list.hidden = true;
+        textarea.insertAdjacentElement("afterend", list);
+        var pending, active = -1, current = null;
+
+        function close() {
+            list.hidden = true;
+            list.innerHTML = "";
+            active = -1;
+            current = null;
+        }
+
+        function highlight(index) {
+            var items = list.querySelectorAll("li");
+            if (items.length === 0) {
+                return;
+            }
+            active = (index + items.length) % items.length;
+            items.forEach(function (item, i) { item.classList.toggle("active", i === active); });
+        }
+
+        function insert(name) {
+            var end = textarea.selectionStart;
+            var start = end - current.typed.length;
+            textarea.value = textarea.value.slice(0, start) + name + " " + textarea.value.slice(end);
+            textarea.selectionStart = textarea.selectionEnd = start + name.length + 1;
+            close();
+            textarea.focus();
+            textarea.dispatchEvent(new Event("input"));
+        }
+
+        textarea.addEventListener("input", function () {
+            clearTimeout(pending);
+            var match = word.exec(textarea.value.slice(0, textarea.selectionStart));
+            if (!match || match[2] === "") {
+                close();
+                return;
+            }
+            var sigil = match[1], typed = match[2];
+            pending = setTimeout(function () {
+                fetch(sources[sigil] + encodeURIComponent(typed), { credentials: "same-origin" })
+                    .then(function (response) { return response.ok ? response.json() : []; })
+                    .then(function (names) {
+                        list.innerHTML = "";
+                        if (names.length === 0) {
+                            close();
+                            return;
+                        }
+                        current = { typed: typed };
+                        names.forEach(function (name) {
+                            var item = document.createElement("li");
+                            item.textContent = sigil + name;
+                            // mousedown rather than click, so the textarea keeps the caret
+                            item.addEventListener("mousedown", function (event) {
+                                event.preventDefault();
+                                insert(name);
+                            });
+                            list.appendChild(item);
+                        });
+                        list.hidden = false;
+                        highlight(0);
+                    });
+            }, 200);
+        });
+
+        textarea.addEventListener("keydown", function (event) {
+            if (list.hidden) {
+                return;
+            }
+            if (event.key === "ArrowDown" || event.key === "ArrowUp") {
+                event.preventDefault();
+                highlight(active + (event.key === "ArrowDown" ? 1 : -1));
+            } else if (event.key === "Enter" || event.key === "Tab") {
+                event.preventDefault();
+                insert(list.querySelectorAll("li")[active].textContent.slice(1));
+            } else if (event.key === "Escape") {
+                close();
+            }
+        });
+
+        textarea.addEventListener("blur", close);
+    });
+})();
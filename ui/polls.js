@@ -0,0 +1,68 @@
+// Votes in polls without reloading the page. window.updatePoll shows new results,
+// both after the viewer's own vote and when someone else's arrives: on the post page from
+// live.js, and on feeds from /poll/events.
+(function () {
+    window.updatePoll = function (results) {
+        document.querySelectorAll(".poll[data-post-id]").forEach(function (poll) {
+            if (poll.getAttribute("data-post-id") !== results.post_id) {
+                return;
+            }
+            poll.querySelector(".poll-total").textContent = results.voters;
+            results.options.forEach(function (option) {
+                poll.querySelectorAll(".poll-results li").forEach(function (item) {
+                    if (item.getAttribute("data-option-id") !== option.id) {
+                        return;
+                    }
+                    item.querySelector(".poll-votes").textContent = option.votes;
+                    item.querySelector(".poll-percent").textContent = option.percent;
+                    item.querySelector(".poll-fill").style.width = option.percent + "%";
+                    var voters = item.querySelector(".poll-voters");
+                    if (voters) {
+                        voters.textContent = (option.voters || []).join(", ");
+                    }
+                });
+            });
+        });
+    };
+
+    // The post page has its own event stream in live.js
+    if (!document.querySelector("main[data-post-id]") && document.querySelector(".poll[data-post-id]") && window.EventSource) {
+        new EventSource("/poll/events").addEventListener("poll", function (e) {
+            window.updatePoll(JSON.parse(e.data));
+        });
+    }
+
+    document.querySelectorAll(".poll-form").forEach(function (form) {
+        form.addEventListener("submit", function (event) {
+            event.preventDefault();
+            var data = new FormData(form);
+            var chosen = data.getAll("option");
+            fetch(form.action, {
+                method: "POST",
+                headers: { "Accept": "application/json" },
+                body: new URLSearchParams(data),
+                credentials: "same-origin"
+            }).then(function (response) {
+                if (response.status === 401) {
+                    window.location = "/login";
+                    return;
+                }
+                if (!response.ok) {
+                    // Let the server explain what went wrong
+                    form.submit();
+                    return;
+                }
+                return response.json().then(function (results) {
+                    var poll = form.closest(".poll");
+                    poll.querySelectorAll(".poll-results li").forEach(function (item) {
+                        item.classList.toggle("chosen", chosen.indexOf(item.getAttribute("data-option-id")) !== -1);
+                    });
+                    form.remove();
+                    window.updatePoll(results);
+                });
+            }).catch(function () {
+                form.submit();
+            });
+        });
+    });
+})();
@@ -0,0 +1,37 @@
+// Live preview of Markdown in textareas with a data-preview attribute naming the preview element.
+// The server renders the preview, so it matches the published post exactly.
+(function () {
+    document.querySelectorAll("textarea[data-preview]").forEach(function (textarea) {
+        var preview = document.getElementById(textarea.getAttribute("data-preview"));
+        if (!preview) {
+            return;
+        }
+        var pending;
+
+        textarea.addEventListener("input", function () {
+            clearTimeout(pending);
+            pending = setTimeout(function () {
+                if (textarea.value.trim() === "") {
+                    preview.innerHTML = "";
+                    preview.hidden = true;
+                    return;
+                }
+                fetch("/preview", {
+                    method: "POST",
+                    headers: { "Accept": "application/json" },
+                    body: new URLSearchParams({ content: textarea.value }),
+                    credentials: "same-origin"
+                }).then(function (response) {
+                    return response.ok ? response.json() : null;
+                }).then(function (rendered) {
+                    if (!rendered) {
+                        return;
+                    }
+                    // The HTML is sanitized by the server, exactly as it is on published posts
+                    preview.innerHTML = rendered.html;
+                    preview.hidden = false;
+                });
+            }, 300);
+        });
+    });
+})();
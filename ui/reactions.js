@@ -0,0 +1,61 @@
+// Likes, dislikes and emoji reactions without reloading the page. Without JavaScript the forms are posted as usual.
+(function () {
+    var actions = ["/like", "/dislike", "/like_comment", "/dislike_comment", "/react"];
+
+    // showError puts the server's message next to the buttons; posting the form again would toggle twice
+    function showError(container, message) {
+        var error = container.querySelector(".reaction-error");
+        if (!error) {
+            error = document.createElement("p");
+            error.className = "reaction-error";
+            error.setAttribute("role", "alert");
+            container.appendChild(error);
+        }
+        error.textContent = message;
+        error.hidden = !message;
+    }
+
+    document.addEventListener("submit", function (e) {
+        var form = e.target;
+        if (actions.indexOf(form.getAttribute("action")) === -1) {
+            return;
+        }
+        e.preventDefault();
+
+        var container = form.closest(".comment-section, .post");
+        fetch(form.getAttribute("action"), {
+            method: "POST",
+            headers: { "Accept": "application/json" },
+            body: new URLSearchParams(new FormData(form)),
+            credentials: "same-origin"
+        }).then(function (response) {
+            if (response.status === 401) {
+                window.location.href = "/login";
+                return;
+            }
+            if (!response.ok) {
+                return response.json().then(function (body) {
+                    showError(container, body.error || "Your reaction could not be saved");
+                }, function () {
+                    showError(container, "Your reaction could not be saved");
+                });
+            }
+            showError(container, "");
+            return response.json().then(function (reaction) {
+                if (reaction.type) {
+                    // An emoji reaction only changes its own button
+                    var button = form.querySelector(".reaction-button");
+                    button.querySelector(".reaction-count").textContent = reaction.count;
+                    button.classList.toggle("active", reaction.reacted);
+                    return;
+                }
+                container.querySelector(".likes-count").textContent = reaction.likes;
+                container.querySelector(".dislikes-count").textContent = reaction.dislikes;
+                container.querySelector(".like-button").classList.toggle("active", reaction.liked);
+                container.querySelector(".dislike-button").classList.toggle("active", reaction.disliked);
+            });
+        }).catch(function () {
+            showError(container, "Your reaction could not be saved. Check your connection and try again.");
+        });
+    });
+})();
@@ -0,0 +1,23 @@
+// Spoilers stay closed until clicked, unless the reader chose to reveal them in their settings.
+// Blurred images of posts with a spoiler warning sharpen when clicked.
+(function () {
+    // openSpoilers opens the spoilers inside root; live.js calls it for comments added live.
+    window.openSpoilers = function (root) {
+        if (!document.body.classList.contains("reveal-spoilers")) {
+            return;
+        }
+        root.querySelectorAll("details.spoiler").forEach(function (spoiler) {
+            spoiler.open = true;
+        });
+    };
+
+    window.openSpoilers(document);
+
+    document.querySelectorAll("img.spoiler-blur").forEach(function (image) {
+        image.title = "Contains spoilers; click to show";
+        image.addEventListener("click", function () {
+            image.classList.remove("spoiler-blur");
+            image.title = "";
+        });
+    });
+})();
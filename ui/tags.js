@@ -0,0 +1,33 @@
+// Suggests existing tags while the tags of a new post are typed. Only the tag after the last comma is completed.
+(function () {
+    var input = document.getElementById("tags");
+    var list = document.getElementById("tag-suggestions");
+    if (!input || !list) {
+        return;
+    }
+    var pending;
+
+    input.addEventListener("input", function () {
+        clearTimeout(pending);
+        var parts = input.value.split(",");
+        var prefix = parts.pop().trim();
+        if (prefix === "") {
+            list.innerHTML = "";
+            return;
+        }
+        pending = setTimeout(function () {
+            fetch("/tag_suggestions?q=" + encodeURIComponent(prefix), { credentials: "same-origin" })
+                .then(function (response) { return response.ok ? response.json() : []; })
+                .then(function (names) {
+                    // Each option holds the whole input so picking it keeps the tags typed before
+                    var before = parts.map(function (p) { return p.trim(); }).filter(Boolean);
+                    list.innerHTML = "";
+                    names.forEach(function (name) {
+                        var option = document.createElement("option");
+                        option.value = before.concat(name).join(", ");
+                        list.appendChild(option);
+                    });
+                });
+        }, 200);
+    });
+})();